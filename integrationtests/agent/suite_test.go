@@ -159,11 +159,13 @@ func newReconciler(ctx context.Context, mgr manager.Manager, lookup *lookup) *co
 	Expect(err).ToNot(HaveOccurred())
 
 	monitor := monitor.New(
+		localClient,
 		applied,
 		mapper,
 		helmDeployer,
 		defaultNamespace,
 		agentScope,
+		nil,
 	)
 
 	// Build the drift detector
@@ -184,6 +186,7 @@ func newReconciler(ctx context.Context, mgr manager.Manager, lookup *lookup) *co
 		mapper,
 		localDynamic,
 		helmDeployer,
+		nil,
 		fleetNamespace,
 		defaultNamespace)
 
@@ -10,6 +10,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
 	memory "k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
@@ -29,8 +30,10 @@ import (
 	"github.com/rancher/lasso/pkg/client"
 	"github.com/rancher/lasso/pkg/controller"
 	"github.com/rancher/lasso/pkg/mapper"
+	"github.com/rancher/wrangler/v2/pkg/generated/controllers/coordination.k8s.io"
 	"github.com/rancher/wrangler/v2/pkg/generated/controllers/core"
 	"github.com/rancher/wrangler/v2/pkg/kubeconfig"
+	"github.com/rancher/wrangler/v2/pkg/leader"
 	"github.com/rancher/wrangler/v2/pkg/ratelimit"
 	"github.com/rancher/wrangler/v2/pkg/ticker"
 )
@@ -47,6 +50,7 @@ type ClusterStatus struct {
 	command.DebugConfig
 	UpstreamOptions
 	CheckinInterval string `usage:"How often to post cluster status" env:"CHECKIN_INTERVAL"`
+	NodeLabels      string `usage:"Comma separated list of node labels to report in the cluster status" env:"NODE_LABELS"`
 }
 
 func (cs *ClusterStatus) PersistentPre(cmd *cobra.Command, _ []string) error {
@@ -103,7 +107,7 @@ func (cs *ClusterStatus) Run(cmd *cobra.Command, args []string) error {
 	}
 
 	//  now we have both configs
-	fleetMapper, mapper, _, err := newMappers(ctx, fleetRESTConfig, clientConfig)
+	fleetMapper, mapper, discovery, err := newMappers(ctx, fleetRESTConfig, clientConfig)
 	if err != nil {
 		setupLog.Error(err, "failed to get mappers")
 		return err
@@ -138,18 +142,37 @@ func (cs *ClusterStatus) Run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	setupLog.Info("Starting cluster status ticker", "checkin interval", checkinInterval.String(), "cluster namespace", agentInfo.ClusterNamespace, "cluster name", agentInfo.ClusterName)
+	coordinationFactory, err := coordination.NewFactoryFromConfigWithOptions(localConfig, &coordination.FactoryOptions{
+		SharedControllerFactory: localFactory,
+	})
+	if err != nil {
+		setupLog.Error(err, "failed to build coordination factory")
+		return err
+	}
 
-	clusterstatus.Ticker(ctx,
-		cs.Namespace,
-		agentInfo.ClusterNamespace,
-		agentInfo.ClusterName,
-		checkinInterval,
-		coreFactory.Core().V1().Node(),
-		fleetFactory.Fleet().V1alpha1().Cluster(),
-	)
+	// only the elected replica reports the cluster status, the lock is
+	// separate from the agent's, as both containers run in each pod
+	k8s, err := kubernetes.NewForConfig(localConfig)
+	if err != nil {
+		setupLog.Error(err, "failed to build kubernetes client")
+		return err
+	}
 
-	<-cmd.Context().Done()
+	leader.RunOrDie(ctx, cs.Namespace, clusterstatus.LeaderElectionLockName, k8s, func(ctx context.Context) {
+		setupLog.Info("Starting cluster status ticker", "checkin interval", checkinInterval.String(), "cluster namespace", agentInfo.ClusterNamespace, "cluster name", agentInfo.ClusterName)
+
+		clusterstatus.Ticker(ctx,
+			cs.Namespace,
+			agentInfo.ClusterNamespace,
+			agentInfo.ClusterName,
+			checkinInterval,
+			coreFactory.Core().V1().Node(),
+			coordinationFactory.Coordination().V1().Lease(),
+			fleetFactory.Fleet().V1alpha1().Cluster(),
+			discovery,
+			cs.NodeLabels,
+		)
+	})
 
 	return nil
 }
@@ -0,0 +1,136 @@
+package clusterstatus
+
+import (
+	"sort"
+	"strings"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+)
+
+// distributionNodeLabels maps well-known node labels to the distribution, which sets them.
+var distributionNodeLabels = []struct {
+	label        string
+	distribution string
+}{
+	{label: "eks.amazonaws.com/nodegroup", distribution: "eks"},
+	{label: "eks.amazonaws.com/compute-type", distribution: "eks"},
+	{label: "kubernetes.azure.com/cluster", distribution: "aks"},
+	{label: "cloud.google.com/gke-nodepool", distribution: "gke"},
+	{label: "node.openshift.io/os_id", distribution: "openshift"},
+	{label: "minikube.k8s.io/name", distribution: "minikube"},
+}
+
+// detectDistribution guesses the Kubernetes distribution from the API
+// server's version string and well-known node labels. It returns an empty
+// string if the distribution is unknown.
+func detectDistribution(version string, nodes []corev1.Node) string {
+	switch {
+	case strings.Contains(version, "+k3s"):
+		return "k3s"
+	case strings.Contains(version, "+rke2"):
+		return "rke2"
+	case strings.Contains(version, "-eks-"):
+		return "eks"
+	case strings.Contains(version, "-gke."):
+		return "gke"
+	}
+
+	for _, node := range nodes {
+		for _, l := range distributionNodeLabels {
+			if _, ok := node.Labels[l.label]; ok {
+				return l.distribution
+			}
+		}
+		if strings.HasPrefix(node.Spec.ProviderID, "kind://") {
+			return "kind"
+		}
+	}
+
+	return ""
+}
+
+// architectures returns the sorted list of distinct CPU architectures of the nodes.
+func architectures(nodes []corev1.Node) []string {
+	result := sets.New[string]()
+	for _, node := range nodes {
+		if arch := node.Status.NodeInfo.Architecture; arch != "" {
+			result.Insert(arch)
+		}
+	}
+	return sets.List(result)
+}
+
+// operatingSystems returns the sorted list of distinct operating systems of the nodes.
+func operatingSystems(nodes []corev1.Node) []string {
+	result := sets.New[string]()
+	for _, node := range nodes {
+		if os := node.Status.NodeInfo.OperatingSystem; os != "" {
+			result.Insert(os)
+		}
+	}
+	return sets.List(result)
+}
+
+// nodeLabels returns the values of the given node labels. A label is only
+// included if all nodes, which have the label, share the same value.
+func nodeLabels(nodes []corev1.Node, keys []string) []fleet.NodeLabel {
+	var result []fleet.NodeLabel
+	for _, key := range keys {
+		values := sets.New[string]()
+		for _, node := range nodes {
+			if value, ok := node.Labels[key]; ok {
+				values.Insert(value)
+			}
+		}
+		if values.Len() != 1 {
+			continue
+		}
+		result = append(result, fleet.NodeLabel{Name: key, Value: values.UnsortedList()[0]})
+	}
+	return result
+}
+
+// parseNodeLabels splits a comma separated list of node label keys.
+func parseNodeLabels(s string) []string {
+	var keys []string
+	for _, key := range strings.Split(s, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// apiResources returns the sorted list of API resources served by the
+// cluster, in the form "group/version/Kind". Subresources are omitted. If some
+// API groups cannot be discovered, e.g. because an aggregated API server is
+// unavailable, the resources of the remaining groups are returned.
+func apiResources(client discovery.ServerResourcesInterface) ([]string, error) {
+	_, lists, err := client.ServerGroupsAndResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+
+	result := sets.New[string]()
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range list.APIResources {
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+			result.Insert(gv.String() + "/" + resource.Kind)
+		}
+	}
+
+	return sets.List(result), nil
+}
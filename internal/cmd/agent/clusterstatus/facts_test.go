@@ -0,0 +1,96 @@
+package clusterstatus
+
+import (
+	"reflect"
+	"testing"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func node(name, arch, os string, labels map[string]string) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status: corev1.NodeStatus{
+			NodeInfo: corev1.NodeSystemInfo{Architecture: arch, OperatingSystem: os},
+		},
+	}
+}
+
+func TestDetectDistribution(t *testing.T) {
+	for _, testCase := range []struct {
+		Name     string
+		Version  string
+		Nodes    []corev1.Node
+		Expected string
+	}{
+		{Name: "k3s", Version: "v1.28.5+k3s1", Expected: "k3s"},
+		{Name: "rke2", Version: "v1.27.9+rke2r1", Expected: "rke2"},
+		{Name: "eks version", Version: "v1.28.5-eks-5e0fdde", Expected: "eks"},
+		{
+			Name:     "aks node label",
+			Version:  "v1.28.3",
+			Nodes:    []corev1.Node{node("a", "amd64", "linux", map[string]string{"kubernetes.azure.com/cluster": "x"})},
+			Expected: "aks",
+		},
+		{Name: "unknown", Version: "v1.28.3", Nodes: []corev1.Node{node("a", "amd64", "linux", nil)}, Expected: ""},
+	} {
+		if result := detectDistribution(testCase.Version, testCase.Nodes); result != testCase.Expected {
+			t.Errorf("%s: expected %q, got %q", testCase.Name, testCase.Expected, result)
+		}
+	}
+}
+
+func TestNodeFacts(t *testing.T) {
+	nodes := []corev1.Node{
+		node("a", "arm64", "linux", map[string]string{"topology.kubernetes.io/region": "eu", "zone": "a"}),
+		node("b", "amd64", "linux", map[string]string{"topology.kubernetes.io/region": "eu", "zone": "b"}),
+		node("c", "amd64", "windows", nil),
+	}
+
+	if result := architectures(nodes); !reflect.DeepEqual(result, []string{"amd64", "arm64"}) {
+		t.Errorf("unexpected architectures %v", result)
+	}
+
+	if result := operatingSystems(nodes); !reflect.DeepEqual(result, []string{"linux", "windows"}) {
+		t.Errorf("unexpected operating systems %v", result)
+	}
+
+	keys := parseNodeLabels("zone, topology.kubernetes.io/region,missing")
+	expected := []fleet.NodeLabel{{Name: "topology.kubernetes.io/region", Value: "eu"}}
+	if result := nodeLabels(nodes, keys); !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected node labels %v", result)
+	}
+}
+
+func TestAPIResources(t *testing.T) {
+	client := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	client.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap"},
+				{Name: "pods", Kind: "Pod"},
+				{Name: "pods/log", Kind: "Pod"},
+			},
+		},
+		{
+			GroupVersion: "monitoring.coreos.com/v1",
+			APIResources: []metav1.APIResource{{Name: "servicemonitors", Kind: "ServiceMonitor"}},
+		},
+	}
+
+	result, err := apiResources(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"monitoring.coreos.com/v1/ServiceMonitor", "v1/ConfigMap", "v1/Pod"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected api resources %v", result)
+	}
+}
@@ -1,35 +1,54 @@
-// Package clusterstatus updates the cluster.fleet.cattle.io status in the upstream cluster with the current node status.
+// Package clusterstatus updates the cluster.fleet.cattle.io status in the upstream cluster with the current node status
+// and facts about the cluster, like the Kubernetes version, distribution, node architectures and served APIs.
 package clusterstatus
 
 import (
 	"context"
 	"encoding/json"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/sirupsen/logrus"
 
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 	"github.com/rancher/fleet/pkg/durations"
 	fleetcontrollers "github.com/rancher/fleet/pkg/generated/controllers/fleet.cattle.io/v1alpha1"
 
+	coordinationcontrollers "github.com/rancher/wrangler/v2/pkg/generated/controllers/coordination.k8s.io/v1"
 	corecontrollers "github.com/rancher/wrangler/v2/pkg/generated/controllers/core/v1"
 	"github.com/rancher/wrangler/v2/pkg/ticker"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// LeaderElectionID is the name of the lease, which the agent's replicas use
+// to elect a leader in the agent's namespace
+const LeaderElectionID = "fleet-agent-leader-election"
+
+// LeaderElectionLockName is the name of the lease, which the clusterstatus
+// containers of the agent's replicas use to elect the one reporting the
+// cluster status
+const LeaderElectionLockName = "fleet-agent-clusterstatus-lock"
+
 type handler struct {
 	agentNamespace   string
 	clusterName      string
 	clusterNamespace string
 	nodes            corecontrollers.NodeClient
+	leases           coordinationcontrollers.LeaseClient
 	clusters         fleetcontrollers.ClusterClient
+	discovery        discovery.DiscoveryInterface
+	nodeLabels       []string
 	reported         fleet.AgentStatus
+	logger           logr.Logger
 }
 
 func Ticker(ctx context.Context,
@@ -38,7 +57,10 @@ func Ticker(ctx context.Context,
 	clusterName string,
 	checkinInterval time.Duration,
 	nodes corecontrollers.NodeClient,
-	clusters fleetcontrollers.ClusterClient) {
+	leases coordinationcontrollers.LeaseClient,
+	clusters fleetcontrollers.ClusterClient,
+	discovery discovery.DiscoveryInterface,
+	nodeLabels string) {
 
 	logger := log.FromContext(ctx).WithName("clusterstatus").WithValues("cluster", clusterName, "interval", checkinInterval)
 
@@ -47,7 +69,11 @@ func Ticker(ctx context.Context,
 		clusterName:      clusterName,
 		clusterNamespace: clusterNamespace,
 		nodes:            nodes,
+		leases:           leases,
 		clusters:         clusters,
+		discovery:        discovery,
+		nodeLabels:       parseNodeLabels(nodeLabels),
+		logger:           logger,
 	}
 
 	go func() {
@@ -70,31 +96,58 @@ func Ticker(ctx context.Context,
 	}()
 }
 
-// Update the cluster.fleet.cattle.io status in the upstream cluster with the current node status
+// Update the cluster.fleet.cattle.io status in the upstream cluster with the current node status.
+// Facts, which cannot be gathered, are logged and keep their last reported
+// value, so the cluster status is always patched with a new LastSeen.
 func (h *handler) Update() error {
-	nodes, err := h.nodes.List(metav1.ListOptions{})
+	agentStatus := *h.reported.DeepCopy()
+	agentStatus.LastSeen = metav1.Now()
+	agentStatus.Namespace = h.agentNamespace
+
+	version, err := h.discovery.ServerVersion()
 	if err != nil {
-		return err
+		h.logger.Error(err, "failed to get the Kubernetes version, keeping the last reported version")
+	} else {
+		agentStatus.KubernetesVersion = version.GitVersion
 	}
 
-	ready, nonReady := sortReadyUnready(nodes.Items)
+	nodes, err := h.nodes.List(metav1.ListOptions{})
+	if err != nil {
+		h.logger.Error(err, "failed to list nodes, keeping the last reported node status")
+	} else {
+		ready, nonReady := sortReadyUnready(nodes.Items)
+		agentStatus.NonReadyNodes = len(nonReady)
+		agentStatus.ReadyNodes = len(ready)
+		agentStatus.Architectures = architectures(nodes.Items)
+		agentStatus.OperatingSystems = operatingSystems(nodes.Items)
+		agentStatus.NodeLabels = nodeLabels(nodes.Items, h.nodeLabels)
+		if version != nil {
+			agentStatus.Distribution = detectDistribution(version.GitVersion, nodes.Items)
+		}
 
-	agentStatus := fleet.AgentStatus{
-		LastSeen:      metav1.Now(),
-		Namespace:     h.agentNamespace,
-		NonReadyNodes: len(nonReady),
-		ReadyNodes:    len(ready),
+		if len(ready) > 3 {
+			ready = ready[:3]
+		}
+		if len(nonReady) > 3 {
+			nonReady = nonReady[:3]
+		}
+		agentStatus.ReadyNodeNames = ready
+		agentStatus.NonReadyNodeNames = nonReady
 	}
 
-	if len(ready) > 3 {
-		ready = ready[:3]
-	}
-	if len(nonReady) > 3 {
-		nonReady = nonReady[:3]
+	resources, err := apiResources(h.discovery)
+	if err != nil {
+		h.logger.Error(err, "failed to discover API resources, keeping the last reported resources")
+	} else {
+		agentStatus.APIResources = resources
 	}
 
-	agentStatus.ReadyNodeNames = ready
-	agentStatus.NonReadyNodeNames = nonReady
+	leader, err := h.leader()
+	if err != nil {
+		h.logger.Error(err, "failed to get the leader election lease, keeping the last reported leader")
+	} else {
+		agentStatus.Leader = leader
+	}
 
 	if equality.Semantic.DeepEqual(h.reported, agentStatus) {
 		return nil
@@ -118,6 +171,29 @@ func (h *handler) Update() error {
 	return nil
 }
 
+// leader returns the name of the agent replica, which holds the leader
+// election lease, or an empty string if the lease does not exist
+func (h *handler) leader() (string, error) {
+	lease, err := h.leases.Get(h.agentNamespace, LeaderElectionID, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if lease.Spec.HolderIdentity == nil {
+		return "", nil
+	}
+	return leaderName(*lease.Spec.HolderIdentity), nil
+}
+
+// leaderName returns the pod name from the lease holder's identity, which
+// controller-runtime builds from the hostname and a unique suffix, e.g.
+// "fleet-agent-0_2f1c5a4e-..." (pure function)
+func leaderName(holderIdentity string) string {
+	name, _, _ := strings.Cut(holderIdentity, "_")
+	return name
+}
+
 func sortReadyUnready(nodes []corev1.Node) (ready []string, nonReady []string) {
 	var (
 		masterNodeNames         []string
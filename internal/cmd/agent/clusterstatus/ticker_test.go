@@ -0,0 +1,94 @@
+package clusterstatus
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/mock/gomock"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/generic/fake"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestLeaderName(t *testing.T) {
+	for identity, expected := range map[string]string{
+		"fleet-agent-0_2f1c5a4e-7d3b-4a8e-9c1f-0e6d2b7a9f35": "fleet-agent-0",
+		"fleet-agent-1": "fleet-agent-1",
+		"":              "",
+	} {
+		if name := leaderName(identity); name != expected {
+			t.Errorf("leaderName(%q) = %q, expected %q", identity, name, expected)
+		}
+	}
+}
+
+func TestUpdateKeepsLastReportedFacts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	nodes := fake.NewMockNonNamespacedClientInterface[*corev1.Node, *corev1.NodeList](ctrl)
+	leases := fake.NewMockClientInterface[*coordinationv1.Lease, *coordinationv1.LeaseList](ctrl)
+	clusters := fake.NewMockClientInterface[*fleet.Cluster, *fleet.ClusterList](ctrl)
+
+	// the fake discovery client ignores reactor errors for resources, but
+	// fails on an invalid group version
+	discovery := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{
+		Resources: []*metav1.APIResourceList{{GroupVersion: "invalid/group/version"}},
+	}}
+	discovery.AddReactor("*", "*", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("discovery unavailable")
+	})
+
+	nodes.EXPECT().List(gomock.Any()).Return(&corev1.NodeList{Items: []corev1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+		}},
+	}}}, nil)
+	leases.EXPECT().Get("cattle-fleet-system", LeaderElectionID, gomock.Any()).Return(nil, errors.New("lease unavailable"))
+
+	var patched fleet.Cluster
+	clusters.EXPECT().Patch("fleet-default", "local", types.MergePatchType, gomock.Any(), "status").
+		DoAndReturn(func(_, _ string, _ types.PatchType, data []byte, _ ...string) (*fleet.Cluster, error) {
+			return nil, json.Unmarshal(data, &patched)
+		})
+
+	h := handler{
+		agentNamespace:   "cattle-fleet-system",
+		clusterNamespace: "fleet-default",
+		clusterName:      "local",
+		nodes:            nodes,
+		leases:           leases,
+		clusters:         clusters,
+		discovery:        discovery,
+		logger:           logr.Discard(),
+		reported: fleet.AgentStatus{
+			KubernetesVersion: "v1.28.3+k3s1",
+			APIResources:      []string{"v1/ConfigMap"},
+			Leader:            "fleet-agent-0",
+		},
+	}
+	if err := h.Update(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	agent := patched.Status.Agent
+	if agent.LastSeen.IsZero() {
+		t.Error("expected lastSeen to be patched")
+	}
+	if agent.ReadyNodes != 1 {
+		t.Errorf("expected 1 ready node, got %d", agent.ReadyNodes)
+	}
+	if agent.KubernetesVersion != "v1.28.3+k3s1" || agent.Leader != "fleet-agent-0" || len(agent.APIResources) != 1 {
+		t.Errorf("expected the last reported facts to be kept, got %+v", agent)
+	}
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/rancher/fleet/internal/cmd/agent/deployer/driftdetect"
 	"github.com/rancher/fleet/internal/cmd/agent/deployer/monitor"
 	fleetv1 "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	"github.com/rancher/fleet/pkg/durations"
 
 	"github.com/rancher/wrangler/v2/pkg/condition"
 
@@ -18,16 +20,19 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	errutil "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // BundleDeploymentReconciler reconciles a BundleDeployment object, by
-// deploying the bundle as a helm release.
+// deploying the bundle as a helm release or with server-side apply.
 type BundleDeploymentReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
@@ -44,6 +49,10 @@ type BundleDeploymentReconciler struct {
 
 	// AgentInfo is the labelSuffix used by the helm deployer
 	AgentScope string
+
+	// Recorder emits events for the bundledeployments on the upstream
+	// cluster, e.g. about drift.
+	Recorder record.EventRecorder
 }
 
 var DefaultRetry = wait.Backoff{
@@ -56,6 +65,7 @@ var DefaultRetry = wait.Backoff{
 //+kubebuilder:rbac:groups=fleet.cattle.io,resources=bundledeployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=fleet.cattle.io,resources=bundledeployments/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=fleet.cattle.io,resources=bundledeployments/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -94,6 +104,7 @@ func (r *BundleDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	}
 
 	merr := []error{}
+	var result ctrl.Result
 
 	// helm deploy the bundledeployment
 	status, err := r.Deployer.DeployBundle(ctx, bd)
@@ -103,26 +114,50 @@ func (r *BundleDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		// do not use the returned status, instead set the condition and possibly a timestamp
 		bd.Status = setCondition(bd.Status, err, condition.Cond(fleetv1.BundleDeploymentConditionDeployed))
 
-		merr = append(merr, fmt.Errorf("failed deploying bundle: %w", err))
+		// list the dependencies we are waiting for
+		bd.Status.UnreadyDependencies = nil
+		var depErr *deployer.DependenciesNotReadyError
+		if errors.As(err, &depErr) {
+			bd.Status.UnreadyDependencies = depErr.Unready
+		}
+
+		// report the preDeploy hooks blocking the deployment
+		var hookErr *deployer.HookError
+		if errors.As(err, &hookErr) {
+			hookErr.SetCondition(&bd.Status)
+		}
+
+		if hookErr != nil && hookErr.Waiting() {
+			// jobs are not watched, check the preDeploy hooks again later
+			// instead of backing off
+			result.RequeueAfter = durations.HookJobPollInterval
+		} else {
+			merr = append(merr, fmt.Errorf("failed deploying bundle: %w", err))
+		}
 	} else {
 		bd.Status = setCondition(status, nil, condition.Cond(fleetv1.BundleDeploymentConditionDeployed))
 	}
 
 	// if we can't retrieve the resources, we don't need to try any of the other operations and requeue now
-	resources, err := r.Deployer.Resources(bd.Name, bd.Status.Release)
+	resources, err := r.Deployer.Resources(ctx, bd)
 	if err != nil {
 		logger.V(1).Info("Failed to retrieve bundledeployment's resources")
 		if statusErr := r.updateStatus(ctx, req.NamespacedName, bd.Status); statusErr != nil {
 			merr = append(merr, err)
 			merr = append(merr, fmt.Errorf("failed to update the status: %w", statusErr))
 		}
-		return ctrl.Result{}, errutil.NewAggregate(merr)
+		return result, errutil.NewAggregate(merr)
 	}
 
-	var result ctrl.Result
+	if condition.Cond(fleetv1.BundleDeploymentConditionPostDeployHooks).IsUnknown(bd) ||
+		condition.Cond(fleetv1.BundleDeploymentConditionVerified).IsUnknown(bd) {
+		// jobs are not watched, check the postDeploy hooks and the verification job again later
+		result.RequeueAfter = durations.HookJobPollInterval
+	}
 	if monitor.ShouldUpdateStatus(bd) {
 		// update the bundledeployment status and check if we deploy an agent, or if we need to trigger drift correction
 		status, err = r.Monitor.UpdateStatus(ctx, bd, resources)
+		monitored := err == nil
 		if err != nil {
 			logger.Error(err, "Cannot monitor deployed bundle")
 
@@ -135,12 +170,19 @@ func (r *BundleDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		}
 
 		// Run drift correction
+		strategy := ""
+		var correctionErr error
 		if len(status.ModifiedStatus) > 0 && bd.Spec.CorrectDrift != nil && bd.Spec.CorrectDrift.Enabled {
-			err = r.Deployer.RemoveExternalChanges(ctx, bd)
-			if err != nil {
-				merr = append(merr, fmt.Errorf("failed reconciling drift: %w", err))
+			strategy = r.Deployer.DriftCorrectionStrategy(bd)
+			correctionErr = r.Deployer.RemoveExternalChanges(ctx, bd, status.ModifiedStatus, resources)
+			if correctionErr != nil {
+				merr = append(merr, fmt.Errorf("failed reconciling drift: %w", correctionErr))
 			}
 		}
+		// without a complete status, incidents cannot be resolved
+		if monitored {
+			r.recordDrift(ctx, bd, status.ModifiedStatus, strategy, correctionErr)
+		}
 
 		if len(bd.Status.ModifiedStatus) > 0 && monitor.ShouldRedeployAgent(bd) {
 			bd.Status.AppliedDeploymentID = ""
@@ -174,6 +216,8 @@ func (r *BundleDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	return result, errutil.NewAggregate(merr)
 }
 
+// updateStatus updates the status of the bundledeployment. The pending state
+// is owned by the Fleet controller and kept as is.
 func (r *BundleDeploymentReconciler) updateStatus(ctx context.Context, req types.NamespacedName, status fleetv1.BundleDeploymentStatus) error {
 	return retry.RetryOnConflict(DefaultRetry, func() error {
 		newBD := &fleetv1.BundleDeployment{}
@@ -181,6 +225,7 @@ func (r *BundleDeploymentReconciler) updateStatus(ctx context.Context, req types
 		if err != nil {
 			return err
 		}
+		status.Pending = newBD.Status.Pending
 		newBD.Status = status
 		return r.Status().Update(ctx, newBD)
 	})
@@ -211,6 +256,9 @@ func (r *BundleDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 					},
 				},
 			)).
+		// drift detection requeues bundledeployments locally, while the
+		// upstream cluster is unreachable
+		WatchesRawSource(&source.Channel{Source: r.DriftDetect.LocalEvents()}, &handler.EnqueueRequestForObject{}).
 		Complete(r)
 }
 
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	fleetv1 "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestUpdateStatusKeepsPending(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	require.NoError(t, fleetv1.AddToScheme(scheme))
+
+	pending := &fleetv1.PendingStatus{Reason: "MaintenanceWindow", Message: "waiting for the next maintenance window"}
+	bd := &fleetv1.BundleDeployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-ns", Name: "app"},
+		Status:     fleetv1.BundleDeploymentStatus{Pending: pending},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(bd).WithStatusSubresource(bd).Build()
+	r := &BundleDeploymentReconciler{Client: c}
+
+	// the agent's copy of the status was read before the hold was set
+	status := fleetv1.BundleDeploymentStatus{AppliedDeploymentID: "s-1", Ready: true}
+	require.NoError(t, r.updateStatus(ctx, client.ObjectKeyFromObject(bd), status))
+
+	result := &fleetv1.BundleDeployment{}
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(bd), result))
+	assert.Equal(t, pending, result.Status.Pending)
+	assert.Equal(t, "s-1", result.Status.AppliedDeploymentID)
+	assert.True(t, result.Status.Ready)
+}
@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	fleetv1 "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+// maxDriftHistory is the number of drift incidents kept in the status
+const maxDriftHistory = 20
+
+// recordDrift adds the modifications, which are not recorded yet, to the
+// drift history of the bundledeployment and records the result of the drift
+// correction, if there was one. Open incidents, whose modification is no
+// longer detected, are resolved. A correction is only confirmed by the next
+// monitor pass, which no longer detects the modification. Every new
+// incident, failed correction and resolution is also emitted as an event.
+func (r *BundleDeploymentReconciler) recordDrift(ctx context.Context, bd *fleetv1.BundleDeployment, modified []fleetv1.ModifiedStatus, strategy string, correctionErr error) {
+	now := metav1.Now()
+	history := append([]fleetv1.DriftIncident{}, bd.Status.DriftHistory...)
+	for _, i := range resolveDriftIncidents(history, modified, now) {
+		if history[i].Corrected {
+			r.event(bd, corev1.EventTypeNormal, "DriftCorrected", fmt.Sprintf("%s corrected with %s", history[i].ModifiedStatus.String(), history[i].CorrectionStrategy))
+		} else {
+			r.event(bd, corev1.EventTypeNormal, "DriftResolved", fmt.Sprintf("%s is no longer modified", history[i].ModifiedStatus.String()))
+		}
+	}
+
+	history, added := addDriftIncidents(history, modified, now)
+	for _, i := range added {
+		history[i].FieldManagers = r.fieldManagers(ctx, history[i].ModifiedStatus)
+		r.event(bd, corev1.EventTypeWarning, "DriftDetected", describeDrift(history[i]))
+	}
+
+	if strategy != "" {
+		for _, i := range correctDriftIncidents(history, modified, strategy, correctionErr) {
+			r.event(bd, corev1.EventTypeWarning, "DriftCorrectionFailed", fmt.Sprintf("%s: %s", history[i].ModifiedStatus.String(), history[i].CorrectionError))
+		}
+	}
+
+	if len(history) > maxDriftHistory {
+		history = history[len(history)-maxDriftHistory:]
+	}
+	bd.Status.DriftHistory = history
+}
+
+func (r *BundleDeploymentReconciler) event(bd *fleetv1.BundleDeployment, eventType, reason, message string) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Event(bd, eventType, reason, message)
+}
+
+// fieldManagers returns the field managers of the modified resource's
+// drifted fields. Errors are logged, as the managers are informational.
+func (r *BundleDeploymentReconciler) fieldManagers(ctx context.Context, m fleetv1.ModifiedStatus) []string {
+	if m.Create {
+		return nil
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(m.APIVersion)
+	obj.SetKind(m.Kind)
+	if err := r.LocalClient.Get(ctx, types.NamespacedName{Namespace: m.Namespace, Name: m.Name}, obj); err != nil {
+		log.FromContext(ctx).V(1).Info("Cannot look up field managers of drifted resource", "resource", m.String(), "error", err)
+		return nil
+	}
+
+	managers, err := driftFieldManagers(obj.GetManagedFields(), m)
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("Cannot look up field managers of drifted resource", "resource", m.String(), "error", err)
+	}
+	return managers
+}
+
+// addDriftIncidents appends the modifications, which are not an open
+// incident in the history yet, and returns the indexes of the new incidents
+// (pure function)
+func addDriftIncidents(history []fleetv1.DriftIncident, modified []fleetv1.ModifiedStatus, now metav1.Time) ([]fleetv1.DriftIncident, []int) {
+	history = append([]fleetv1.DriftIncident{}, history...)
+	var added []int
+	for _, m := range modified {
+		if openDriftIncident(history, m) >= 0 {
+			continue
+		}
+		added = append(added, len(history))
+		history = append(history, fleetv1.DriftIncident{
+			ModifiedStatus: m,
+			DetectedAt:     now,
+		})
+	}
+	return history, added
+}
+
+// correctDriftIncidents records the result of the drift correction in the
+// open incidents of the modifications. Incidents stay open until the
+// modification is no longer detected. It returns the indexes of the
+// incidents, whose correction failed with a new error (pure function)
+func correctDriftIncidents(history []fleetv1.DriftIncident, modified []fleetv1.ModifiedStatus, strategy string, correctionErr error) []int {
+	var failed []int
+	for _, m := range modified {
+		i := openDriftIncident(history, m)
+		if i < 0 {
+			continue
+		}
+		correctionError := ""
+		if correctionErr != nil {
+			correctionError = correctionErr.Error()
+		}
+		if correctionError == history[i].CorrectionError && strategy == history[i].CorrectionStrategy {
+			// same result as before
+			continue
+		}
+		history[i].CorrectionStrategy = strategy
+		history[i].CorrectionError = correctionError
+		if correctionErr != nil {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+// resolveDriftIncidents resolves the open incidents, whose modification is
+// no longer detected. An incident is corrected, if drift correction was
+// applied without error. It returns the indexes of the resolved incidents
+// (pure function)
+func resolveDriftIncidents(history []fleetv1.DriftIncident, modified []fleetv1.ModifiedStatus, now metav1.Time) []int {
+	detected := map[fleetv1.ModifiedStatus]bool{}
+	for _, m := range modified {
+		detected[m] = true
+	}
+
+	var resolved []int
+	for i := range history {
+		if !isOpenDriftIncident(history[i]) || detected[history[i].ModifiedStatus] {
+			continue
+		}
+		history[i].ResolvedAt = now.DeepCopy()
+		history[i].Corrected = history[i].CorrectionStrategy != "" && history[i].CorrectionError == ""
+		resolved = append(resolved, i)
+	}
+	return resolved
+}
+
+// openDriftIncident returns the index of the latest incident for the same
+// modification, which was not resolved, or -1 (pure function)
+func openDriftIncident(history []fleetv1.DriftIncident, m fleetv1.ModifiedStatus) int {
+	for i := len(history) - 1; i >= 0; i-- {
+		h := history[i].ModifiedStatus
+		if h.APIVersion != m.APIVersion || h.Kind != m.Kind || h.Namespace != m.Namespace || h.Name != m.Name {
+			continue
+		}
+		if !isOpenDriftIncident(history[i]) || h != m {
+			return -1
+		}
+		return i
+	}
+	return -1
+}
+
+func isOpenDriftIncident(incident fleetv1.DriftIncident) bool {
+	return incident.ResolvedAt == nil && !incident.Corrected
+}
+
+// driftFieldManagers returns the sorted names of the field managers, which
+// own fields changed by the modification's merge patch. For extra
+// resources, all field managers are returned (pure function)
+func driftFieldManagers(managedFields []metav1.ManagedFieldsEntry, m fleetv1.ModifiedStatus) ([]string, error) {
+	var paths []fieldpath.Path
+	if !m.Delete {
+		if m.Patch == "" {
+			return nil, nil
+		}
+		var patch map[string]interface{}
+		if err := json.Unmarshal([]byte(m.Patch), &patch); err != nil {
+			return nil, err
+		}
+		paths = patchPaths(nil, patch)
+	}
+
+	seen := map[string]bool{}
+	var managers []string
+	for _, entry := range managedFields {
+		if entry.Manager == "" || seen[entry.Manager] {
+			continue
+		}
+		owns := m.Delete
+		if !owns && entry.FieldsV1 != nil {
+			set := &fieldpath.Set{}
+			if err := set.FromJSON(bytes.NewReader(entry.FieldsV1.Raw)); err != nil {
+				return nil, err
+			}
+			owns = ownsAny(set, paths)
+		}
+		if owns {
+			seen[entry.Manager] = true
+			managers = append(managers, entry.Manager)
+		}
+	}
+	sort.Strings(managers)
+	return managers, nil
+}
+
+// patchPaths returns the paths of the values a merge patch sets or removes.
+// Lists are replaced as a whole.
+func patchPaths(prefix fieldpath.Path, patch map[string]interface{}) []fieldpath.Path {
+	var paths []fieldpath.Path
+	for k, v := range patch {
+		name := k
+		path := append(prefix.Copy(), fieldpath.PathElement{FieldName: &name})
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			paths = append(paths, patchPaths(path, nested)...)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// ownsAny returns true if the set contains one of the paths or a field below
+// one of them
+func ownsAny(set *fieldpath.Set, paths []fieldpath.Path) bool {
+	owns := false
+	set.Iterate(func(p fieldpath.Path) {
+		for _, path := range paths {
+			if hasPrefix(p, path) {
+				owns = true
+			}
+		}
+	})
+	return owns
+}
+
+func hasPrefix(p, prefix fieldpath.Path) bool {
+	if len(p) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if !p[i].Equals(prefix[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeDrift returns the message of the event for a new drift incident
+func describeDrift(incident fleetv1.DriftIncident) string {
+	msg := incident.ModifiedStatus.String()
+	if len(incident.FieldManagers) > 0 {
+		msg += " (field managers: " + strings.Join(incident.FieldManagers, ", ") + ")"
+	}
+	return msg
+}
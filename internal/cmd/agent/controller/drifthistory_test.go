@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	fleetv1 "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDriftHistory(t *testing.T) {
+	now := metav1.Now()
+	replicas := fleetv1.ModifiedStatus{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "app", Name: "web", Patch: `{"spec":{"replicas":2}}`}
+	missing := fleetv1.ModifiedStatus{APIVersion: "v1", Kind: "ConfigMap", Namespace: "app", Name: "config", Create: true}
+
+	history, added := addDriftIncidents(nil, []fleetv1.ModifiedStatus{replicas, missing}, now)
+	assert.Equal(t, []int{0, 1}, added)
+	assert.Len(t, history, 2)
+
+	// the drift is still there, it is not recorded again
+	history, added = addDriftIncidents(history, []fleetv1.ModifiedStatus{replicas}, now)
+	assert.Empty(t, added)
+	assert.Len(t, history, 2)
+
+	failed := correctDriftIncidents(history, []fleetv1.ModifiedStatus{replicas, missing}, fleetv1.DriftCorrectionStrategyPatch, errors.New("forbidden"))
+	assert.Equal(t, []int{0, 1}, failed)
+	assert.False(t, history[0].Corrected)
+	assert.Equal(t, "forbidden", history[0].CorrectionError)
+
+	// the same failure is not reported again
+	failed = correctDriftIncidents(history, []fleetv1.ModifiedStatus{replicas}, fleetv1.DriftCorrectionStrategyPatch, errors.New("forbidden"))
+	assert.Empty(t, failed)
+
+	// a successful correction is not confirmed, until the drift is gone
+	failed = correctDriftIncidents(history, []fleetv1.ModifiedStatus{replicas}, fleetv1.DriftCorrectionStrategyPatch, nil)
+	assert.Empty(t, failed)
+	assert.False(t, history[0].Corrected)
+	assert.Empty(t, history[0].CorrectionError)
+	assert.Empty(t, resolveDriftIncidents(history, []fleetv1.ModifiedStatus{replicas, missing}, now))
+
+	// the next monitor pass no longer detects the drift: the corrected
+	// incident and the one, whose modification went away, are resolved
+	resolved := resolveDriftIncidents(history, nil, now)
+	assert.Equal(t, []int{0, 1}, resolved)
+	assert.True(t, history[0].Corrected)
+	assert.NotNil(t, history[0].ResolvedAt)
+	assert.False(t, history[1].Corrected, "expected the failed correction not to be confirmed")
+	assert.NotNil(t, history[1].ResolvedAt)
+
+	// the drift came back after it was corrected
+	history, added = addDriftIncidents(history, []fleetv1.ModifiedStatus{replicas}, now)
+	assert.Equal(t, []int{2}, added)
+
+	// a different modification of the same object is a new incident and
+	// resolves the previous one
+	replicas.Patch = `{"spec":{"replicas":3}}`
+	assert.Equal(t, []int{2}, resolveDriftIncidents(history, []fleetv1.ModifiedStatus{replicas}, now))
+	_, added = addDriftIncidents(history, []fleetv1.ModifiedStatus{replicas}, now)
+	assert.Equal(t, []int{3}, added)
+}
+
+func TestDriftFieldManagers(t *testing.T) {
+	managedFields := []metav1.ManagedFieldsEntry{
+		{Manager: "helm", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:app":{}}},"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"web\"}":{"f:image":{}}}}}}}`)}},
+		{Manager: "kubectl-edit", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{}}}`)}},
+		{Manager: "kube-controller-manager", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:status":{"f:replicas":{}}}`)}},
+	}
+
+	managers, err := driftFieldManagers(managedFields, fleetv1.ModifiedStatus{Patch: `{"spec":{"replicas":2}}`})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kubectl-edit"}, managers)
+
+	// lists are replaced as a whole by merge patches
+	managers, err = driftFieldManagers(managedFields, fleetv1.ModifiedStatus{Patch: `{"spec":{"replicas":2,"template":{"spec":{"containers":[]}}}}`})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"helm", "kubectl-edit"}, managers)
+
+	managers, err = driftFieldManagers(managedFields, fleetv1.ModifiedStatus{Delete: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"helm", "kube-controller-manager", "kubectl-edit"}, managers)
+
+	_, err = driftFieldManagers(managedFields, fleetv1.ModifiedStatus{Patch: `not json`})
+	assert.Error(t, err)
+}
@@ -9,12 +9,14 @@ import (
 	"github.com/rancher/fleet/internal/cmd/agent/deployer/internal/diffnormalize"
 	"github.com/rancher/fleet/internal/cmd/agent/deployer/internal/resource"
 	fleetnorm "github.com/rancher/fleet/internal/cmd/agent/deployer/normalizers"
+	"github.com/rancher/fleet/internal/config"
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 
 	"github.com/rancher/wrangler/v2/pkg/apply"
 	"github.com/rancher/wrangler/v2/pkg/merr"
 	"github.com/rancher/wrangler/v2/pkg/objectset"
 
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -22,12 +24,15 @@ import (
 
 // Diff factors the bundledeployment's bundle diff patches into the plan from
 // DryRun. This way, the status of the bundledeployment can be updated
-// accurately.
-func Diff(plan apply.Plan, bd *fleet.BundleDeployment, ns string, objs ...runtime.Object) (apply.Plan, error) {
+// accurately. The drift ignore rules of the agent config are applied to all
+// bundledeployments, a nil config only applies the default rules. Unless the
+// default rules are disabled, the replicas of resources scaled by one of the
+// HorizontalPodAutoscalers on the cluster are ignored, too.
+func Diff(plan apply.Plan, bd *fleet.BundleDeployment, agentConfig *config.Config, hpas []autoscalingv2.HorizontalPodAutoscaler, ns string, objs ...runtime.Object) (apply.Plan, error) {
 	desired := objectset.NewObjectSet(objs...).ObjectsByGVK()
 	live := objectset.NewObjectSet(plan.Objects...).ObjectsByGVK()
 
-	norms, err := normalizers(live, bd)
+	norms, err := normalizers(live, bd, agentConfig, hpas)
 	if err != nil {
 		return plan, err
 	}
@@ -67,7 +72,7 @@ func Diff(plan apply.Plan, bd *fleet.BundleDeployment, ns string, objs ...runtim
 				delete(plan.Update[gvk], key)
 				continue
 			}
-			patch, err := jsonpatch.CreateMergePatch(diffResult.NormalizedLive, diffResult.PredictedLive)
+			patch, err := mergePatch(actualObj.(*unstructured.Unstructured).Object, diffResult.NormalizedLive, diffResult.PredictedLive)
 			if err != nil {
 				errs = append(errs, err)
 				continue
@@ -81,7 +86,73 @@ func Diff(plan apply.Plan, bd *fleet.BundleDeployment, ns string, objs ...runtim
 	return plan, nil
 }
 
-func normalizers(live objectset.ObjectByGVK, bd *fleet.BundleDeployment) (diff.Normalizer, error) {
+// mergePatch returns the merge patch from the normalized live object to the
+// predicted one. The fields, which the normalizers removed from the live
+// object, are restored on both sides first. A merge patch replaces lists as a
+// whole and would drop the ignored fields of their items otherwise.
+func mergePatch(live map[string]interface{}, normalizedLive, predictedLive []byte) ([]byte, error) {
+	var normalized, from, to map[string]interface{}
+	if err := json.Unmarshal(normalizedLive, &normalized); err != nil {
+		return nil, err
+	}
+	// restoring modifies the object, so it needs its own copy
+	if err := json.Unmarshal(normalizedLive, &from); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(predictedLive, &to); err != nil {
+		return nil, err
+	}
+
+	fromData, err := json.Marshal(restoreIgnored(from, live, normalized))
+	if err != nil {
+		return nil, err
+	}
+	toData, err := json.Marshal(restoreIgnored(to, live, normalized))
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.CreateMergePatch(fromData, toData)
+}
+
+// restoreIgnored copies the fields of live, which are missing from
+// normalized, into obj. List items are matched by their index, if the
+// normalizers did not remove any items.
+func restoreIgnored(obj, live, normalized interface{}) interface{} {
+	switch live := live.(type) {
+	case map[string]interface{}:
+		objMap, ok := obj.(map[string]interface{})
+		if !ok {
+			return obj
+		}
+		normalizedMap, _ := normalized.(map[string]interface{})
+		for k, liveValue := range live {
+			normalizedValue, ok := normalizedMap[k]
+			if !ok {
+				if _, ok := objMap[k]; !ok {
+					objMap[k] = liveValue
+				}
+				continue
+			}
+			if objValue, ok := objMap[k]; ok {
+				objMap[k] = restoreIgnored(objValue, liveValue, normalizedValue)
+			}
+		}
+		return objMap
+	case []interface{}:
+		objList, ok := obj.([]interface{})
+		normalizedList, _ := normalized.([]interface{})
+		if !ok || len(normalizedList) != len(live) {
+			return obj
+		}
+		for i := 0; i < len(objList) && i < len(live); i++ {
+			objList[i] = restoreIgnored(objList[i], live[i], normalizedList[i])
+		}
+		return objList
+	}
+	return obj
+}
+
+func normalizers(live objectset.ObjectByGVK, bd *fleet.BundleDeployment, agentConfig *config.Config, hpas []autoscalingv2.HorizontalPodAutoscaler) (diff.Normalizer, error) {
 	var ignore []resource.ResourceIgnoreDifferences
 	jsonPatchNorm := &fleetnorm.JSONPatchNormalizer{}
 	if bd.Spec.Options.Diff != nil {
@@ -119,6 +190,16 @@ func normalizers(live objectset.ObjectByGVK, bd *fleet.BundleDeployment) (diff.N
 		return nil, err
 	}
 
-	norm := fleetnorm.New(live, ignoreNorm, jsonPatchNorm)
+	driftIgnoreNorm, err := fleetnorm.NewDriftIgnoreNormalizer(fleetnorm.DriftIgnoreRules(agentConfig))
+	if err != nil {
+		return nil, err
+	}
+
+	additions := []diff.Normalizer{ignoreNorm, jsonPatchNorm, driftIgnoreNorm}
+	if agentConfig == nil || !agentConfig.DisableDefaultDriftIgnore {
+		additions = append(additions, &fleetnorm.HPAReplicasNormalizer{Live: live, HPAs: hpas})
+	}
+
+	norm := fleetnorm.New(live, additions...)
 	return norm, nil
 }
@@ -31,6 +31,7 @@ type Cleanup struct {
 	fleetNamespace   string
 	defaultNamespace string
 	helmDeployer     *helmdeployer.Helm
+	manifests        ManifestCache
 	cleanupOnce      sync.Once
 
 	mapper meta.RESTMapper
@@ -38,12 +39,20 @@ type Cleanup struct {
 	localDynamicClient *dynamic.DynamicClient
 }
 
-func New(upstream client.Client, mapper meta.RESTMapper, localDynamicClient *dynamic.DynamicClient, deployer *helmdeployer.Helm, fleetNamespace string, defaultNamespace string) *Cleanup {
+// ManifestCache caches the manifests of bundledeployments on the local cluster
+type ManifestCache interface {
+	Prune(ctx context.Context, inUse map[string]bool) error
+}
+
+// New returns the cleanup. If manifests is not nil, cached manifests, which
+// are no longer used by a bundledeployment, are garbage collected.
+func New(upstream client.Client, mapper meta.RESTMapper, localDynamicClient *dynamic.DynamicClient, deployer *helmdeployer.Helm, manifests ManifestCache, fleetNamespace string, defaultNamespace string) *Cleanup {
 	return &Cleanup{
 		client:             upstream,
 		mapper:             mapper,
 		localDynamicClient: localDynamicClient,
 		helmDeployer:       deployer,
+		manifests:          manifests,
 		fleetNamespace:     fleetNamespace,
 		defaultNamespace:   defaultNamespace,
 	}
@@ -89,6 +98,9 @@ func (c *Cleanup) garbageCollect(ctx context.Context) {
 		if err := c.cleanup(ctx, logger); err != nil {
 			logger.Error(err, "failed to cleanup orphaned releases")
 		}
+		if err := c.pruneManifests(ctx); err != nil {
+			logger.Error(err, "failed to prune cached manifests")
+		}
 		select {
 		case <-ctx.Done():
 			return
@@ -128,9 +140,73 @@ func (c *Cleanup) cleanup(ctx context.Context, logger logr.Logger) error {
 		}
 	}
 
+	return c.cleanupInventories(ctx, logger)
+}
+
+// cleanupInventories deletes the inventories of bundledeployments, which
+// were deployed with server-side apply and no longer exist, together with
+// their objects. Inventories of bundledeployments, which switched back to
+// helm, are deleted, but their objects are kept for the helm release.
+func (c *Cleanup) cleanupInventories(ctx context.Context, logger logr.Logger) error {
+	deployed, err := c.helmDeployer.ListInventories(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, deployed := range deployed {
+		bundleDeployment := &fleet.BundleDeployment{}
+		err := c.client.Get(ctx, types.NamespacedName{Namespace: c.fleetNamespace, Name: deployed.BundleID}, bundleDeployment)
+		if apierror.IsNotFound(err) {
+			logger.Info("Deleting orphan bundle ID, deleting applied objects", "bundleID", deployed.BundleID)
+			if err := c.helmDeployer.DeleteInventory(ctx, deployed.BundleID); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if bundleDeployment.Spec.Options.DeployMode != fleet.DeployModeServerSideApply &&
+			bundleDeployment.Spec.DeploymentID == bundleDeployment.Status.AppliedDeploymentID {
+			logger.Info("Bundle ID is deployed with helm, deleting inventory", "bundleID", deployed.BundleID)
+			if err := c.helmDeployer.ForgetInventory(ctx, deployed.BundleID); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
+// pruneManifests deletes the cached manifests, which are not referenced by
+// a bundledeployment. Manifests of previous deployments are kept, so the
+// agent can roll back while the upstream cluster is unreachable.
+func (c *Cleanup) pruneManifests(ctx context.Context) error {
+	if c.manifests == nil {
+		return nil
+	}
+
+	bds := &fleet.BundleDeploymentList{}
+	if err := c.client.List(ctx, bds, client.InNamespace(c.fleetNamespace)); err != nil {
+		return err
+	}
+
+	inUse := map[string]bool{}
+	for _, bd := range bds.Items {
+		for _, deploymentID := range []string{
+			bd.Spec.DeploymentID,
+			bd.Spec.StagedDeploymentID,
+			bd.Spec.KnownGoodDeploymentID,
+			bd.Status.AppliedDeploymentID,
+		} {
+			if manifestID, _ := kv.Split(deploymentID, ":"); manifestID != "" {
+				inUse[manifestID] = true
+			}
+		}
+	}
+	return c.manifests.Prune(ctx, inUse)
+}
+
 func (c *Cleanup) delete(ctx context.Context, bundleDeploymentKey string) error {
 	_, name := kv.RSplit(bundleDeploymentKey, "/")
 	return c.helmDeployer.Delete(ctx, name)
@@ -0,0 +1,95 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// DependenciesNotReadyError is returned while the agent waits for the
+// dependencies of a bundledeployment
+type DependenciesNotReadyError struct {
+	// Unready describes the dependencies, which are not ready
+	Unready []string
+}
+
+func (e *DependenciesNotReadyError) Error() string {
+	return "dependencies are not ready: " + strings.Join(e.Unready, ", ")
+}
+
+// checkResource returns why the referenced resource on the local cluster is
+// not ready, or an empty string if it is.
+func (d *Deployer) checkResource(ctx context.Context, ref *fleet.ResourceRef) (string, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(ref.APIVersion)
+	obj.SetKind(ref.Kind)
+	err := d.client.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, obj)
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return "not found", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return resourceReady(ref, obj)
+}
+
+// resourceReady returns why the resource does not satisfy the reference's
+// condition and JSONPath expression, or an empty string if it does (pure
+// function)
+func resourceReady(ref *fleet.ResourceRef, obj *unstructured.Unstructured) (string, error) {
+	if ref.Condition != "" {
+		conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		ready := false
+		for _, c := range conditions {
+			cond, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if cond["type"] == ref.Condition && cond["status"] == "True" {
+				ready = true
+				break
+			}
+		}
+		if !ready {
+			return fmt.Sprintf("condition %s is not true", ref.Condition), nil
+		}
+	}
+
+	if ref.JSONPath != "" {
+		jp := jsonpath.New("dependency")
+		jp.AllowMissingKeys(true)
+		if err := jp.Parse(ref.JSONPath); err != nil {
+			return "", fmt.Errorf("invalid jsonPath %q in dependency on %s: %w", ref.JSONPath, describeResource(ref), err)
+		}
+		var buf bytes.Buffer
+		if err := jp.Execute(&buf, obj.Object); err != nil {
+			return "", fmt.Errorf("failed to evaluate jsonPath %q in dependency on %s: %w", ref.JSONPath, describeResource(ref), err)
+		}
+		result := buf.String()
+		if ref.Value == "" && result == "" {
+			return fmt.Sprintf("%s is empty", ref.JSONPath), nil
+		}
+		if ref.Value != "" && result != ref.Value {
+			return fmt.Sprintf("%s is %q, expected %q", ref.JSONPath, result, ref.Value), nil
+		}
+	}
+
+	return "", nil
+}
+
+// describeResource returns a human readable name of the referenced resource
+func describeResource(ref *fleet.ResourceRef) string {
+	if ref.Namespace == "" {
+		return ref.Kind + " " + ref.Name
+	}
+	return ref.Kind + " " + ref.Namespace + "/" + ref.Name
+}
@@ -40,16 +40,42 @@ func New(localClient client.Client, upstreamClient client.Reader, lookup Lookup,
 	}
 }
 
-func (d *Deployer) Resources(name string, release string) (*helmdeployer.Resources, error) {
-	return d.helm.Resources(name, release)
+// Resources returns the resources of the bundledeployment's release, or of
+// its inventory when deployed with server-side apply.
+func (d *Deployer) Resources(ctx context.Context, bd *fleet.BundleDeployment) (*helmdeployer.Resources, error) {
+	if bd.Spec.Options.DeployMode == fleet.DeployModeServerSideApply {
+		return d.helm.AppliedResources(ctx, bd.Name, bd.Status.Release)
+	}
+	return d.helm.Resources(bd.Name, bd.Status.Release)
+}
+
+// DriftCorrectionStrategy returns the strategy RemoveExternalChanges uses to
+// correct drift of the bundledeployment's resources
+func (d *Deployer) DriftCorrectionStrategy(bd *fleet.BundleDeployment) string {
+	if bd.Spec.CorrectDrift != nil && bd.Spec.CorrectDrift.Strategy == fleet.DriftCorrectionStrategyPatch {
+		return fleet.DriftCorrectionStrategyPatch
+	}
+	if bd.Spec.Options.DeployMode == fleet.DeployModeServerSideApply {
+		return fleet.DeployModeServerSideApply
+	}
+	return fleet.DriftCorrectionStrategyRollback
 }
 
-func (d *Deployer) RemoveExternalChanges(ctx context.Context, bd *fleet.BundleDeployment) error {
+// RemoveExternalChanges corrects the drift of the deployed resources with the
+// bundledeployment's drift correction strategy.
+func (d *Deployer) RemoveExternalChanges(ctx context.Context, bd *fleet.BundleDeployment, modified []fleet.ModifiedStatus, resources *helmdeployer.Resources) error {
+	if bd.Spec.CorrectDrift != nil && bd.Spec.CorrectDrift.Strategy == fleet.DriftCorrectionStrategyPatch {
+		return d.helm.PatchDrift(ctx, bd, modified, resources)
+	}
+	if bd.Spec.Options.DeployMode == fleet.DeployModeServerSideApply {
+		return d.helm.Reapply(ctx, bd)
+	}
 	return d.helm.RemoveExternalChanges(ctx, bd)
 }
 
-// DeployBundle deploys the bundle deployment with the helm SDK. It does not
-// mutate bd, instead it returns the modified status
+// DeployBundle deploys the bundle deployment with the helm SDK or with
+// server-side apply. It does not mutate bd, instead it returns the modified
+// status
 func (d *Deployer) DeployBundle(ctx context.Context, bd *fleet.BundleDeployment) (fleet.BundleDeploymentStatus, error) {
 	status := bd.Status
 	logger := log.FromContext(ctx).WithName("DeployBundle").WithValues("deploymentID", bd.Spec.DeploymentID, "appliedDeploymentID", status.AppliedDeploymentID)
@@ -58,6 +84,15 @@ func (d *Deployer) DeployBundle(ctx context.Context, bd *fleet.BundleDeployment)
 		logger.V(1).Info("Bundle has a dependency that is not ready", "error", err)
 		return status, err
 	}
+	status.UnreadyDependencies = nil
+
+	newDeployment := bd.Spec.DeploymentID != status.AppliedDeploymentID
+	if newDeployment {
+		if err := d.runHooks(ctx, bd, &status, helmdeployer.HookPreDeploy); err != nil {
+			logger.V(1).Info("Bundle is waiting for preDeploy hooks", "error", err)
+			return status, err
+		}
+	}
 
 	logger.Info("Checking if bundle needs to be deployed")
 	release, err := d.helmdeploy(ctx, bd)
@@ -88,6 +123,14 @@ func (d *Deployer) DeployBundle(ctx context.Context, bd *fleet.BundleDeployment)
 		return fleet.BundleDeploymentStatus{}, err
 	}
 
+	if err := d.runHooks(ctx, bd, &status, helmdeployer.HookPostDeploy); err != nil {
+		return status, err
+	}
+
+	if err := d.verify(ctx, bd, &status); err != nil {
+		return status, err
+	}
+
 	// Setting the error to nil clears any existing error
 	condition.Cond(fleet.BundleDeploymentConditionInstalled).SetError(&status, "", nil)
 	return status, nil
@@ -96,8 +139,15 @@ func (d *Deployer) DeployBundle(ctx context.Context, bd *fleet.BundleDeployment)
 // Deploy the bundle deployment, i.e. with helmdeployer.
 // This loads the manifest and the contents from the upstream cluster.
 func (d *Deployer) helmdeploy(ctx context.Context, bd *fleet.BundleDeployment) (string, error) {
+	serverSideApply := bd.Spec.Options.DeployMode == fleet.DeployModeServerSideApply
 	if bd.Spec.DeploymentID == bd.Status.AppliedDeploymentID {
-		if ok, err := d.helm.EnsureInstalled(bd.Name, bd.Status.Release); err != nil {
+		ensure := d.helm.EnsureInstalled
+		if serverSideApply {
+			ensure = func(bundleID, resourcesID string) (bool, error) {
+				return d.helm.EnsureApplied(ctx, bundleID, resourcesID)
+			}
+		}
+		if ok, err := ensure(bd.Name, bd.Status.Release); err != nil {
 			return "", err
 		} else if ok {
 			return bd.Status.Release, nil
@@ -109,8 +159,19 @@ func (d *Deployer) helmdeploy(ctx context.Context, bd *fleet.BundleDeployment) (
 		return "", err
 	}
 
-	manifest.Commit = bd.Labels["fleet.cattle.io/commit"]
-	resource, err := d.helm.Deploy(ctx, bd.Name, manifest, bd.Spec.Options)
+	manifest.Commit = bd.Labels[fleet.CommitLabel]
+
+	// the cluster owner's policy restricts the objects of the bundle
+	policy, err := d.helm.Policy(ctx, bd)
+	if err != nil {
+		return "", err
+	}
+
+	deploy := d.helm.Deploy
+	if serverSideApply {
+		deploy = d.helm.ServerSideApply
+	}
+	resource, err := deploy(ctx, bd.Name, manifest, bd.Spec.Options, policy)
 	if err != nil {
 		return "", err
 	}
@@ -215,7 +276,8 @@ func deployErrToStatus(err error, status fleet.BundleDeploymentStatus) (bool, fl
 	msg := err.Error()
 
 	// The following error conditions are turned into a status
-	// Note: these error strings are returned by the Helm SDK and its dependencies
+	// Note: these error strings are returned by the Helm SDK, the Kubernetes
+	// API server and their dependencies
 	re := regexp.MustCompile(
 		"(timed out waiting for the condition)|" + // a Helm wait occurs and it times out
 			"(error validating data)|" + // manifests fail to pass validation
@@ -225,7 +287,8 @@ func deployErrToStatus(err error, status fleet.BundleDeploymentStatus) (bool, fl
 			"(YAML parse error)|" + // YAML is broken in source files
 			"(Forbidden: updates to [0-9A-Za-z]+ spec for fields other than [0-9A-Za-z ']+ are forbidden)|" + // trying to update fields that cannot be updated
 			"(Forbidden: spec is immutable after creation)|" + // trying to modify immutable spec
-			"(chart requires kubeVersion: [0-9A-Za-z\\.\\-<>=]+ which is incompatible with Kubernetes)", // trying to deploy to incompatible Kubernetes
+			"(chart requires kubeVersion: [0-9A-Za-z\\.\\-<>=]+ which is incompatible with Kubernetes)|" + // trying to deploy to incompatible Kubernetes
+			"(Apply failed with [0-9]+ conflicts?)", // server-side apply conflicts with another field manager
 	)
 	if re.MatchString(msg) {
 		status.Ready = false
@@ -263,10 +326,27 @@ func deployErrToStatus(err error, status fleet.BundleDeploymentStatus) (bool, fl
 	return false, status
 }
 
+// checkDependency returns a DependenciesNotReadyError, if any of the bundles
+// or resources in dependsOn is not ready.
 func (d *Deployer) checkDependency(ctx context.Context, bd *fleet.BundleDeployment) error {
-	var depBundleList []string
+	var unready []string
 	bundleNamespace := bd.Labels[fleet.BundleNamespaceLabel]
 	for _, depend := range bd.Spec.DependsOn {
+		if depend.Resource != nil {
+			reason, err := d.checkResource(ctx, depend.Resource)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				unready = append(unready, describeResource(depend.Resource)+": "+reason)
+			}
+		}
+
+		// dependencies on other clusters are checked by the controller
+		if depend.ClusterName != "" || depend.ClusterSelector != nil {
+			continue
+		}
+
 		// skip empty BundleRef definitions. Possible if there is a typo in the yaml
 		if depend.Name != "" || depend.Selector != nil {
 			ls := &metav1.LabelSelector{}
@@ -300,14 +380,14 @@ func (d *Deployer) checkDependency(ctx context.Context, bd *fleet.BundleDeployme
 				if c.IsTrue(depBundle) {
 					continue
 				} else {
-					depBundleList = append(depBundleList, depBundle.Name)
+					unready = append(unready, "bundle "+depBundle.Name)
 				}
 			}
 		}
 	}
 
-	if len(depBundleList) != 0 {
-		return fmt.Errorf("dependent bundle(s) are not ready: %v", depBundleList)
+	if len(unready) != 0 {
+		return &DependenciesNotReadyError{Unready: unready}
 	}
 
 	return nil
@@ -5,10 +5,14 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/rancher/fleet/internal/helmdeployer"
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 
+	"github.com/rancher/wrangler/v2/pkg/condition"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -147,3 +151,214 @@ func TestSetNamespaceLabelsAndAnnotationsError(t *testing.T) {
 		t.Errorf("expected error %v: got %v", expectedErr, err)
 	}
 }
+
+func TestResourceReady(t *testing.T) {
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "foos.example.com"},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "NamesAccepted", "status": "True"},
+				map[string]interface{}{"type": "Established", "status": "False"},
+			},
+		},
+	}}
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "operator", "namespace": "system"},
+		"status":     map[string]interface{}{"readyReplicas": int64(2)},
+	}}
+
+	tests := map[string]struct {
+		ref      fleet.ResourceRef
+		obj      *unstructured.Unstructured
+		expected string
+	}{
+		"exists": {
+			ref: fleet.ResourceRef{Kind: "CustomResourceDefinition", Name: "foos.example.com"},
+			obj: crd,
+		},
+		"condition true": {
+			ref: fleet.ResourceRef{Kind: "CustomResourceDefinition", Name: "foos.example.com", Condition: "NamesAccepted"},
+			obj: crd,
+		},
+		"condition false": {
+			ref:      fleet.ResourceRef{Kind: "CustomResourceDefinition", Name: "foos.example.com", Condition: "Established"},
+			obj:      crd,
+			expected: "condition Established is not true",
+		},
+		"json path value": {
+			ref: fleet.ResourceRef{Kind: "Deployment", Name: "operator", Namespace: "system", JSONPath: "{.status.readyReplicas}", Value: "2"},
+			obj: deployment,
+		},
+		"json path unexpected value": {
+			ref:      fleet.ResourceRef{Kind: "Deployment", Name: "operator", Namespace: "system", JSONPath: "{.status.readyReplicas}", Value: "3"},
+			obj:      deployment,
+			expected: `{.status.readyReplicas} is "2", expected "3"`,
+		},
+		"json path missing": {
+			ref:      fleet.ResourceRef{Kind: "Deployment", Name: "operator", Namespace: "system", JSONPath: "{.status.availableReplicas}"},
+			obj:      deployment,
+			expected: "{.status.availableReplicas} is empty",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			reason, err := resourceReady(&test.ref, test.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reason != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, reason)
+			}
+		})
+	}
+}
+
+func TestSetHookCondition(t *testing.T) {
+	status := &fleet.BundleDeploymentStatus{}
+	cond := condition.Cond(fleet.BundleDeploymentConditionPostDeployHooks)
+
+	setHookCondition(status, helmdeployer.HookPostDeploy, helmdeployer.HookResult{Pending: []string{"job app/smoke"}})
+	if !cond.IsUnknown(status) || cond.GetMessage(status) != "postDeploy hooks waiting for job app/smoke" {
+		t.Errorf("unexpected condition for pending hooks: %+v", status.Conditions)
+	}
+
+	setHookCondition(status, helmdeployer.HookPostDeploy, helmdeployer.HookResult{Failed: []string{"job app/smoke: failed"}})
+	if !cond.IsFalse(status) || cond.GetMessage(status) != "postDeploy hooks failed: job app/smoke: failed" {
+		t.Errorf("unexpected condition for failed hooks: %+v", status.Conditions)
+	}
+
+	setHookCondition(status, helmdeployer.HookPostDeploy, helmdeployer.HookResult{})
+	if !cond.IsTrue(status) || cond.GetMessage(status) != "" {
+		t.Errorf("unexpected condition for completed hooks: %+v", status.Conditions)
+	}
+
+	removeCondition(status, fleet.BundleDeploymentConditionPostDeployHooks)
+	if len(status.Conditions) != 0 {
+		t.Errorf("condition was not removed: %+v", status.Conditions)
+	}
+}
+
+func TestRunHooksOnce(t *testing.T) {
+	d := &Deployer{}
+	cond := condition.Cond(fleet.BundleDeploymentConditionPreDeployHooks)
+	bd := &fleet.BundleDeployment{Spec: fleet.BundleDeploymentSpec{
+		DeploymentID: "s-1:abc",
+		Options: fleet.BundleDeploymentOptions{Hooks: &fleet.DeploymentHooks{
+			PreDeploy: []fleet.DeploymentHook{{Path: "migrate.yaml"}},
+		}},
+	}}
+
+	// jobs which finished for the deployment are not started again
+	bd.Status.HookDeploymentIDs = map[string]string{helmdeployer.HookPreDeploy: "s-1:abc"}
+	setHookCondition(&bd.Status, helmdeployer.HookPreDeploy, helmdeployer.HookResult{})
+	status := bd.Status
+	if err := d.runHooks(context.TODO(), bd, &status, helmdeployer.HookPreDeploy); err != nil {
+		t.Fatal(err)
+	}
+
+	setHookCondition(&status, helmdeployer.HookPreDeploy, helmdeployer.HookResult{Failed: []string{"job app/migrate: failed"}})
+	var hookErr *HookError
+	err := d.runHooks(context.TODO(), bd, &status, helmdeployer.HookPreDeploy)
+	if !errors.As(err, &hookErr) || hookErr.Waiting() || err.Error() != cond.GetMessage(&status) {
+		t.Errorf("expected the recorded failure, got %v", err)
+	}
+
+	// the bundledeployment's map is not modified
+	recordHooks(&status, helmdeployer.HookPostDeploy, "s-1:abc", helmdeployer.HookResult{})
+	if len(bd.Status.HookDeploymentIDs) != 1 || len(status.HookDeploymentIDs) != 2 {
+		t.Errorf("unexpected deployment IDs: %v, %v", bd.Status.HookDeploymentIDs, status.HookDeploymentIDs)
+	}
+	recordHooks(&status, helmdeployer.HookVerify, "s-1:abc", helmdeployer.HookResult{Pending: []string{"job app/verify"}})
+	if _, ok := status.HookDeploymentIDs[helmdeployer.HookVerify]; ok {
+		t.Errorf("pending jobs were recorded: %v", status.HookDeploymentIDs)
+	}
+}
+
+func TestPostDeployHooksWaitForResources(t *testing.T) {
+	d := &Deployer{}
+	cond := condition.Cond(fleet.BundleDeploymentConditionPostDeployHooks)
+	bd := &fleet.BundleDeployment{Spec: fleet.BundleDeploymentSpec{
+		DeploymentID: "s-1:abc",
+		Options: fleet.BundleDeploymentOptions{Hooks: &fleet.DeploymentHooks{
+			PostDeploy: []fleet.DeploymentHook{{Path: "smoke.yaml"}},
+		}},
+	}}
+
+	// the resources of the deployment were not monitored yet
+	status := bd.Status
+	if err := d.runHooks(context.TODO(), bd, &status, helmdeployer.HookPostDeploy); err != nil {
+		t.Fatal(err)
+	}
+	if !cond.IsUnknown(&status) || cond.GetMessage(&status) != "postDeploy hooks waiting for resources to be ready" {
+		t.Errorf("expected hooks to wait for the resources: %+v", status.Conditions)
+	}
+	if status.HookDeploymentIDs != nil {
+		t.Errorf("waiting hooks were recorded: %v", status.HookDeploymentIDs)
+	}
+
+	// the monitor found resources, which are not ready
+	bd.Status.AppliedDeploymentID = "s-1:abc"
+	condition.Cond(fleet.BundleDeploymentConditionMonitored).SetError(&bd.Status, "", nil)
+	bd.Status.NonReadyStatus = []fleet.NonReadyStatus{{Kind: "Deployment", Name: "web"}}
+	if resourcesReady(bd) {
+		t.Error("expected resources not to be ready")
+	}
+
+	bd.Status.NonReadyStatus = nil
+	if !resourcesReady(bd) {
+		t.Error("expected resources to be ready")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	d := &Deployer{}
+	cond := condition.Cond(fleet.BundleDeploymentConditionVerified)
+	bd := &fleet.BundleDeployment{Spec: fleet.BundleDeploymentSpec{DeploymentID: "s-1:abc", Options: fleet.BundleDeploymentOptions{
+		DeployMode: fleet.DeployModeServerSideApply,
+		Verify:     &fleet.VerifyOptions{HelmTest: true, Job: &fleet.DeploymentHook{Path: "verify.yaml"}},
+	}}}
+
+	// the resources of the deployment were not monitored yet
+	status := &fleet.BundleDeploymentStatus{}
+	if err := d.verify(context.TODO(), bd, status); err != nil {
+		t.Fatal(err)
+	}
+	if !cond.IsUnknown(status) || cond.GetMessage(status) != "verification waiting for resources to be ready" {
+		t.Errorf("expected verification to wait for the resources: %+v", status.Conditions)
+	}
+
+	bd.Status.AppliedDeploymentID = "s-1:abc"
+	condition.Cond(fleet.BundleDeploymentConditionMonitored).SetError(&bd.Status, "", nil)
+	status = &fleet.BundleDeploymentStatus{}
+	if err := d.verify(context.TODO(), bd, status); err != nil {
+		t.Fatal(err)
+	}
+	if !cond.IsFalse(status) || cond.GetReason(status) != reasonHelmTestFailed {
+		t.Errorf("expected failed helm tests: %+v", status.Conditions)
+	}
+
+	// the checks do not run again for the deployment
+	if err := d.verify(context.TODO(), bd, status); err != nil {
+		t.Fatal(err)
+	}
+	if !cond.IsFalse(status) {
+		t.Errorf("expected failed helm tests: %+v", status.Conditions)
+	}
+
+	if status.HookDeploymentIDs[helmdeployer.HookVerify] != "s-1:abc" {
+		t.Errorf("expected the deployment to be recorded: %v", status.HookDeploymentIDs)
+	}
+
+	bd.Spec.Options.Verify = nil
+	if err := d.verify(context.TODO(), bd, status); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Conditions) != 0 || status.HookDeploymentIDs != nil {
+		t.Errorf("condition was not removed: %+v", status)
+	}
+}
@@ -14,8 +14,13 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
+// localEventsBuffer is the number of bundledeployments, which can wait to be
+// requeued locally
+const localEventsBuffer = 100
+
 type DriftDetect struct {
 	// Trigger watches deployed resources on the local cluster.
 	trigger *trigger.Trigger
@@ -23,6 +28,10 @@ type DriftDetect struct {
 	upstreamClient client.Client
 	upstreamReader client.Reader
 
+	// localEvents requeues bundledeployments, if the upstream cluster is
+	// unreachable
+	localEvents chan event.GenericEvent
+
 	applied          *applied.Applied
 	defaultNamespace string
 	labelPrefix      string
@@ -42,6 +51,7 @@ func New(
 		trigger:          trigger,
 		upstreamClient:   upstreamClient,
 		upstreamReader:   upstreamReader,
+		localEvents:      make(chan event.GenericEvent, localEventsBuffer),
 		applied:          applied,
 		defaultNamespace: defaultNamespace,
 		labelPrefix:      labelPrefix,
@@ -49,6 +59,13 @@ func New(
 	}
 }
 
+// LocalEvents returns the events of bundledeployments, which need to be
+// reconciled, because their resources drifted while the upstream cluster
+// was unreachable
+func (d *DriftDetect) LocalEvents() <-chan event.GenericEvent {
+	return d.localEvents
+}
+
 func (d *DriftDetect) Clear(bdKey string) error {
 	return d.trigger.Clear(bdKey)
 }
@@ -78,7 +95,8 @@ func (d *DriftDetect) Refresh(logger logr.Logger, bdKey string, bd *fleet.Bundle
 			return d.requeueBD(logger, handleID, bd.Namespace, bd.Name)
 		})
 		if err != nil {
-			logger.Error(err, "Failed to trigger bundledeployment", "error", err)
+			logger.Error(err, "Failed to trigger bundledeployment upstream, requeueing it locally", "error", err)
+			d.requeueLocally(logger, bd)
 			return
 		}
 
@@ -95,8 +113,7 @@ func (d *DriftDetect) requeueBD(logger logr.Logger, handleID int, namespace stri
 		return nil
 	}
 	if err != nil {
-		logger.Error(err, "Failed to get bundledeployment, can't trigger refresh")
-		return nil
+		return err
 	}
 
 	logger = logger.WithValues("resourceVersion", bd.ResourceVersion)
@@ -120,6 +137,18 @@ func (d *DriftDetect) requeueBD(logger logr.Logger, handleID int, namespace stri
 	return err
 }
 
+// requeueLocally enqueues the bundledeployment without the upstream cluster,
+// so drift is corrected while the upstream cluster is unreachable. The
+// event is dropped if the buffer is full, as the bundledeployment's
+// resources trigger again on their next change.
+func (d *DriftDetect) requeueLocally(logger logr.Logger, bd *fleet.BundleDeployment) {
+	select {
+	case d.localEvents <- event.GenericEvent{Object: bd}:
+	default:
+		logger.Info("Too many bundledeployments waiting to be requeued locally, dropping event")
+	}
+}
+
 // allResources returns the resources that are deployed by the bundle deployment,
 // according to the helm release history. It adds to be deleted resources to
 // the list, by comparing the desired state to the actual state with apply.
@@ -0,0 +1,193 @@
+package deployer
+
+import (
+	"context"
+	"maps"
+	"strings"
+
+	"github.com/rancher/fleet/internal/helmdeployer"
+	"github.com/rancher/fleet/internal/manifest"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/condition"
+	"github.com/rancher/wrangler/v2/pkg/kv"
+)
+
+// HookError is returned while the preDeploy hooks of a bundledeployment
+// block its deployment, because their jobs did not complete or failed
+type HookError struct {
+	Phase        string
+	DeploymentID string
+	Result       helmdeployer.HookResult
+	// Message is the message of the hook condition, if the jobs already
+	// failed for the deployment and were not started again
+	Message string
+}
+
+func (e *HookError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	var msgs []string
+	if len(e.Result.Failed) > 0 {
+		msgs = append(msgs, "failed: "+strings.Join(e.Result.Failed, ", "))
+	}
+	if len(e.Result.Pending) > 0 {
+		msgs = append(msgs, "waiting for "+strings.Join(e.Result.Pending, ", "))
+	}
+	name := e.Phase + " hooks"
+	if e.Phase == helmdeployer.HookVerify {
+		name = "verification job"
+	}
+	return name + " " + strings.Join(msgs, "; ")
+}
+
+// Waiting returns true if the jobs of the hook phase are still running
+func (e *HookError) Waiting() bool {
+	return e.Message == "" && len(e.Result.Failed) == 0 && len(e.Result.Pending) > 0
+}
+
+// SetCondition sets the condition of the hook phase on the status and
+// records the deployment ID, once the jobs finished. The status is left as
+// is, if the jobs were not started again.
+func (e *HookError) SetCondition(status *fleet.BundleDeploymentStatus) {
+	if e.Message != "" {
+		return
+	}
+	setHookCondition(status, e.Phase, e.Result)
+	recordHooks(status, e.Phase, e.DeploymentID, e.Result)
+}
+
+// runHooks runs the hooks of the phase and records their state in the
+// status. Jobs, which finished for the current deployment, are not started
+// again. For preDeploy hooks, which did not complete, a HookError is returned.
+// PostDeploy hooks wait for the deployed resources to be ready.
+func (d *Deployer) runHooks(ctx context.Context, bd *fleet.BundleDeployment, status *fleet.BundleDeploymentStatus, phase string) error {
+	var hooks []fleet.DeploymentHook
+	if bd.Spec.Options.Hooks != nil {
+		if phase == helmdeployer.HookPreDeploy {
+			hooks = bd.Spec.Options.Hooks.PreDeploy
+		} else {
+			hooks = bd.Spec.Options.Hooks.PostDeploy
+		}
+	}
+	if len(hooks) == 0 {
+		removeCondition(status, hookCondition(phase))
+		recordHooks(status, phase, "", helmdeployer.HookResult{})
+		return nil
+	}
+
+	if status.HookDeploymentIDs[phase] == bd.Spec.DeploymentID {
+		cond := condition.Cond(hookCondition(phase))
+		if phase == helmdeployer.HookPreDeploy && cond.IsFalse(status) {
+			return &HookError{Phase: phase, DeploymentID: bd.Spec.DeploymentID, Message: cond.GetMessage(status)}
+		}
+		return nil
+	}
+
+	if phase == helmdeployer.HookPostDeploy && !resourcesReady(bd) {
+		waitForResources(status, hookCondition(phase), "postDeploy hooks")
+		return nil
+	}
+
+	result, err := d.helm.RunHooks(ctx, bd, phase, hooks, d.manifestLoader(bd))
+	if err != nil {
+		return err
+	}
+
+	setHookCondition(status, phase, result)
+	recordHooks(status, phase, bd.Spec.DeploymentID, result)
+	if phase == helmdeployer.HookPreDeploy && !result.Completed() {
+		return &HookError{Phase: phase, DeploymentID: bd.Spec.DeploymentID, Result: result}
+	}
+	return nil
+}
+
+// resourcesReady returns true if the monitor found the resources of the
+// current deployment ready. The monitor checks the resources after they were
+// deployed, so for a new deployment this is known on the next reconcile. The
+// Ready condition cannot be used, as it is false until the postDeploy hooks
+// and the verification passed (pure function).
+func resourcesReady(bd *fleet.BundleDeployment) bool {
+	return bd.Status.AppliedDeploymentID == bd.Spec.DeploymentID &&
+		condition.Cond(fleet.BundleDeploymentConditionMonitored).IsTrue(bd) &&
+		len(bd.Status.NonReadyStatus) == 0
+}
+
+// waitForResources sets the condition to unknown, while the jobs wait for the
+// resources to become ready. The controller checks again later (pure
+// function).
+func waitForResources(status *fleet.BundleDeploymentStatus, name, jobs string) {
+	cond := condition.Cond(name)
+	cond.Unknown(status)
+	cond.Reason(status, "")
+	cond.Message(status, jobs+" waiting for resources to be ready")
+}
+
+// recordHooks records the deployment ID for the hook phase, once its jobs
+// completed or failed. An empty deployment ID removes the phase. The map is
+// copied, as the status shares it with the bundledeployment (pure function).
+func recordHooks(status *fleet.BundleDeploymentStatus, phase, deploymentID string, result helmdeployer.HookResult) {
+	if len(result.Pending) > 0 {
+		return
+	}
+	ids := maps.Clone(status.HookDeploymentIDs)
+	if ids == nil {
+		ids = map[string]string{}
+	}
+	if deploymentID == "" {
+		delete(ids, phase)
+	} else {
+		ids[phase] = deploymentID
+	}
+	if len(ids) == 0 {
+		ids = nil
+	}
+	status.HookDeploymentIDs = ids
+}
+
+// manifestLoader returns a function, which loads the manifest of the
+// bundledeployment's current deployment
+func (d *Deployer) manifestLoader(bd *fleet.BundleDeployment) func(context.Context) (*manifest.Manifest, error) {
+	return func(ctx context.Context) (*manifest.Manifest, error) {
+		manifestID, _ := kv.Split(bd.Spec.DeploymentID, ":")
+		return d.lookup.Get(ctx, d.upstreamClient, manifestID)
+	}
+}
+
+// setHookCondition sets the condition of the hook phase to true if all jobs
+// completed, to false if one failed and to unknown otherwise (pure function)
+func setHookCondition(status *fleet.BundleDeploymentStatus, phase string, result helmdeployer.HookResult) {
+	cond := condition.Cond(hookCondition(phase))
+	hookErr := &HookError{Phase: phase, Result: result}
+	switch {
+	case len(result.Failed) > 0:
+		cond.SetError(status, "", hookErr)
+	case len(result.Pending) > 0:
+		cond.Unknown(status)
+		cond.Reason(status, "")
+		cond.Message(status, hookErr.Error())
+	default:
+		cond.SetError(status, "", nil)
+	}
+}
+
+func hookCondition(phase string) string {
+	switch phase {
+	case helmdeployer.HookPreDeploy:
+		return fleet.BundleDeploymentConditionPreDeployHooks
+	case helmdeployer.HookVerify:
+		return fleet.BundleDeploymentConditionVerified
+	default:
+		return fleet.BundleDeploymentConditionPostDeployHooks
+	}
+}
+
+func removeCondition(status *fleet.BundleDeploymentStatus, name string) {
+	for i, c := range status.Conditions {
+		if c.Type == name {
+			status.Conditions = append(status.Conditions[:i:i], status.Conditions[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/summary"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// healthCheckCostLimit limits the runtime cost of a health check's CEL
+	// expression, see https://github.com/google/cel-spec/blob/master/doc/langdef.md#evaluation
+	healthCheckCostLimit = 1000000
+	// maxCachedHealthChecks limits the number of compiled expressions,
+	// which are cached
+	maxCachedHealthChecks = 1000
+)
+
+var (
+	healthCheckEnvOnce sync.Once
+	healthCheckEnv     *cel.Env
+	healthCheckEnvErr  error
+
+	// healthCheckCache holds the compiled programs by expression, as the
+	// checks are compiled on each status update
+	healthCheckCache   = map[string]compiledHealthCheck{}
+	healthCheckCacheMu sync.Mutex
+)
+
+type compiledHealthCheck struct {
+	program cel.Program
+	err     error
+}
+
+// healthChecks evaluate the health checks of a bundledeployment and of the
+// agent config
+type healthChecks struct {
+	checks []healthCheck
+}
+
+type healthCheck struct {
+	fleet.HealthCheck
+	program cel.Program
+	// err is set if the expression does not compile
+	err error
+}
+
+// newHealthChecks compiles the health checks. The checks of the bundle take
+// precedence over the global checks. Expressions, which do not compile,
+// mark the matching resources as degraded.
+func newHealthChecks(bundle, global []fleet.HealthCheck) *healthChecks {
+	h := &healthChecks{}
+	if len(bundle)+len(global) == 0 {
+		return h
+	}
+
+	for _, check := range append(append([]fleet.HealthCheck{}, bundle...), global...) {
+		c := healthCheck{HealthCheck: check}
+		c.program, c.err = compileHealthCheck(check.Expression)
+		h.checks = append(h.checks, c)
+	}
+	return h
+}
+
+// ValidHealthChecks returns the health checks, whose expressions compile,
+// and an error for the others
+func ValidHealthChecks(checks []fleet.HealthCheck) ([]fleet.HealthCheck, error) {
+	var (
+		valid []fleet.HealthCheck
+		errs  []error
+	)
+	for _, check := range checks {
+		if _, err := compileHealthCheck(check.Expression); err != nil {
+			errs = append(errs, fmt.Errorf("health check for %s %s: %w", check.Group, check.Kind, err))
+			continue
+		}
+		valid = append(valid, check)
+	}
+	return valid, errors.Join(errs...)
+}
+
+// compileHealthCheck returns the program of the expression from the cache,
+// or compiles it
+func compileHealthCheck(expression string) (cel.Program, error) {
+	healthCheckCacheMu.Lock()
+	defer healthCheckCacheMu.Unlock()
+	if c, ok := healthCheckCache[expression]; ok {
+		return c.program, c.err
+	}
+
+	program, err := compile(expression)
+	if len(healthCheckCache) >= maxCachedHealthChecks {
+		clear(healthCheckCache)
+	}
+	healthCheckCache[expression] = compiledHealthCheck{program: program, err: err}
+	return program, err
+}
+
+func compile(expression string) (cel.Program, error) {
+	healthCheckEnvOnce.Do(func() {
+		healthCheckEnv, healthCheckEnvErr = cel.NewEnv(cel.Variable("object", cel.DynType))
+	})
+	if healthCheckEnvErr != nil {
+		return nil, healthCheckEnvErr
+	}
+	ast, issues := healthCheckEnv.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	return healthCheckEnv.Program(ast, cel.CostLimit(healthCheckCostLimit))
+}
+
+// summarize returns the summary of the resource computed by the first
+// matching health check, or false if no health check matches
+func (h *healthChecks) summarize(obj *unstructured.Unstructured) (summary.Summary, bool) {
+	gvk := obj.GroupVersionKind()
+	for _, check := range h.checks {
+		if check.Group != gvk.Group || check.Kind != gvk.Kind || (check.Version != "" && check.Version != gvk.Version) {
+			continue
+		}
+		if check.err != nil {
+			return healthSummary(fleet.HealthCheckDegraded, fmt.Sprintf("invalid health check: %v", check.err)), true
+		}
+		status, message, err := evalHealthCheck(check.program, obj)
+		if err != nil {
+			return healthSummary(fleet.HealthCheckDegraded, fmt.Sprintf("health check failed: %v", err)), true
+		}
+		return healthSummary(status, message), true
+	}
+	return summary.Summary{}, false
+}
+
+// evalHealthCheck returns the status and message the health check's
+// expression returns for the resource
+func evalHealthCheck(program cel.Program, obj *unstructured.Unstructured) (string, string, error) {
+	out, _, err := program.Eval(map[string]interface{}{"object": obj.Object})
+	if err != nil {
+		return "", "", err
+	}
+
+	if s, ok := out.(types.String); ok {
+		return string(s), "", nil
+	}
+
+	native, err := out.ConvertToNative(reflect.TypeOf(map[string]interface{}{}))
+	if err != nil {
+		return "", "", fmt.Errorf("expected a string or a map, found %s", out.Type().TypeName())
+	}
+	result := native.(map[string]interface{})
+	status, ok := result["status"].(string)
+	if !ok {
+		return "", "", fmt.Errorf("expected a string as status, found %v", result["status"])
+	}
+	message, _ := result["message"].(string)
+	return status, message, nil
+}
+
+// healthSummary converts the health into a summary, which is ready for
+// healthy resources (pure function)
+func healthSummary(status, message string) summary.Summary {
+	var s summary.Summary
+	switch status {
+	case fleet.HealthCheckHealthy:
+		s.State = "active"
+	case fleet.HealthCheckProgressing:
+		s.State = "in-progress"
+		s.Transitioning = true
+	case fleet.HealthCheckDegraded:
+		s.State = "error"
+		s.Error = true
+	default:
+		s.State = "error"
+		s.Error = true
+		message = fmt.Sprintf("health check returned unknown status %q", status)
+	}
+	if message != "" {
+		s.Message = []string{message}
+	}
+	return s
+}
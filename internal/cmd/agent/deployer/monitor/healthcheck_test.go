@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestHealthChecks(t *testing.T) {
+	database := func(phase string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "example.com/v1",
+			"kind":       "Database",
+			"metadata":   map[string]interface{}{"name": "db"},
+			"status":     map[string]interface{}{"phase": phase, "message": "replica 2 lagging"},
+		}}
+	}
+	expression := `object.status.phase == "Running" ? "healthy" : object.status.phase == "Failed" ? dyn({"status": "degraded", "message": object.status.message}) : "progressing"`
+
+	checks := newHealthChecks(nil, []fleet.HealthCheck{{Group: "example.com", Kind: "Database", Expression: expression}})
+
+	s, ok := checks.summarize(database("Running"))
+	assert.True(t, ok)
+	assert.True(t, s.IsReady())
+
+	s, ok = checks.summarize(database("Creating"))
+	assert.True(t, ok)
+	assert.False(t, s.IsReady())
+	assert.True(t, s.Transitioning)
+
+	s, ok = checks.summarize(database("Failed"))
+	assert.True(t, ok)
+	assert.True(t, s.Error)
+	assert.Equal(t, []string{"replica 2 lagging"}, s.Message)
+
+	_, ok = checks.summarize(&unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}})
+	assert.False(t, ok)
+
+	// bundle checks take precedence over global checks
+	checks = newHealthChecks([]fleet.HealthCheck{{Group: "example.com", Version: "v1", Kind: "Database", Expression: `"healthy"`}},
+		[]fleet.HealthCheck{{Group: "example.com", Kind: "Database", Expression: `"degraded"`}})
+	s, ok = checks.summarize(database("Failed"))
+	assert.True(t, ok)
+	assert.True(t, s.IsReady())
+
+	checks = newHealthChecks([]fleet.HealthCheck{{Group: "example.com", Kind: "Database", Expression: `object.status.phase ==`}}, nil)
+	s, ok = checks.summarize(database("Running"))
+	assert.True(t, ok)
+	assert.True(t, s.Error)
+	assert.Contains(t, s.Message[0], "invalid health check")
+
+	checks = newHealthChecks([]fleet.HealthCheck{{Group: "example.com", Kind: "Database", Expression: `"broken"`}}, nil)
+	s, _ = checks.summarize(database("Running"))
+	assert.True(t, s.Error)
+	assert.Equal(t, []string{`health check returned unknown status "broken"`}, s.Message)
+}
+
+func TestValidHealthChecks(t *testing.T) {
+	checks := []fleet.HealthCheck{
+		{Group: "example.com", Kind: "Database", Expression: `"healthy"`},
+		{Group: "example.com", Kind: "Queue", Expression: `object.status.phase ==`},
+	}
+	valid, err := ValidHealthChecks(checks)
+	assert.Error(t, err)
+	assert.Equal(t, checks[:1], valid)
+
+	// compiled programs are cached by expression
+	first, err := compileHealthCheck(`"healthy"`)
+	assert.NoError(t, err)
+	second, err := compileHealthCheck(`"healthy"`)
+	assert.NoError(t, err)
+	assert.True(t, first == second)
+}
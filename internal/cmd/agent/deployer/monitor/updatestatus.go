@@ -9,6 +9,7 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/rancher/fleet/internal/cmd/agent/deployer/applied"
+	"github.com/rancher/fleet/internal/config"
 	"github.com/rancher/fleet/internal/helmdeployer"
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 
@@ -17,14 +18,17 @@ import (
 	"github.com/rancher/wrangler/v2/pkg/objectset"
 	"github.com/rancher/wrangler/v2/pkg/summary"
 
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 type Monitor struct {
+	client  client.Reader
 	applied *applied.Applied
 	mapper  meta.RESTMapper
 
@@ -33,16 +37,24 @@ type Monitor struct {
 	defaultNamespace string
 	labelPrefix      string
 	labelSuffix      string
+
+	agentConfig AgentConfigLookup
 }
 
-func New(applied *applied.Applied, mapper meta.RESTMapper, deployer *helmdeployer.Helm, defaultNamespace string, labelSuffix string) *Monitor {
+// AgentConfigLookup returns the current agent config, which contains the
+// drift ignore rules.
+type AgentConfigLookup func(ctx context.Context) (*config.Config, error)
+
+func New(client client.Reader, applied *applied.Applied, mapper meta.RESTMapper, deployer *helmdeployer.Helm, defaultNamespace string, labelSuffix string, agentConfig AgentConfigLookup) *Monitor {
 	return &Monitor{
+		client:           client,
 		applied:          applied,
 		mapper:           mapper,
 		deployer:         deployer,
 		defaultNamespace: defaultNamespace,
 		labelPrefix:      defaultNamespace,
 		labelSuffix:      labelSuffix,
+		agentConfig:      agentConfig,
 	}
 }
 
@@ -83,7 +95,7 @@ func (m *Monitor) UpdateStatus(ctx context.Context, bd *fleet.BundleDeployment,
 	// updateFromResources mutates bd.Status, so copy it first
 	origStatus := *bd.Status.DeepCopy()
 	bd = bd.DeepCopy()
-	err := m.updateFromResources(logger, bd, resources)
+	err := m.updateFromResources(ctx, logger, bd, resources)
 	if err != nil {
 
 		// Returning an error will cause UpdateStatus to requeue in a loop.
@@ -97,6 +109,9 @@ func (m *Monitor) UpdateStatus(ctx context.Context, bd *fleet.BundleDeployment,
 		return origStatus, err
 	}
 	status := bd.Status
+	if checksMessage(status) != "" {
+		status.Ready = false
+	}
 
 	readyError := readyError(status)
 	condition.Cond(fleet.BundleDeploymentConditionReady).SetError(&status, "", readyError)
@@ -119,6 +134,22 @@ func removePrivateFields(s1 *fleet.BundleDeploymentStatus) {
 	}
 }
 
+// checksMessage returns the message of the PostDeployHooks or Verified
+// condition, while the postDeploy hooks or the verification did not pass
+func checksMessage(status fleet.BundleDeploymentStatus) string {
+	for _, name := range []string{fleet.BundleDeploymentConditionPostDeployHooks, fleet.BundleDeploymentConditionVerified} {
+		cond := condition.Cond(name)
+		if !cond.IsFalse(&status) && !cond.IsUnknown(&status) {
+			continue
+		}
+		if msg := cond.GetMessage(&status); msg != "" {
+			return msg
+		}
+		return name + " is not true"
+	}
+	return ""
+}
+
 // readyError returns an error based on the provided status.
 // That error is non-nil if the status corresponds to a non-ready or modified state of the bundle deployment.
 func readyError(status fleet.BundleDeploymentStatus) error {
@@ -131,6 +162,8 @@ func readyError(status fleet.BundleDeploymentStatus) error {
 		msg = "not ready"
 		if len(status.NonReadyStatus) > 0 {
 			msg = status.NonReadyStatus[0].String()
+		} else if checks := checksMessage(status); checks != "" {
+			msg = checks
 		}
 	} else if !status.NonModified {
 		msg = "out of sync"
@@ -142,10 +175,49 @@ func readyError(status fleet.BundleDeploymentStatus) error {
 	return errors.New(msg)
 }
 
+// horizontalPodAutoscalers returns the HorizontalPodAutoscalers in the
+// namespaces of the objects. They might not be part of the bundle, but still
+// scale its resources.
+func (m *Monitor) horizontalPodAutoscalers(ctx context.Context, defaultNamespace string, objs []runtime.Object) ([]autoscalingv2.HorizontalPodAutoscaler, error) {
+	if m.client == nil {
+		return nil, nil
+	}
+	namespaces := map[string]bool{}
+	for _, obj := range objs {
+		ma, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		ns := ma.GetNamespace()
+		if ns == "" {
+			ns = defaultNamespace
+		}
+		namespaces[ns] = true
+	}
+
+	var result []autoscalingv2.HorizontalPodAutoscaler
+	for ns := range namespaces {
+		hpas := &autoscalingv2.HorizontalPodAutoscalerList{}
+		if err := m.client.List(ctx, hpas, client.InNamespace(ns)); err != nil {
+			return nil, err
+		}
+		result = append(result, hpas.Items...)
+	}
+	return result, nil
+}
+
 // updateFromResources updates the status with information from the
-// helm release history and an apply dry run.
-func (m *Monitor) updateFromResources(logger logr.Logger, bd *fleet.BundleDeployment, resources *helmdeployer.Resources) error {
-	resourcesPreviousRelease, err := m.deployer.ResourcesFromPreviousReleaseVersion(bd.Name, bd.Status.Release)
+// helm release history, or the inventory, and an apply dry run.
+func (m *Monitor) updateFromResources(ctx context.Context, logger logr.Logger, bd *fleet.BundleDeployment, resources *helmdeployer.Resources) error {
+	var (
+		resourcesPreviousRelease *helmdeployer.Resources
+		err                      error
+	)
+	if bd.Spec.Options.DeployMode == fleet.DeployModeServerSideApply {
+		resourcesPreviousRelease, err = m.deployer.PreviouslyAppliedResources(ctx, bd.Name, bd.Status.Release)
+	} else {
+		resourcesPreviousRelease, err = m.deployer.ResourcesFromPreviousReleaseVersion(bd.Name, bd.Status.Release)
+	}
 	if err != nil {
 		return err
 	}
@@ -159,12 +231,36 @@ func (m *Monitor) updateFromResources(logger logr.Logger, bd *fleet.BundleDeploy
 	if err != nil {
 		return err
 	}
-	plan, err = applied.Diff(plan, bd, resources.DefaultNamespace, resources.Objects...)
+	var agentConfig *config.Config
+	if m.agentConfig != nil {
+		agentConfig, err = m.agentConfig(ctx)
+		if err != nil {
+			// continue with the default drift ignore rules and without global health checks
+			logger.Error(err, "Cannot read agent config, ignoring configured drift ignore rules and health checks")
+			agentConfig = nil
+		}
+	}
+
+	var hpas []autoscalingv2.HorizontalPodAutoscaler
+	if agentConfig == nil || !agentConfig.DisableDefaultDriftIgnore {
+		hpas, err = m.horizontalPodAutoscalers(ctx, ns, resources.Objects)
+		if err != nil {
+			return err
+		}
+	}
+
+	plan, err = applied.Diff(plan, bd, agentConfig, hpas, resources.DefaultNamespace, resources.Objects...)
 	if err != nil {
 		return err
 	}
 
-	bd.Status.NonReadyStatus = nonReady(logger, plan, bd.Spec.Options.IgnoreOptions)
+	var globalHealthChecks []fleet.HealthCheck
+	if agentConfig != nil {
+		globalHealthChecks = agentConfig.HealthChecks
+	}
+	checks := newHealthChecks(bd.Spec.Options.HealthChecks, globalHealthChecks)
+
+	bd.Status.NonReadyStatus = nonReady(logger, plan, bd.Spec.Options.IgnoreOptions, checks)
 	bd.Status.ModifiedStatus = modified(plan, resourcesPreviousRelease)
 	bd.Status.Ready = false
 	bd.Status.NonModified = false
@@ -202,7 +298,7 @@ func (m *Monitor) updateFromResources(logger logr.Logger, bd *fleet.BundleDeploy
 	return nil
 }
 
-func nonReady(logger logr.Logger, plan apply.Plan, ignoreOptions fleet.IgnoreOptions) (result []fleet.NonReadyStatus) {
+func nonReady(logger logr.Logger, plan apply.Plan, ignoreOptions fleet.IgnoreOptions, checks *healthChecks) (result []fleet.NonReadyStatus) {
 	defer func() {
 		sort.Slice(result, func(i, j int) bool {
 			return result[i].UID < result[j].UID
@@ -220,15 +316,19 @@ func nonReady(logger logr.Logger, plan apply.Plan, ignoreOptions fleet.IgnoreOpt
 				}
 			}
 
-			summary := summary.Summarize(u)
-			if !summary.IsReady() {
+			// health checks take precedence over wrangler's summary
+			s, ok := checks.summarize(u)
+			if !ok {
+				s = summary.Summarize(u)
+			}
+			if !s.IsReady() {
 				result = append(result, fleet.NonReadyStatus{
 					UID:        u.GetUID(),
 					Kind:       u.GetKind(),
 					APIVersion: u.GetAPIVersion(),
 					Namespace:  u.GetNamespace(),
 					Name:       u.GetName(),
-					Summary:    summary,
+					Summary:    s,
 				})
 			}
 		}
@@ -0,0 +1,294 @@
+package normalizers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/fleet/internal/cmd/agent/deployer/internal/glob"
+	"github.com/rancher/fleet/internal/config"
+
+	"github.com/rancher/wrangler/v2/pkg/objectset"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// wildcard matches all elements of a list or all values of a map in a field
+// path
+const wildcard = "*"
+
+// DefaultDriftIgnoreRules ignore fields, which are commonly set by
+// controllers or the API server after a resource was deployed.
+var DefaultDriftIgnoreRules = []config.DriftIgnoreRule{
+	{
+		Group:     "admissionregistration.k8s.io",
+		Kind:      "*WebhookConfiguration",
+		JSONPaths: []string{".webhooks[*].clientConfig.caBundle"},
+	},
+	{
+		Group:     "apiextensions.k8s.io",
+		Kind:      "CustomResourceDefinition",
+		JSONPaths: []string{".spec.conversion.webhook.clientConfig.caBundle"},
+	},
+	{
+		Group:        "apiregistration.k8s.io",
+		Kind:         "APIService",
+		JSONPointers: []string{"/spec/caBundle"},
+	},
+	{
+		Kind:         "Service",
+		JSONPointers: []string{"/spec/clusterIP", "/spec/clusterIPs"},
+	},
+}
+
+// DriftIgnoreRules returns the drift ignore rules of the agent config,
+// including the default rules unless they are disabled. A nil config
+// returns the default rules.
+func DriftIgnoreRules(cfg *config.Config) []config.DriftIgnoreRule {
+	if cfg == nil {
+		return DefaultDriftIgnoreRules
+	}
+	var rules []config.DriftIgnoreRule
+	if !cfg.DisableDefaultDriftIgnore {
+		rules = append(rules, DefaultDriftIgnoreRules...)
+	}
+	return append(rules, cfg.DriftIgnore...)
+}
+
+type driftIgnoreRule struct {
+	group     string
+	kind      string
+	namespace string
+	name      string
+	paths     [][]string
+}
+
+// DriftIgnoreNormalizer removes the fields selected by the agent's drift
+// ignore rules. In contrast to the diff options of a bundle, all selectors
+// are glob patterns.
+type DriftIgnoreNormalizer struct {
+	rules []driftIgnoreRule
+}
+
+// NewDriftIgnoreNormalizer parses the JSON pointers and JSONPath
+// expressions of the rules.
+func NewDriftIgnoreNormalizer(rules []config.DriftIgnoreRule) (*DriftIgnoreNormalizer, error) {
+	n := &DriftIgnoreNormalizer{}
+	for _, r := range rules {
+		rule, err := parseDriftIgnoreRule(r)
+		if err != nil {
+			return nil, err
+		}
+		n.rules = append(n.rules, rule)
+	}
+	return n, nil
+}
+
+// ValidDriftIgnoreRules returns the rules, which can be parsed, and an error
+// for the others. A single malformed rule in the agent config should not
+// disable drift ignore rules for all bundle deployments.
+func ValidDriftIgnoreRules(rules []config.DriftIgnoreRule) ([]config.DriftIgnoreRule, error) {
+	var (
+		valid []config.DriftIgnoreRule
+		errs  []error
+	)
+	for i, r := range rules {
+		if _, err := parseDriftIgnoreRule(r); err != nil {
+			errs = append(errs, fmt.Errorf("drift ignore rule %d: %w", i, err))
+			continue
+		}
+		valid = append(valid, r)
+	}
+	return valid, errors.Join(errs...)
+}
+
+func parseDriftIgnoreRule(r config.DriftIgnoreRule) (driftIgnoreRule, error) {
+	rule := driftIgnoreRule{
+		group:     r.Group,
+		kind:      r.Kind,
+		namespace: r.Namespace,
+		name:      r.Name,
+	}
+	for _, pointer := range r.JSONPointers {
+		path, err := parseJSONPointer(pointer)
+		if err != nil {
+			return rule, err
+		}
+		rule.paths = append(rule.paths, path)
+	}
+	for _, expr := range r.JSONPaths {
+		path, err := parseJSONPath(expr)
+		if err != nil {
+			return rule, err
+		}
+		rule.paths = append(rule.paths, path)
+	}
+	return rule, nil
+}
+
+func (n *DriftIgnoreNormalizer) Normalize(un *unstructured.Unstructured) error {
+	if un == nil {
+		return nil
+	}
+	gvk := un.GroupVersionKind()
+	for _, rule := range n.rules {
+		if !matches(rule.group, gvk.Group) ||
+			!matches(rule.kind, gvk.Kind) ||
+			!matches(rule.namespace, un.GetNamespace()) ||
+			!matches(rule.name, un.GetName()) {
+			continue
+		}
+		for _, path := range rule.paths {
+			removePath(un.Object, path)
+		}
+	}
+	return nil
+}
+
+// HPAReplicasNormalizer removes the replicas from the spec of resources,
+// which are scaled by a HorizontalPodAutoscaler. These are the live
+// HorizontalPodAutoscalers of the bundle and the ones found on the cluster,
+// e.g. deployed by another bundle or created by hand.
+type HPAReplicasNormalizer struct {
+	Live objectset.ObjectByGVK
+	HPAs []autoscalingv2.HorizontalPodAutoscaler
+}
+
+func (h *HPAReplicasNormalizer) Normalize(un *unstructured.Unstructured) error {
+	if un == nil {
+		return nil
+	}
+	gk := un.GroupVersionKind().GroupKind()
+	scales := func(namespace, apiVersion, kind, name string) bool {
+		return namespace == un.GetNamespace() && name == un.GetName() &&
+			schema.FromAPIVersionAndKind(apiVersion, kind).GroupKind() == gk
+	}
+
+	for _, hpa := range h.HPAs {
+		ref := hpa.Spec.ScaleTargetRef
+		if scales(hpa.Namespace, ref.APIVersion, ref.Kind, ref.Name) {
+			unstructured.RemoveNestedField(un.Object, "spec", "replicas")
+			return nil
+		}
+	}
+	for gvk, objs := range h.Live {
+		if gvk.Group != "autoscaling" || gvk.Kind != "HorizontalPodAutoscaler" {
+			continue
+		}
+		for key, obj := range objs {
+			hpa, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			ref, _, _ := unstructured.NestedStringMap(hpa.Object, "spec", "scaleTargetRef")
+			if scales(key.Namespace, ref["apiVersion"], ref["kind"], ref["name"]) {
+				unstructured.RemoveNestedField(un.Object, "spec", "replicas")
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// matches returns true if the pattern is empty or the glob pattern matches
+func matches(pattern, text string) bool {
+	return pattern == "" || glob.Match(pattern, text)
+}
+
+// parseJSONPointer splits a RFC 6901 JSON pointer into its reference tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must start with '/'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// parseJSONPath splits a JSONPath expression, which consists of field names
+// and [*] or [index] subscripts, into the tokens of its path, e.g.
+// "{.webhooks[*].clientConfig}" into "webhooks", "*", "clientConfig".
+func parseJSONPath(expr string) ([]string, error) {
+	path := strings.TrimSpace(expr)
+	if strings.HasPrefix(path, "{") && strings.HasSuffix(path, "}") {
+		path = path[1 : len(path)-1]
+	}
+	path = strings.TrimPrefix(path, "$")
+
+	var tokens []string
+	for path != "" {
+		switch path[0] {
+		case '.':
+			end := strings.IndexAny(path[1:], ".[")
+			if end < 0 {
+				end = len(path) - 1
+			}
+			field := path[1 : end+1]
+			if field == "" {
+				return nil, fmt.Errorf("invalid JSONPath %q: empty field name", expr)
+			}
+			tokens = append(tokens, field)
+			path = path[end+1:]
+		case '[':
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %q: missing ']'", expr)
+			}
+			subscript := strings.Trim(path[1:end], `'"`)
+			if subscript == "" {
+				return nil, fmt.Errorf("invalid JSONPath %q: empty subscript", expr)
+			}
+			tokens = append(tokens, subscript)
+			path = path[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %q: unexpected %q", expr, path[0])
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("invalid JSONPath %q: no fields", expr)
+	}
+	return tokens, nil
+}
+
+// removePath removes the field at the path from the object. Missing fields
+// are ignored and list elements are not removed, only fields below them.
+func removePath(obj interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	last := len(path) == 1
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		if path[0] == wildcard {
+			for k, v := range o {
+				if last {
+					delete(o, k)
+					continue
+				}
+				removePath(v, path[1:])
+			}
+			return
+		}
+		if last {
+			delete(o, path[0])
+			return
+		}
+		removePath(o[path[0]], path[1:])
+	case []interface{}:
+		if path[0] == wildcard {
+			for _, v := range o {
+				removePath(v, path[1:])
+			}
+			return
+		}
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(o) || last {
+			return
+		}
+		removePath(o[i], path[1:])
+	}
+}
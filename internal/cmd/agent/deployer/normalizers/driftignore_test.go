@@ -0,0 +1,158 @@
+package normalizers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/fleet/internal/config"
+
+	"github.com/rancher/wrangler/v2/pkg/objectset"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	path, err := parseJSONPath("{.webhooks[*].clientConfig['caBundle']}")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"webhooks", "*", "clientConfig", "caBundle"}, path)
+
+	path, err = parseJSONPath("$.spec.containers[0].image")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"spec", "containers", "0", "image"}, path)
+
+	for _, invalid := range []string{"", "spec", ".spec..replicas", ".spec[*", "{}"} {
+		_, err = parseJSONPath(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDriftIgnoreNormalizer(t *testing.T) {
+	norm, err := NewDriftIgnoreNormalizer(DriftIgnoreRules(&config.Config{
+		DriftIgnore: []config.DriftIgnoreRule{{
+			Group:        "*.example.com",
+			Namespace:    "team-*",
+			JSONPointers: []string{"/metadata/annotations/a~1b"},
+			JSONPaths:    []string{".spec.items[*].value"},
+		}},
+	}))
+	require.NoError(t, err)
+
+	thing := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "things.example.com/v1",
+		"kind":       "Thing",
+		"metadata": map[string]interface{}{
+			"namespace":   "team-a",
+			"name":        "thing",
+			"annotations": map[string]interface{}{"a/b": "x", "c": "y"},
+		},
+		"spec": map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"name": "one", "value": int64(1)},
+				map[string]interface{}{"name": "two"},
+			},
+		},
+	}}
+	other := thing.DeepCopy()
+	other.SetNamespace("default")
+
+	require.NoError(t, norm.Normalize(thing))
+	assert.Equal(t, map[string]string{"c": "y"}, thing.GetAnnotations())
+	items, _, _ := unstructured.NestedSlice(thing.Object, "spec", "items")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "one"},
+		map[string]interface{}{"name": "two"},
+	}, items)
+
+	require.NoError(t, norm.Normalize(other))
+	assert.Len(t, other.GetAnnotations(), 2, "namespace does not match")
+
+	// default rules
+	webhook := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "admissionregistration.k8s.io/v1",
+		"kind":       "MutatingWebhookConfiguration",
+		"webhooks": []interface{}{
+			map[string]interface{}{"clientConfig": map[string]interface{}{"caBundle": "Y2E="}},
+		},
+	}}
+	require.NoError(t, norm.Normalize(webhook))
+	assert.Equal(t, []interface{}{map[string]interface{}{"clientConfig": map[string]interface{}{}}}, webhook.Object["webhooks"])
+
+	_, err = NewDriftIgnoreNormalizer([]config.DriftIgnoreRule{{JSONPointers: []string{"spec"}}})
+	assert.Error(t, err)
+}
+
+func TestValidDriftIgnoreRules(t *testing.T) {
+	rules := []config.DriftIgnoreRule{
+		{Kind: "Deployment", JSONPointers: []string{"/spec/replicas"}},
+		{Kind: "Service", JSONPointers: []string{"spec/clusterIP"}},
+		{Kind: "ConfigMap", JSONPaths: []string{".data..key"}},
+	}
+
+	valid, err := ValidDriftIgnoreRules(rules)
+	assert.Error(t, err)
+	assert.Equal(t, rules[:1], valid)
+
+	_, err = NewDriftIgnoreNormalizer(valid)
+	assert.NoError(t, err)
+}
+
+func TestDriftIgnoreRules(t *testing.T) {
+	assert.Equal(t, DefaultDriftIgnoreRules, DriftIgnoreRules(nil))
+
+	custom := config.DriftIgnoreRule{Kind: "Deployment", JSONPointers: []string{"/spec/replicas"}}
+	assert.Equal(t, []config.DriftIgnoreRule{custom}, DriftIgnoreRules(&config.Config{
+		DriftIgnore:               []config.DriftIgnoreRule{custom},
+		DisableDefaultDriftIgnore: true,
+	}))
+}
+
+func TestHPAReplicasNormalizer(t *testing.T) {
+	hpa := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "autoscaling/v2",
+		"kind":       "HorizontalPodAutoscaler",
+		"metadata":   map[string]interface{}{"namespace": "app", "name": "web"},
+		"spec": map[string]interface{}{
+			"scaleTargetRef": map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "web"},
+		},
+	}}
+	norm := &HPAReplicasNormalizer{Live: objectset.NewObjectSet(hpa).ObjectsByGVK()}
+
+	deployment := func(namespace string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"namespace": namespace, "name": "web"},
+			"spec":       map[string]interface{}{"replicas": int64(3)},
+		}}
+	}
+
+	scaled := deployment("app")
+	require.NoError(t, norm.Normalize(scaled))
+	_, found, _ := unstructured.NestedInt64(scaled.Object, "spec", "replicas")
+	assert.False(t, found)
+
+	other := deployment("other")
+	require.NoError(t, norm.Normalize(other))
+	_, found, _ = unstructured.NestedInt64(other.Object, "spec", "replicas")
+	assert.True(t, found)
+
+	// the HPA is not part of the bundle, but found on the cluster
+	norm = &HPAReplicasNormalizer{HPAs: []autoscalingv2.HorizontalPodAutoscaler{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "web"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "web"},
+		},
+	}}}
+	other = deployment("other")
+	require.NoError(t, norm.Normalize(other))
+	_, found, _ = unstructured.NestedInt64(other.Object, "spec", "replicas")
+	assert.False(t, found)
+
+	scaled = deployment("app")
+	require.NoError(t, norm.Normalize(scaled))
+	_, found, _ = unstructured.NestedInt64(scaled.Object, "spec", "replicas")
+	assert.True(t, found)
+}
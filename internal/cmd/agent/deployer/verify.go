@@ -0,0 +1,86 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rancher/fleet/internal/helmdeployer"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/condition"
+)
+
+// reasonHelmTestFailed is the reason of the Verified condition, if the helm
+// tests of the current deployment failed. The verification job does not run
+// in that case.
+const reasonHelmTestFailed = "HelmTestFailed"
+
+// verify runs the helm tests and the verification job of the current
+// deployment, once per deployment and once its resources are ready. The result
+// is recorded in the Verified condition, which is unknown while the checks are
+// waiting or running.
+func (d *Deployer) verify(ctx context.Context, bd *fleet.BundleDeployment, status *fleet.BundleDeploymentStatus) error {
+	opts := bd.Spec.Options.Verify
+	if opts == nil || (!opts.HelmTest && opts.Job == nil) {
+		removeCondition(status, fleet.BundleDeploymentConditionVerified)
+		recordHooks(status, helmdeployer.HookVerify, "", helmdeployer.HookResult{})
+		return nil
+	}
+	if status.HookDeploymentIDs[helmdeployer.HookVerify] == bd.Spec.DeploymentID {
+		return nil
+	}
+	if !resourcesReady(bd) {
+		waitForResources(status, fleet.BundleDeploymentConditionVerified, "verification")
+		return nil
+	}
+
+	cond := condition.Cond(fleet.BundleDeploymentConditionVerified)
+	if opts.HelmTest {
+		result, err := d.testRelease(ctx, bd, status)
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(result.Failed) > 0:
+			cond.SetError(status, reasonHelmTestFailed, errors.New("helm test failed: "+strings.Join(result.Failed, ", ")))
+			recordHooks(status, helmdeployer.HookVerify, bd.Spec.DeploymentID, result)
+			return nil
+		case len(result.Pending) > 0:
+			cond.Unknown(status)
+			cond.Reason(status, "")
+			cond.Message(status, "helm test waiting for "+strings.Join(result.Pending, ", "))
+			return nil
+		}
+	}
+
+	if opts.Job == nil {
+		cond.SetError(status, "", nil)
+		recordHooks(status, helmdeployer.HookVerify, bd.Spec.DeploymentID, helmdeployer.HookResult{})
+		return nil
+	}
+
+	result, err := d.helm.RunHooks(ctx, bd, helmdeployer.HookVerify, []fleet.DeploymentHook{*opts.Job}, d.manifestLoader(bd))
+	if err != nil {
+		return err
+	}
+	setHookCondition(status, helmdeployer.HookVerify, result)
+	recordHooks(status, helmdeployer.HookVerify, bd.Spec.DeploymentID, result)
+	return nil
+}
+
+// testRelease starts or checks the helm tests of the release, which was
+// deployed for the current deployment
+func (d *Deployer) testRelease(ctx context.Context, bd *fleet.BundleDeployment, status *fleet.BundleDeploymentStatus) (helmdeployer.HookResult, error) {
+	if bd.Spec.Options.DeployMode == fleet.DeployModeServerSideApply {
+		return helmdeployer.HookResult{Failed: []string{"not supported with server-side apply"}}, nil
+	}
+	bd = bd.DeepCopy()
+	bd.Status.Release = status.Release
+	var timeout time.Duration
+	if bd.Spec.Options.Verify.Timeout != nil {
+		timeout = bd.Spec.Options.Verify.Timeout.Duration
+	}
+	return d.helm.TestRelease(ctx, bd, timeout)
+}
@@ -5,29 +5,37 @@ import (
 	"flag"
 	"os"
 
+	"github.com/rancher/fleet/internal/cmd/agent/clusterstatus"
 	"github.com/rancher/fleet/internal/cmd/agent/controller"
 	"github.com/rancher/fleet/internal/cmd/agent/deployer"
 	"github.com/rancher/fleet/internal/cmd/agent/deployer/applied"
 	"github.com/rancher/fleet/internal/cmd/agent/deployer/cleanup"
 	"github.com/rancher/fleet/internal/cmd/agent/deployer/driftdetect"
 	"github.com/rancher/fleet/internal/cmd/agent/deployer/monitor"
+	"github.com/rancher/fleet/internal/cmd/agent/deployer/normalizers"
 	"github.com/rancher/fleet/internal/cmd/agent/register"
 	"github.com/rancher/fleet/internal/cmd/agent/trigger"
+	"github.com/rancher/fleet/internal/config"
 	"github.com/rancher/fleet/internal/helmdeployer"
 	"github.com/rancher/fleet/internal/manifest"
 	"github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 
 	"helm.sh/helm/v3/pkg/cli"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/dynamic"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
@@ -60,7 +68,8 @@ func start(ctx context.Context, localConfig *rest.Config, systemNamespace, agent
 		return err
 	}
 
-	// Start manager for upstream cluster, we do not use leader election
+	// Start manager for upstream cluster. The replicas of the agent elect
+	// a leader with a lease in the agent's namespace on the local cluster.
 	setupLog.Info("listening for changes on upstream cluster", "cluster", clusterName, "namespace", fleetNamespace)
 
 	metricsAddr := ":8080"
@@ -70,7 +79,13 @@ func start(ctx context.Context, localConfig *rest.Config, systemNamespace, agent
 		Scheme:                 scheme,
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
 		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         false,
+
+		LeaderElection:                true,
+		LeaderElectionID:              clusterstatus.LeaderElectionID,
+		LeaderElectionNamespace:       systemNamespace,
+		LeaderElectionConfig:          localConfig,
+		LeaderElectionReleaseOnCancel: true,
+
 		// only watch resources in the fleet namespace
 		Cache: cache.Options{
 			DefaultNamespaces: map[string]cache.Config{fleetNamespace: {}},
@@ -170,11 +185,15 @@ func newReconciler(ctx, localCtx context.Context, mgr manager.Manager, localConf
 		return nil, err
 	}
 
+	// Cache manifests on the local cluster, so known manifests can be
+	// deployed while the upstream cluster is unreachable
+	manifests := manifest.NewCachedLookup(localClient, systemNamespace)
+
 	// Build the deployer that the bundledeployment reconciler will use
 	deployer := deployer.New(
 		localClient,
 		mgr.GetAPIReader(),
-		manifest.NewLookup(),
+		manifests,
 		helmDeployer,
 	)
 
@@ -188,11 +207,13 @@ func newReconciler(ctx, localCtx context.Context, mgr manager.Manager, localConf
 		return nil, err
 	}
 	monitor := monitor.New(
+		localClient,
 		applied,
 		localClient.RESTMapper(),
 		helmDeployer,
 		defaultNamespace,
 		agentScope,
+		agentConfigLookup(localClient, systemNamespace),
 	)
 
 	// Build the drift detector for deployed resources
@@ -213,6 +234,7 @@ func newReconciler(ctx, localCtx context.Context, mgr manager.Manager, localConf
 		localClient.RESTMapper(),
 		localDynamic,
 		helmDeployer,
+		manifests,
 		fleetNamespace,
 		defaultNamespace,
 	)
@@ -231,6 +253,8 @@ func newReconciler(ctx, localCtx context.Context, mgr manager.Manager, localConf
 		DefaultNamespace: defaultNamespace,
 
 		AgentScope: agentScope,
+
+		Recorder: mgr.GetEventRecorderFor("fleet-agent"),
 	}, nil
 }
 
@@ -257,3 +281,32 @@ func newCluster(ctx context.Context, config *rest.Config, options manager.Option
 
 	return cluster, nil
 }
+
+// agentConfigLookup returns a lookup for the agent config, which is read
+// from the cache each time, so changes to the drift ignore rules apply
+// without restarting the agent. Malformed drift ignore rules and health
+// checks are logged and skipped.
+func agentConfigLookup(reader client.Reader, systemNamespace string) monitor.AgentConfigLookup {
+	return func(ctx context.Context) (*config.Config, error) {
+		cm := &corev1.ConfigMap{}
+		err := reader.Get(ctx, types.NamespacedName{Namespace: systemNamespace, Name: config.AgentConfigName}, cm)
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		cfg, err := config.ReadConfig(cm)
+		if err != nil {
+			return nil, err
+		}
+		cfg.DriftIgnore, err = normalizers.ValidDriftIgnoreRules(cfg.DriftIgnore)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "Skipping invalid drift ignore rules in agent config")
+		}
+		cfg.HealthChecks, err = monitor.ValidHealthChecks(cfg.HealthChecks)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "Skipping invalid health checks in agent config")
+		}
+		return cfg, nil
+	}
+}
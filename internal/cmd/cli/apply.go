@@ -49,6 +49,7 @@ type Apply struct {
 	CorrectDrift                bool              `usage:"Rollback any change made from outside of Fleet" name:"correct-drift"`
 	CorrectDriftForce           bool              `usage:"Use --force when correcting drift. Resources can be deleted and recreated" name:"correct-drift-force"`
 	CorrectDriftKeepFailHistory bool              `usage:"Keep helm history for failed rollbacks" name:"correct-drift-keep-fail-history"`
+	CorrectDriftStrategy        string            `usage:"How to correct drift, 'rollback' the release or 'patch' the drifted fields" name:"correct-drift-strategy"`
 }
 
 func (r *Apply) PersistentPre(_ *cobra.Command, _ []string) error {
@@ -87,6 +88,7 @@ func (a *Apply) Run(cmd *cobra.Command, args []string) error {
 		CorrectDrift:                a.CorrectDrift,
 		CorrectDriftForce:           a.CorrectDriftForce,
 		CorrectDriftKeepFailHistory: a.CorrectDriftKeepFailHistory,
+		CorrectDriftStrategy:        a.CorrectDriftStrategy,
 	}
 	err := a.addAuthToOpts(&opts, os.ReadFile)
 	if err != nil {
@@ -54,6 +54,7 @@ type Options struct {
 	CorrectDrift                bool
 	CorrectDriftForce           bool
 	CorrectDriftKeepFailHistory bool
+	CorrectDriftStrategy        string
 }
 
 func globDirs(baseDir string) (result []string, err error) {
@@ -185,6 +186,7 @@ func readBundle(ctx context.Context, name, baseDir string, opts *Options) (*flee
 			Enabled:         opts.CorrectDrift,
 			Force:           opts.CorrectDriftForce,
 			KeepFailHistory: opts.CorrectDriftKeepFailHistory,
+			Strategy:        opts.CorrectDriftStrategy,
 		},
 	})
 }
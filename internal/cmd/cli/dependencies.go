@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rancher/fleet/internal/client"
+	command "github.com/rancher/fleet/internal/cmd"
+	"github.com/rancher/fleet/internal/cmd/cli/writer"
+	"github.com/rancher/fleet/internal/dependency"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func NewDependencies() *cobra.Command {
+	return command.Command(&Dependencies{}, cobra.Command{
+		Use:   "dependencies [flags] [cluster...]",
+		Short: "Print the dependency graph of the bundles deployed to clusters in DOT format",
+		Long: `Print the dependency graph of the bundles deployed to clusters in DOT format.
+
+The graph contains a node for every bundle deployed to the cluster and an edge
+for every resolved dependsOn reference. References, which match no bundle
+deployed to the cluster, are drawn as dashed red edges. Without arguments the
+graphs of all clusters in the namespace are printed. The output can be rendered
+by Graphviz, e.g. "fleet dependencies -n fleet-default | dot -Tsvg > deps.svg".`,
+	})
+}
+
+type Dependencies struct {
+	FleetClient
+	Output string `usage:"Output contents to file or - for stdout" default:"-" short:"o"`
+}
+
+func (d *Dependencies) PersistentPre(_ *cobra.Command, _ []string) error {
+	if err := d.SetupDebug(); err != nil {
+		return fmt.Errorf("failed to set up debug logging: %w", err)
+	}
+	Client = client.NewGetter(d.Kubeconfig, d.Context, d.Namespace)
+	return nil
+}
+
+func (d *Dependencies) Run(cmd *cobra.Command, args []string) error {
+	c, err := Client.Get()
+	if err != nil {
+		return err
+	}
+
+	out := writer.New(d.Output)
+	defer out.Close()
+
+	clusters, err := c.Fleet.Cluster().List(c.Namespace, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for _, name := range args {
+		names[name] = true
+	}
+
+	for _, cluster := range clusters.Items {
+		if len(names) > 0 && !names[cluster.Name] {
+			continue
+		}
+		delete(names, cluster.Name)
+		if cluster.Status.Namespace == "" {
+			continue
+		}
+
+		bds, err := c.Fleet.BundleDeployment().List(cluster.Status.Namespace, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		graph := dependency.FromBundleDeployments(bds.Items)
+		if err := graph.WriteDOT(out, cluster.Namespace+"/"+cluster.Name); err != nil {
+			return err
+		}
+	}
+
+	for name := range names {
+		return fmt.Errorf("cluster %s not found in namespace %s", name, c.Namespace)
+	}
+	return nil
+}
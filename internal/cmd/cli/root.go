@@ -29,6 +29,7 @@ func App() *cobra.Command {
 		NewApply(),
 		NewTest(),
 		NewCleanUp(),
+		NewDependencies(),
 	)
 
 	return root
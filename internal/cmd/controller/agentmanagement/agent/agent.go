@@ -73,6 +73,7 @@ func AgentWithConfig(ctx context.Context, agentNamespace, controllerNamespace, a
 	mo.SystemDefaultRegistry = cfg.SystemDefaultRegistry
 	mo.AgentImagePullPolicy = cfg.AgentImagePullPolicy
 	mo.CheckinInterval = cfg.AgentCheckinInterval.Duration.String()
+	mo.NodeLabels = cfg.AgentNodeLabels
 
 	objs = append(objs, Manifest(agentNamespace, agentScope, mo)...)
 
@@ -27,18 +27,23 @@ func agentConfig(ctx context.Context, agentNamespace, controllerNamespace string
 	}
 
 	// sanity test the controllerNamespace is correct
-	_, err = config.Lookup(ctx, controllerNamespace, config.ManagerConfigName, client.Core.ConfigMap())
+	cfg, err := config.Lookup(ctx, controllerNamespace, config.ManagerConfigName, client.Core.ConfigMap())
 	if err != nil {
 		return nil, err
 	}
 
-	return configObjects(agentNamespace, opts.Labels, opts.ClientID)
+	return configObjects(agentNamespace, opts.Labels, opts.ClientID, cfg)
 }
 
-func configObjects(controllerNamespace string, clusterLabels map[string]string, clientID string) ([]runtime.Object, error) {
+// configObjects returns the agent's namespace and config. The drift ignore
+// rules and health checks are copied from the manager config.
+func configObjects(controllerNamespace string, clusterLabels map[string]string, clientID string, cfg *config.Config) ([]runtime.Object, error) {
 	cm, err := config.ToConfigMap(controllerNamespace, config.AgentConfigName, &config.Config{
-		Labels:   clusterLabels,
-		ClientID: clientID,
+		Labels:                    clusterLabels,
+		ClientID:                  clientID,
+		DriftIgnore:               cfg.DriftIgnore,
+		DisableDefaultDriftIgnore: cfg.DisableDefaultDriftIgnore,
+		HealthChecks:              cfg.HealthChecks,
 	})
 	if err != nil {
 		return nil, err
@@ -37,6 +37,8 @@ type ManifestOptions struct {
 	SystemDefaultRegistry string
 	AgentAffinity         *corev1.Affinity
 	AgentResources        *corev1.ResourceRequirements
+	AgentReplicas         *int32
+	NodeLabels            []string
 }
 
 // Manifest builds and returns a deployment manifest for the fleet-agent with a
@@ -268,9 +270,46 @@ func agentApp(namespace string, agentScope string, opts ManifestOptions) *appsv1
 	// additional tolerations from cluster
 	app.Spec.Template.Spec.Tolerations = append(app.Spec.Template.Spec.Tolerations, opts.AgentTolerations...)
 
-	// overwrite affinity if present on cluster
+	// replicas elect a leader, spread them across nodes
+	var antiAffinity *corev1.PodAntiAffinity
+	if opts.AgentReplicas != nil {
+		app.Spec.Replicas = opts.AgentReplicas
+		if *opts.AgentReplicas > 1 {
+			antiAffinity = &corev1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+					{
+						Weight: 100,
+						PodAffinityTerm: corev1.PodAffinityTerm{
+							LabelSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"app": name,
+								},
+							},
+							TopologyKey: corev1.LabelHostname,
+						},
+					},
+				},
+			}
+			app.Spec.Template.Spec.Affinity.PodAntiAffinity = antiAffinity
+		}
+	}
+
+	// node labels the clusterstatus container reports in the cluster status
+	if len(opts.NodeLabels) > 0 {
+		for i, container := range app.Spec.Template.Spec.Containers {
+			if container.Name == name+"-clusterstatus" {
+				app.Spec.Template.Spec.Containers[i].Env = append(container.Env, corev1.EnvVar{Name: "NODE_LABELS", Value: strings.Join(opts.NodeLabels, ",")})
+			}
+		}
+	}
+
+	// overwrite affinity if present on cluster, replicas are still spread
+	// unless it has its own pod anti-affinity
 	if opts.AgentAffinity != nil {
-		app.Spec.Template.Spec.Affinity = opts.AgentAffinity
+		app.Spec.Template.Spec.Affinity = opts.AgentAffinity.DeepCopy()
+		if app.Spec.Template.Spec.Affinity.PodAntiAffinity == nil {
+			app.Spec.Template.Spec.Affinity.PodAntiAffinity = antiAffinity
+		}
 	}
 
 	// modify containers via pointers to the containers
@@ -7,6 +7,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -215,3 +216,114 @@ func TestManifestAgentResources(t *testing.T) {
 		})
 	}
 }
+
+func TestManifestAgentReplicas(t *testing.T) {
+	const namespace = "fleet-system"
+
+	customAffinity := &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{{
+			Weight: 1,
+			Preference: corev1.NodeSelectorTerm{
+				MatchExpressions: []corev1.NodeSelectorRequirement{
+					{Key: "custom/label", Operator: corev1.NodeSelectorOpIn, Values: []string{"true"}},
+				},
+			},
+		}},
+	}}
+	customAntiAffinity := &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "fleet-agent"}},
+			TopologyKey:   "topology.kubernetes.io/zone",
+		}},
+	}}
+
+	for _, testCase := range []struct {
+		name                    string
+		getOpts                 func() ManifestOptions
+		expectedReplicas        *int32
+		expectedAntiAffinity    bool
+		expectedNodeAffinity    *corev1.NodeAffinity
+		expectedPodAntiAffinity *corev1.PodAntiAffinity
+	}{
+		{
+			name:    "Builtin Replicas",
+			getOpts: func() ManifestOptions { return ManifestOptions{} },
+		},
+		{
+			name:             "Single Replica",
+			getOpts:          func() ManifestOptions { return ManifestOptions{AgentReplicas: &[]int32{1}[0]} },
+			expectedReplicas: &[]int32{1}[0],
+		},
+		{
+			name:                 "Multiple Replicas",
+			getOpts:              func() ManifestOptions { return ManifestOptions{AgentReplicas: &[]int32{3}[0]} },
+			expectedReplicas:     &[]int32{3}[0],
+			expectedAntiAffinity: true,
+		},
+		{
+			name: "Multiple Replicas With Custom Affinity",
+			getOpts: func() ManifestOptions {
+				return ManifestOptions{AgentReplicas: &[]int32{3}[0], AgentAffinity: customAffinity}
+			},
+			expectedReplicas:     &[]int32{3}[0],
+			expectedAntiAffinity: true,
+			expectedNodeAffinity: customAffinity.NodeAffinity,
+		},
+		{
+			name: "Multiple Replicas With Custom Pod Anti-Affinity",
+			getOpts: func() ManifestOptions {
+				return ManifestOptions{AgentReplicas: &[]int32{3}[0], AgentAffinity: customAntiAffinity}
+			},
+			expectedReplicas:        &[]int32{3}[0],
+			expectedAntiAffinity:    true,
+			expectedPodAntiAffinity: customAntiAffinity.PodAntiAffinity,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			agent := getAgentFromManifests(namespace, "", testCase.getOpts())
+			if agent == nil {
+				t.Fatal("there were no deployments returned from the manifests")
+			}
+
+			if !cmp.Equal(agent.Spec.Replicas, testCase.expectedReplicas) {
+				t.Fatalf("replicas were not as expected: %v %v", testCase.expectedReplicas, agent.Spec.Replicas)
+			}
+			affinity := agent.Spec.Template.Spec.Affinity
+			if antiAffinity := affinity.PodAntiAffinity != nil; antiAffinity != testCase.expectedAntiAffinity {
+				t.Fatalf("pod anti-affinity was not as expected: %v", affinity)
+			}
+			if testCase.expectedNodeAffinity != nil && !cmp.Equal(affinity.NodeAffinity, testCase.expectedNodeAffinity) {
+				t.Fatalf("node affinity was not as expected: %v %v", testCase.expectedNodeAffinity, affinity.NodeAffinity)
+			}
+			if testCase.expectedPodAntiAffinity != nil && !cmp.Equal(affinity.PodAntiAffinity, testCase.expectedPodAntiAffinity) {
+				t.Fatalf("pod anti-affinity was not as expected: %v %v", testCase.expectedPodAntiAffinity, affinity.PodAntiAffinity)
+			}
+			if customAffinity.PodAntiAffinity != nil {
+				t.Fatal("the cluster's affinity was modified")
+			}
+		})
+	}
+}
+
+func TestManifestNodeLabels(t *testing.T) {
+	agent := getAgentFromManifests("fleet-system", "", ManifestOptions{NodeLabels: []string{"topology.kubernetes.io/zone", "node.kubernetes.io/instance-type"}})
+	if agent == nil {
+		t.Fatal("there were no deployments returned from the manifests")
+	}
+
+	for _, container := range agent.Spec.Template.Spec.Containers {
+		var value string
+		for _, env := range container.Env {
+			if env.Name == "NODE_LABELS" {
+				value = env.Value
+			}
+		}
+		expected := ""
+		if container.Name == DefaultName+"-clusterstatus" {
+			expected = "topology.kubernetes.io/zone,node.kubernetes.io/instance-type"
+		}
+		if value != expected {
+			t.Errorf("NODE_LABELS of container %s = %q, expected %q", container.Name, value, expected)
+		}
+	}
+}
@@ -92,7 +92,15 @@ func (i *importHandler) onConfig(config *config.Config) error {
 		if cluster.Spec.KubeConfigSecret == "" {
 			continue
 		}
-		if config.APIServerURL != cluster.Status.APIServerURL || hashStatusField(config.APIServerCA) != cluster.Status.APIServerCAHash {
+		if agentConfigHash(config) != cluster.Status.AgentConfigHash {
+			logrus.Infof("Agent config changed, trigger cluster import for cluster %s/%s", cluster.Namespace, cluster.Name)
+			c := cluster.DeepCopy()
+			c.Status.AgentConfigChanged = true
+			_, err := i.clusters.UpdateStatus(c)
+			if err != nil {
+				return err
+			}
+		} else if config.APIServerURL != cluster.Status.APIServerURL || hashStatusField(config.APIServerCA) != cluster.Status.APIServerCAHash {
 			logrus.Infof("API server config changed, trigger cluster import for cluster %s/%s", cluster.Namespace, cluster.Name)
 			c := cluster.DeepCopy()
 			c.Status.AgentConfigChanged = true
@@ -115,6 +123,20 @@ func hashStatusField(field any) string {
 	return fmt.Sprintf("%x", hasher.Sum(nil))
 }
 
+// agentConfigHash hashes the settings, which are copied from the manager
+// config into the agent config on import. It is empty if none are set, so
+// clusters imported before the settings existed are not re-imported.
+func agentConfigHash(cfg *config.Config) string {
+	if len(cfg.DriftIgnore) == 0 && !cfg.DisableDefaultDriftIgnore && len(cfg.HealthChecks) == 0 {
+		return ""
+	}
+	return hashStatusField(struct {
+		DriftIgnore               []config.DriftIgnoreRule
+		DisableDefaultDriftIgnore bool
+		HealthChecks              []fleet.HealthCheck
+	}{cfg.DriftIgnore, cfg.DisableDefaultDriftIgnore, cfg.HealthChecks})
+}
+
 func agentDeployed(cluster *fleet.Cluster) bool {
 	if cluster.Status.AgentConfigChanged {
 		return false
@@ -316,6 +338,8 @@ func (i *importHandler) importCluster(cluster *fleet.Cluster, status fleet.Clust
 				PrivateRepoURL:   cluster.Spec.PrivateRepoURL,
 				AgentAffinity:    cluster.Spec.AgentAffinity,
 				AgentResources:   cluster.Spec.AgentResources,
+				AgentReplicas:    cluster.Spec.AgentReplicas,
+				NodeLabels:       cfg.AgentNodeLabels,
 			},
 		})
 	if err != nil {
@@ -374,6 +398,7 @@ func (i *importHandler) importCluster(cluster *fleet.Cluster, status fleet.Clust
 	status.AgentConfigChanged = false
 	status.APIServerURL = apiServerURL
 	status.APIServerCAHash = hashStatusField(apiServerCA)
+	status.AgentConfigHash = agentConfigHash(cfg)
 	return status, nil
 }
 
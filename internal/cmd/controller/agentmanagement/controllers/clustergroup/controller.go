@@ -3,16 +3,17 @@ package clustergroup
 
 import (
 	"context"
+	"slices"
 	"sort"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/rancher/fleet/internal/cmd/controller/summary"
+	"github.com/rancher/fleet/internal/cmd/controller/target/matcher"
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 	fleetcontrollers "github.com/rancher/fleet/pkg/generated/controllers/fleet.cattle.io/v1alpha1"
 
 	"github.com/rancher/wrangler/v2/pkg/kv"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 )
 
@@ -40,6 +41,7 @@ func Register(ctx context.Context,
 		"cluster-group",
 		h.OnClusterGroup)
 	clusters.OnChange(ctx, "cluster-group-trigger", h.OnClusterChange)
+	clusterGroups.OnChange(ctx, "cluster-group-nested-trigger", h.OnClusterGroupChange)
 }
 
 func (h *handler) OnClusterChange(key string, cluster *fleet.Cluster) (*fleet.Cluster, error) {
@@ -63,24 +65,14 @@ func (h *handler) OnClusterChange(key string, cluster *fleet.Cluster) (*fleet.Cl
 		return nil, err
 	}
 
+	groups := matcher.NewClusterGroups(cgs)
 	for _, cg := range cgs {
-		if cg.Spec.Selector == nil {
-			continue
-		}
-		sel, err := metav1.LabelSelectorAsSelector(cg.Spec.Selector)
+		ok, err := groups.Contains(cg.Name, cluster)
 		if err != nil {
-			logrus.Errorf("invalid selector on clustergroup %s/%s: %v", cg.Namespace, cg.Name, err)
-			continue
+			logrus.Errorf("invalid clustergroup %s/%s: %v", cg.Namespace, cg.Name, err)
 		}
-		if sel.Matches(labels.Set(cluster.Labels)) {
-			h.clusterGroups.Enqueue(cg.Namespace, cg.Name)
-		}
-		// if cluster is removed from CG, need to reconcile if ClusterCount doesnt match
-		clusters, err := h.clusterCache.List(cg.Namespace, sel)
-		if err != nil {
-			logrus.Errorf("error fetching clusters in clustergroup %s%s: %v", cg.Namespace, cg.Name, err)
-		}
-		if cg.Status.ClusterCount != len(clusters) {
+		// if cluster is removed from CG, it is still listed in the status
+		if ok || slices.Contains(cg.Status.Clusters, cluster.Name) {
 			h.clusterGroups.Enqueue(cg.Namespace, cg.Name)
 		}
 	}
@@ -88,18 +80,50 @@ func (h *handler) OnClusterChange(key string, cluster *fleet.Cluster) (*fleet.Cl
 	return cluster, nil
 }
 
+// OnClusterGroupChange enqueues the cluster groups, which include or exclude
+// the changed cluster group, as their members might change as well
+func (h *handler) OnClusterGroupChange(key string, clusterGroup *fleet.ClusterGroup) (*fleet.ClusterGroup, error) {
+	ns, name := kv.Split(key, "/")
+	cgs, err := h.clusterGroupsCache.List(ns, labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, cg := range cgs {
+		if matcher.References(cg, name) {
+			h.clusterGroups.Enqueue(cg.Namespace, cg.Name)
+		}
+	}
+	return clusterGroup, nil
+}
+
 func (h *handler) OnClusterGroup(clusterGroup *fleet.ClusterGroup, status fleet.ClusterGroupStatus) (fleet.ClusterGroupStatus, error) {
-	var clusters []*fleet.Cluster
-	if clusterGroup.Spec.Selector != nil {
-		sel, err := metav1.LabelSelectorAsSelector(clusterGroup.Spec.Selector)
-		if err != nil {
-			return status, err
+	cgs, err := h.clusterGroupsCache.List(clusterGroup.Namespace, labels.Everything())
+	if err != nil {
+		return status, err
+	}
+	for i, cg := range cgs {
+		if cg.Name == clusterGroup.Name {
+			cgs[i] = clusterGroup
 		}
+	}
+	groups := matcher.NewClusterGroups(cgs)
+	if cycle := groups.Cycle(clusterGroup.Name); cycle != nil {
+		return status, matcher.CycleError(cycle)
+	}
 
-		clusters, err = h.clusterCache.List(clusterGroup.Namespace, sel)
+	all, err := h.clusterCache.List(clusterGroup.Namespace, labels.Everything())
+	if err != nil {
+		return status, err
+	}
+	var clusters []*fleet.Cluster
+	for _, cluster := range all {
+		ok, err := groups.Contains(clusterGroup.Name, cluster)
 		if err != nil {
 			return status, err
 		}
+		if ok {
+			clusters = append(clusters, cluster)
+		}
 	}
 
 	logrus.Debugf("ClusterGroupStatusHandler for '%s/%s', updating its status summary", clusterGroup.Namespace, clusterGroup.Name)
@@ -109,6 +133,7 @@ func (h *handler) OnClusterGroup(clusterGroup *fleet.ClusterGroup, status fleet.
 	status.ClusterCount = 0
 	status.NonReadyClusterCount = 0
 	status.NonReadyClusters = nil
+	status.Clusters = nil
 
 	sort.Slice(clusters, func(i, j int) bool {
 		return clusters[i].Name < clusters[j].Name
@@ -118,6 +143,7 @@ func (h *handler) OnClusterGroup(clusterGroup *fleet.ClusterGroup, status fleet.
 		summary.IncrementResourceCounts(&status.ResourceCounts, cluster.Status.ResourceCounts)
 		summary.Increment(&status.Summary, cluster.Status.Summary)
 		status.ClusterCount++
+		status.Clusters = append(status.Clusters, cluster.Name)
 		if !summary.IsReady(cluster.Status.Summary) {
 			status.NonReadyClusterCount++
 			if len(status.NonReadyClusters) < 10 {
@@ -112,6 +112,8 @@ func hashChanged(field any, statusHash string) (bool, string, error) {
 			return field == nil
 		case []corev1.Toleration:
 			return len(field) == 0
+		case *int32:
+			return field == nil
 		default:
 			return false
 		}
@@ -190,6 +192,13 @@ func (h *handler) updateClusterStatus(cluster *fleet.Cluster, status fleet.Clust
 		changed = c
 	}
 
+	if c, hash, err := hashChanged(cluster.Spec.AgentReplicas, status.AgentReplicasHash); err != nil {
+		return status, changed, err
+	} else if c {
+		status.AgentReplicasHash = hash
+		changed = c
+	}
+
 	return status, changed, nil
 }
 
@@ -263,6 +272,8 @@ func (h *handler) newAgentBundle(ns string, cluster *fleet.Cluster) (runtime.Obj
 			SystemDefaultRegistry: cfg.SystemDefaultRegistry,
 			AgentAffinity:         cluster.Spec.AgentAffinity,
 			AgentResources:        cluster.Spec.AgentResources,
+			AgentReplicas:         cluster.Spec.AgentReplicas,
+			NodeLabels:            cfg.AgentNodeLabels,
 		},
 	)
 	agentYAML, err := yaml.Export(objs...)
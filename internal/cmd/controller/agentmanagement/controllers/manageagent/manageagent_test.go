@@ -271,3 +271,62 @@ func TestOnClusterChangeTolerations(t *testing.T) {
 		})
 	}
 }
+
+func TestOnClusterChangeReplicas(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	namespaces := fake.NewMockNonNamespacedControllerInterface[*corev1.Namespace, *corev1.NamespaceList](ctrl)
+	h := &handler{namespaces: namespaces}
+
+	replicas := int32(3)
+	hash, _ := hashStatusField(&replicas)
+
+	for _, tt := range []struct {
+		name           string
+		cluster        *fleet.Cluster
+		status         fleet.ClusterStatus
+		expectedStatus fleet.ClusterStatus
+		enqueues       int
+	}{
+		{
+			name:           "Empty Replicas",
+			cluster:        &fleet.Cluster{},
+			status:         fleet.ClusterStatus{},
+			expectedStatus: fleet.ClusterStatus{},
+			enqueues:       0,
+		},
+		{
+			name:           "Equal Replicas",
+			cluster:        &fleet.Cluster{Spec: fleet.ClusterSpec{AgentReplicas: &replicas}},
+			status:         fleet.ClusterStatus{AgentReplicasHash: hash},
+			expectedStatus: fleet.ClusterStatus{AgentReplicasHash: hash},
+			enqueues:       0,
+		},
+		{
+			name:           "Changed Replicas",
+			cluster:        &fleet.Cluster{Spec: fleet.ClusterSpec{AgentReplicas: &replicas}},
+			status:         fleet.ClusterStatus{AgentReplicasHash: ""},
+			expectedStatus: fleet.ClusterStatus{AgentReplicasHash: hash},
+			enqueues:       1,
+		},
+		{
+			name:           "Removed Replicas",
+			cluster:        &fleet.Cluster{Spec: fleet.ClusterSpec{}},
+			status:         fleet.ClusterStatus{AgentReplicasHash: hash},
+			expectedStatus: fleet.ClusterStatus{AgentReplicasHash: ""},
+			enqueues:       1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			namespaces.EXPECT().Enqueue(gomock.Any()).Times(tt.enqueues)
+
+			status, err := h.onClusterStatusChange(tt.cluster, tt.status)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if status.AgentReplicasHash != tt.expectedStatus.AgentReplicasHash {
+				t.Fatalf("agent replicas hash is not equal: %v vs %v", status.AgentReplicasHash, tt.expectedStatus.AgentReplicasHash)
+			}
+		})
+	}
+}
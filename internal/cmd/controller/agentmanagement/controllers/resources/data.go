@@ -34,6 +34,11 @@ func ApplyBootstrapResources(systemNamespace, systemRegistrationNamespace string
 					APIGroups: []string{fleet.SchemeGroupVersion.Group},
 					Resources: []string{fleet.BundleDeploymentResourceNamePlural + "/status"},
 				},
+				{
+					Verbs:     []string{"create", "patch"},
+					APIGroups: []string{""},
+					Resources: []string{"events"},
+				},
 			},
 		},
 		// used by request-* service accounts from agents
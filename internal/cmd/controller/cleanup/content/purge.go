@@ -74,6 +74,13 @@ func purgeOrphaned(ctx context.Context, content fleetcontrollers.ContentControll
 			if val, ok := contentRefs[stagedManifestID]; ok && stagedManifestID != deployManifestID {
 				val.bundleCount++
 			}
+
+			// keep the content of the known good deployment, so a
+			// failed rollout can be reverted
+			knownGoodManifestID, _ := kv.Split(bd.Spec.KnownGoodDeploymentID, ":")
+			if val, ok := contentRefs[knownGoodManifestID]; ok && knownGoodManifestID != deployManifestID && knownGoodManifestID != stagedManifestID {
+				val.bundleCount++
+			}
 		}
 
 		for contentName, cr := range contentRefs {
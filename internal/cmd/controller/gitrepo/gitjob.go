@@ -341,6 +341,9 @@ func argsAndEnvs(gitrepo *fleet.GitRepo) ([]string, []corev1.EnvVar) {
 		if gitrepo.Spec.CorrectDrift.KeepFailHistory {
 			args = append(args, "--correct-drift-keep-fail-history")
 		}
+		if gitrepo.Spec.CorrectDrift.Strategy != "" {
+			args = append(args, "--correct-drift-strategy", gitrepo.Spec.CorrectDrift.Strategy)
+		}
 	}
 
 	env := []corev1.EnvVar{
@@ -2,12 +2,15 @@ package gitrepo
 
 import (
 	"context"
+	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/rancher/fleet/internal/cmd/controller/summary"
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 	gitjob "github.com/rancher/fleet/pkg/apis/gitjob.cattle.io/v1"
 
+	"github.com/rancher/wrangler/v2/pkg/condition"
 	"github.com/rancher/wrangler/v2/pkg/genericcondition"
 
 	"k8s.io/apimachinery/pkg/types"
@@ -93,6 +96,40 @@ func SetStatusFromBundleDeployments(ctx context.Context, c client.Client, gitrep
 	return nil
 }
 
+// SetFrozenCondition sets the frozen condition of the gitrepo, if a deployment
+// freeze holds back changes of one of its bundles.
+func SetFrozenCondition(ctx context.Context, c client.Client, gitrepo *fleet.GitRepo) error {
+	bundles := &fleet.BundleList{}
+	err := c.List(ctx, bundles, client.InNamespace(gitrepo.Namespace), client.MatchingLabels{
+		fleet.RepoLabel: gitrepo.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(bundles.Items, func(i, j int) bool {
+		return bundles.Items[i].Name < bundles.Items[j].Name
+	})
+
+	var messages []string
+	for _, bundle := range bundles.Items {
+		bundle := bundle
+		cond := condition.Cond(fleet.BundleConditionFrozen)
+		if cond.IsTrue(&bundle.Status) {
+			messages = append(messages, fmt.Sprintf("bundle %s: %s", bundle.Name, cond.GetMessage(&bundle.Status)))
+		}
+	}
+
+	cond := condition.Cond(fleet.GitRepoFrozenCondition)
+	if len(messages) == 0 && cond.GetStatus(&gitrepo.Status) == "" {
+		// never frozen
+		return nil
+	}
+	cond.SetStatusBool(&gitrepo.Status, len(messages) > 0)
+	cond.Message(&gitrepo.Status, strings.Join(messages, "; "))
+	return nil
+}
+
 func SetStatusFromGitJob(ctx context.Context, c client.Client, gitrepo *fleet.GitRepo) error {
 	gitJob := &gitjob.GitJob{}
 	err := c.Get(ctx, types.NamespacedName{Namespace: gitrepo.Namespace, Name: gitrepo.Name}, gitJob)
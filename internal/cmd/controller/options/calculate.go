@@ -93,6 +93,9 @@ func Merge(base, custom fleet.BundleDeploymentOptions) fleet.BundleDeploymentOpt
 			result.YAML = &fleet.YAMLOptions{}
 		}
 		result.YAML.Overlays = append(result.YAML.Overlays, custom.YAML.Overlays...)
+		if custom.YAML.Template != nil {
+			result.YAML.Template = custom.YAML.Template
+		}
 	}
 	if custom.ForceSyncGeneration > 0 {
 		result.ForceSyncGeneration = custom.ForceSyncGeneration
@@ -101,6 +104,18 @@ func Merge(base, custom fleet.BundleDeploymentOptions) fleet.BundleDeploymentOpt
 	if custom.CorrectDrift != nil {
 		result.CorrectDrift = custom.CorrectDrift
 	}
+	if custom.DeployMode != "" {
+		result.DeployMode = custom.DeployMode
+	}
+	if custom.Hooks != nil {
+		result.Hooks = custom.Hooks
+	}
+	if custom.Verify != nil {
+		result.Verify = custom.Verify
+	}
+	if len(custom.HealthChecks) > 0 {
+		result.HealthChecks = custom.HealthChecks
+	}
 
 	return result
 }
@@ -10,8 +10,10 @@ import (
 	"github.com/rancher/fleet/internal/manifest"
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -35,7 +37,7 @@ type Store interface {
 }
 
 type TargetBuilder interface {
-	Targets(ctx context.Context, bundle *fleet.Bundle, manifestID string) ([]*target.Target, error)
+	Targets(ctx context.Context, bundle *fleet.Bundle, manifestID string) ([]*target.Target, []target.Outcome, error)
 }
 
 // BundleReconciler reconciles a Bundle object
@@ -51,6 +53,10 @@ type BundleReconciler struct {
 //+kubebuilder:rbac:groups=fleet.cattle.io,resources=bundles,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=fleet.cattle.io,resources=bundles/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=fleet.cattle.io,resources=bundles/finalizers,verbs=update
+//+kubebuilder:rbac:groups=fleet.cattle.io,resources=bundledeployments/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=fleet.cattle.io,resources=maintenancewindows,verbs=get;list;watch
+//+kubebuilder:rbac:groups=fleet.cattle.io,resources=deploymentfreezes,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 // Reconcile creates bundle deployments for a bundle
 func (r *BundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -70,6 +76,10 @@ func (r *BundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	}
 	logger.V(1).Info("Reconciling bundle, checking targets, calculating changes, building objects", "generation", bundle.Generation, "observedGeneration", bundle.Status.ObservedGeneration)
 
+	if err := resetPromotion(ctx, r.Client, bundle); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	manifest := manifest.FromBundle(bundle)
 	if bundle.Generation != bundle.Status.ObservedGeneration {
 		manifest.ResetSHASum()
@@ -89,22 +99,47 @@ func (r *BundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, err
 	}
 
-	matchedTargets, err := r.Builder.Targets(ctx, bundle, manifestID)
+	matchedTargets, outcomes, err := r.Builder.Targets(ctx, bundle, manifestID)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	setTargeting(&bundle.Status, bundle, outcomes)
+
+	// store the manifests, which were rendered for a single target, e.g.
+	// when templating of raw YAML resources is enabled
+	for _, target := range matchedTargets {
+		if target.Manifest == nil {
+			continue
+		}
+		if _, err := r.Store.Store(ctx, target.Manifest); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
 	if err := resetStatus(&bundle.Status, matchedTargets); err != nil {
 		updateDisplay(&bundle.Status)
 		return ctrl.Result{}, err
 	}
 
-	// this will add the defaults for a new bundledeployment
-	if err := target.UpdatePartitions(&bundle.Status, matchedTargets); err != nil {
+	// this might revert bundledeployments to their last known good
+	// deployment and halt the rollout
+	if err := target.ApplyFailurePolicy(&bundle.Status, bundle, matchedTargets); err != nil {
 		updateDisplay(&bundle.Status)
 		return ctrl.Result{}, err
 	}
 
+	// an invalid rollout strategy halts the rollout, retrying would not
+	// help until the bundle changes
+	rolloutErr := target.ValidateRollout(bundle.Spec.RolloutStrategy)
+	target.SetRolloutValidCondition(&bundle.Status, rolloutErr)
+	if rolloutErr == nil {
+		// this will add the defaults for a new bundledeployment
+		if err := target.UpdatePartitions(&bundle.Status, matchedTargets); err != nil {
+			updateDisplay(&bundle.Status)
+			return ctrl.Result{}, err
+		}
+	}
+
 	if bundle.Status.ObservedGeneration != bundle.Generation {
 		if err := setResourceKey(context.Background(), &bundle.Status, bundle, manifest, r.isNamespaced); err != nil {
 			updateDisplay(&bundle.Status)
@@ -112,6 +147,11 @@ func (r *BundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		}
 	}
 
+	target.SetFrozenCondition(&bundle.Status, matchedTargets)
+	if err := r.checkDependencies(ctx, bundle, matchedTargets); err != nil {
+		updateDisplay(&bundle.Status)
+		return ctrl.Result{}, err
+	}
 	summary.SetReadyConditions(&bundle.Status, "Cluster", bundle.Status.Summary)
 	bundle.Status.ObservedGeneration = bundle.Generation
 
@@ -141,6 +181,11 @@ func (r *BundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			return ctrl.Result{}, err
 		}
 		logger.V(1).Info(upper(op)+" bundledeployment", "bundledeployment", bd, "operation", op)
+
+		if err := r.setPending(ctx, bd, target.Hold); err != nil {
+			logger.Error(err, "Reconcile failed to update pending state of bundledeployment", "bundledeployment", bd)
+			return ctrl.Result{}, err
+		}
 	}
 
 	updateDisplay(&bundle.Status)
@@ -155,9 +200,58 @@ func (r *BundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	})
 	if err != nil {
 		logger.V(1).Error(err, "Reconcile failed final update to bundle status", "status", bundle.Status)
+		return ctrl.Result{}, err
+	}
+
+	// a soaking partition of a sequential rollout is done after its soak
+	// duration and a maintenance window opens or a deployment freeze
+	// ends, without any resource changing
+	requeueAfter := target.RequeueAfter(bundle, &bundle.Status)
+	if d := target.HoldRequeueAfter(matchedTargets); d > 0 && (requeueAfter == 0 || d < requeueAfter) {
+		requeueAfter = d
 	}
 
-	return ctrl.Result{}, err
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// setPending updates the pending state in the bundledeployment's status, which
+// shows why a staged deployment is held back.
+func (r *BundleReconciler) setPending(ctx context.Context, bd *fleet.BundleDeployment, hold *fleet.PendingStatus) error {
+	var pending *fleet.PendingStatus
+	if hold != nil && bd.Spec.DeploymentID != bd.Spec.StagedDeploymentID {
+		pending = hold
+	}
+	if equality.Semantic.DeepEqual(bd.Status.Pending, pending) {
+		return nil
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		t := &fleet.BundleDeployment{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(bd), t); err != nil {
+			return err
+		}
+		t.Status.Pending = pending
+		return r.Status().Update(ctx, t)
+	})
+}
+
+// resetPromotion removes the promoted partition annotation from a bundle,
+// which requires approval for its partitions, if the bundle changed. Each
+// change needs to be promoted again.
+func resetPromotion(ctx context.Context, c client.Client, bundle *fleet.Bundle) error {
+	rollout := bundle.Spec.RolloutStrategy
+	if rollout == nil || !rollout.Sequential || !rollout.RequireApproval ||
+		bundle.Generation == bundle.Status.ObservedGeneration {
+		return nil
+	}
+	if _, ok := bundle.Annotations[fleet.PromotedPartitionAnnotation]; !ok {
+		return nil
+	}
+
+	log.FromContext(ctx).V(1).Info("Bundle changed, removing partition promotion", "promotedPartition", bundle.Annotations[fleet.PromotedPartitionAnnotation])
+	orig := bundle.DeepCopy()
+	delete(bundle.Annotations, fleet.PromotedPartitionAnnotation)
+	return c.Patch(ctx, bundle, client.MergeFrom(orig))
 }
 
 func (r *BundleReconciler) isNamespaced(gvk schema.GroupVersionKind) bool {
@@ -187,6 +281,10 @@ func upper(op controllerutil.OperationResult) string {
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *BundleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &fleet.Bundle{}, bundleDependsOnIndex, indexDependsOn); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&fleet.Bundle{}).
 		// Note: Maybe improve with WatchesMetadata, does it have access to labels?
@@ -201,19 +299,40 @@ func (r *BundleReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				}
 
 				ns, name := target.BundleFromDeployment(labels)
-				if ns != "" && name != "" {
-					return []ctrl.Request{{
-						NamespacedName: types.NamespacedName{
-							Namespace: ns,
-							Name:      name,
-						},
-					}}
+				if ns == "" || name == "" {
+					return nil
 				}
-
-				return nil
+				return []ctrl.Request{{
+					NamespacedName: types.NamespacedName{
+						Namespace: ns,
+						Name:      name,
+					},
+				}}
 			}),
 			builder.WithPredicates(bundleDeploymentStatusChangedPredicate()),
 		).
+		Watches(
+			// Fan out from bundledeployment to the bundles, which
+			// depend on its bundle on another cluster, if it became
+			// ready or not ready
+			&fleet.BundleDeployment{},
+			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, a client.Object) []ctrl.Request {
+				return r.dependentBundles(ctx, a.(*fleet.BundleDeployment), target.IsClusterDependency)
+			}),
+			builder.WithPredicates(bundleDeploymentReadyChangedPredicate()),
+		).
+		Watches(
+			// Fan out from bundledeployment to the bundles, which
+			// depend on its bundle on the same cluster, to validate
+			// their dependencies again
+			&fleet.BundleDeployment{},
+			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, a client.Object) []ctrl.Request {
+				return r.dependentBundles(ctx, a.(*fleet.BundleDeployment), func(ref fleet.BundleRef) bool {
+					return !target.IsClusterDependency(ref)
+				})
+			}),
+			builder.WithPredicates(bundleDeploymentPlacementChangedPredicate()),
+		).
 		Watches(
 			// Fan out from cluster to bundle
 			&fleet.Cluster{},
@@ -237,5 +356,103 @@ func (r *BundleReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			}),
 			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
 		).
+		Watches(
+			// Fan out from cluster group to bundle, e.g. if the group's
+			// template values or members changed. Bundles of clusters,
+			// which were removed from the group, no longer target them.
+			&fleet.ClusterGroup{},
+			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, a client.Object) []ctrl.Request {
+				clusters, err := clusterGroupMembers(ctx, r.Client, a.(*fleet.ClusterGroup))
+				if err != nil {
+					return nil
+				}
+
+				seen := map[types.NamespacedName]bool{}
+				requests := []ctrl.Request{}
+				for _, cluster := range clusters {
+					cluster := cluster
+					bundlesToRefresh, bundlesToCleanup, err := r.Query.BundlesForCluster(ctx, &cluster)
+					if err != nil {
+						return nil
+					}
+					for _, bundle := range append(bundlesToRefresh, bundlesToCleanup...) {
+						key := types.NamespacedName{Namespace: bundle.Namespace, Name: bundle.Name}
+						if seen[key] {
+							continue
+						}
+						seen[key] = true
+						requests = append(requests, ctrl.Request{NamespacedName: key})
+					}
+				}
+
+				return requests
+			}),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			// Fan out from maintenance window to bundle, the bundles
+			// of all clusters in the namespace are checked again
+			&fleet.MaintenanceWindow{},
+			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, a client.Object) []ctrl.Request {
+				clusters := &fleet.ClusterList{}
+				if err := r.List(ctx, clusters, client.InNamespace(a.GetNamespace())); err != nil {
+					return nil
+				}
+
+				seen := map[types.NamespacedName]bool{}
+				requests := []ctrl.Request{}
+				for _, cluster := range clusters.Items {
+					cluster := cluster
+					bundlesToRefresh, _, err := r.Query.BundlesForCluster(ctx, &cluster)
+					if err != nil {
+						return nil
+					}
+					for _, bundle := range bundlesToRefresh {
+						key := types.NamespacedName{Namespace: bundle.Namespace, Name: bundle.Name}
+						if seen[key] {
+							continue
+						}
+						seen[key] = true
+						requests = append(requests, ctrl.Request{NamespacedName: key})
+					}
+				}
+
+				return requests
+			}),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			// Fan out from deployment freeze to bundle, all bundles
+			// selected by the freeze are checked again
+			&fleet.DeploymentFreeze{},
+			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, a client.Object) []ctrl.Request {
+				freeze := a.(*fleet.DeploymentFreeze)
+				opts := []client.ListOption{}
+				if freeze.Spec.BundleSelector != nil {
+					sel, err := metav1.LabelSelectorAsSelector(freeze.Spec.BundleSelector)
+					if err != nil {
+						return nil
+					}
+					opts = append(opts, client.MatchingLabelsSelector{Selector: sel})
+				}
+				bundles := &fleet.BundleList{}
+				if err := r.List(ctx, bundles, opts...); err != nil {
+					return nil
+				}
+
+				requests := []ctrl.Request{}
+				for _, bundle := range bundles.Items {
+					requests = append(requests, ctrl.Request{
+						NamespacedName: types.NamespacedName{
+							Namespace: bundle.Namespace,
+							Name:      bundle.Name,
+						},
+					})
+				}
+
+				return requests
+			}),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
 		Complete(r)
 }
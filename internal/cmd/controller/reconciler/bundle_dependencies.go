@@ -0,0 +1,203 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/rancher/fleet/internal/cmd/controller/target"
+	"github.com/rancher/fleet/internal/dependency"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/condition"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// maxDependencyProblems limits the number of dependency problems
+	// listed in the bundle's condition
+	maxDependencyProblems = 10
+
+	// bundleDependsOnIndex indexes bundles by the names of the bundles
+	// they depend on. References by selector are indexed as
+	// dependsOnSelector.
+	bundleDependsOnIndex = "spec.dependsOn"
+	dependsOnSelector    = "*"
+)
+
+// indexDependsOn returns the index values of the bundle's dependsOn
+// references (pure function)
+func indexDependsOn(obj client.Object) []string {
+	bundle, ok := obj.(*fleet.Bundle)
+	if !ok {
+		return nil
+	}
+	var result []string
+	for _, ref := range bundle.Spec.DependsOn {
+		switch {
+		case ref.Name != "":
+			result = append(result, ref.Name)
+		case ref.Selector != nil:
+			result = append(result, dependsOnSelector)
+		}
+	}
+	return result
+}
+
+// dependentBundles returns requests for the bundles, which depend on the
+// bundledeployment's bundle with a reference accepted by the filter.
+func (r *BundleReconciler) dependentBundles(ctx context.Context, bd *fleet.BundleDeployment, filter func(fleet.BundleRef) bool) []ctrl.Request {
+	ns, name := target.BundleFromDeployment(bd.GetLabels())
+	if ns == "" || name == "" {
+		return nil
+	}
+
+	var requests []ctrl.Request
+	for _, value := range []string{name, dependsOnSelector} {
+		bundles := &fleet.BundleList{}
+		if err := r.List(ctx, bundles, client.InNamespace(ns), client.MatchingFields{bundleDependsOnIndex: value}); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list dependent bundles", "bundle", ns+"/"+name)
+			continue
+		}
+		for _, bundle := range bundles.Items {
+			if bundle.Name == name || !dependsOn(&bundle, bd.Labels, filter) {
+				continue
+			}
+			requests = append(requests, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: bundle.Namespace, Name: bundle.Name}})
+		}
+	}
+	return requests
+}
+
+// dependsOn returns true if a reference of the bundle, which is accepted by
+// the filter, matches the bundledeployment labels (pure function)
+func dependsOn(bundle *fleet.Bundle, bdLabels map[string]string, filter func(fleet.BundleRef) bool) bool {
+	for _, ref := range bundle.Spec.DependsOn {
+		if ref.Name == "" && ref.Selector == nil || !filter(ref) {
+			continue
+		}
+		selector, err := dependency.Selector(ref, bundle.Namespace)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(bdLabels)) {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleDeploymentPlacementChangedPredicate passes events, which change the
+// bundles deployed to a cluster, or the labels dependsOn references match
+func bundleDeploymentPlacementChangedPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return true
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return true
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !reflect.DeepEqual(e.ObjectNew.GetLabels(), e.ObjectOld.GetLabels())
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+}
+
+// bundleDeploymentReadyChangedPredicate passes events, which change whether
+// a bundledeployment is ready
+func bundleDeploymentReadyChangedPredicate() predicate.Funcs {
+	ready := condition.Cond(fleet.BundleDeploymentConditionReady)
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return true
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return true
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			n, nok := e.ObjectNew.(*fleet.BundleDeployment)
+			o, ook := e.ObjectOld.(*fleet.BundleDeployment)
+			if !nok || !ook {
+				return false
+			}
+			return ready.IsTrue(n) != ready.IsTrue(o)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+}
+
+// checkDependencies builds the dependency graph of every targeted cluster and
+// sets a condition on the bundle, if its dependencies contain a cycle or
+// refer to bundles, which are not deployed to the cluster. The agent would
+// wait for these dependencies forever.
+func (r *BundleReconciler) checkDependencies(ctx context.Context, bundle *fleet.Bundle, targets []*target.Target) error {
+	cond := condition.Cond(fleet.BundleConditionDependenciesValid)
+	if len(bundle.Spec.DependsOn) == 0 {
+		if cond.GetStatus(&bundle.Status) != "" {
+			cond.SetStatusBool(&bundle.Status, true)
+			cond.Message(&bundle.Status, "")
+		}
+		return nil
+	}
+
+	// list the bundledeployments once, instead of once per cluster
+	bds := &fleet.BundleDeploymentList{}
+	if err := r.List(ctx, bds); err != nil {
+		return err
+	}
+	byNamespace := map[string][]fleet.BundleDeployment{}
+	for _, bd := range bds.Items {
+		byNamespace[bd.Namespace] = append(byNamespace[bd.Namespace], bd)
+	}
+
+	var problems []string
+	for _, t := range targets {
+		if t.Cluster.Status.Namespace == "" {
+			continue
+		}
+
+		graph := dependency.FromBundleDeployments(byNamespace[t.Cluster.Status.Namespace])
+		// the bundledeployment might not be updated yet, use the
+		// bundle's current references
+		graph.Add(bundle.Namespace, bundle.Name, t.BundleDeploymentLabels(t.Cluster.Namespace, t.Cluster.Name), bundle.Spec.DependsOn)
+
+		key := dependency.Key(bundle.Namespace, bundle.Name)
+		cluster := t.Cluster.Namespace + "/" + t.Cluster.Name
+		_, unsatisfied, err := graph.Dependencies(key)
+		if err != nil {
+			return err
+		}
+		for _, ref := range unsatisfied {
+			problems = append(problems, fmt.Sprintf("cluster %s: dependency %s is not deployed to the cluster", cluster, ref))
+		}
+
+		cycle, err := graph.Cycle(key)
+		if err != nil {
+			return err
+		}
+		if cycle != nil {
+			problems = append(problems, fmt.Sprintf("cluster %s: dependency cycle %s", cluster, strings.Join(cycle, " -> ")))
+		}
+	}
+
+	message := strings.Join(problems, "; ")
+	if len(problems) > maxDependencyProblems {
+		message = fmt.Sprintf("%s; and %d more", strings.Join(problems[:maxDependencyProblems], "; "), len(problems)-maxDependencyProblems)
+	}
+	cond.SetStatusBool(&bundle.Status, len(problems) == 0)
+	cond.Message(&bundle.Status, message)
+	return nil
+}
@@ -0,0 +1,129 @@
+package reconciler
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rancher/fleet/internal/cmd/controller/target"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/condition"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestDependentBundles(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := fleet.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := func(name string, dependsOn ...fleet.BundleRef) *fleet.Bundle {
+		return &fleet.Bundle{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "fleet-default"},
+			Spec:       fleet.BundleSpec{DependsOn: dependsOn},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithIndex(&fleet.Bundle{}, bundleDependsOnIndex, indexDependsOn).
+		WithObjects(
+			bundle("db"),
+			bundle("app", fleet.BundleRef{Name: "db"}),
+			bundle("monitoring", fleet.BundleRef{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "data"}}}),
+			bundle("remote", fleet.BundleRef{Name: "db", ClusterName: "central"}),
+			bundle("unrelated", fleet.BundleRef{Name: "cache"}),
+		).Build()
+	r := &BundleReconciler{Client: c}
+
+	bd := &fleet.BundleDeployment{ObjectMeta: metav1.ObjectMeta{
+		Name:      "db",
+		Namespace: "cluster-fleet-default-one",
+		Labels: map[string]string{
+			fleet.BundleLabel:          "db",
+			fleet.BundleNamespaceLabel: "fleet-default",
+			"tier":                     "data",
+		},
+	}}
+
+	names := func(local bool) []string {
+		var result []string
+		for _, req := range r.dependentBundles(context.Background(), bd, func(ref fleet.BundleRef) bool {
+			return target.IsClusterDependency(ref) != local
+		}) {
+			result = append(result, req.Name)
+		}
+		return result
+	}
+
+	if n := names(true); !reflect.DeepEqual(n, []string{"app", "monitoring"}) {
+		t.Errorf("unexpected dependents on the same cluster: %v", n)
+	}
+	if n := names(false); !reflect.DeepEqual(n, []string{"remote"}) {
+		t.Errorf("unexpected dependents on other clusters: %v", n)
+	}
+}
+
+func TestCheckDependencies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := fleet.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	bd := func(namespace, name string) *fleet.BundleDeployment {
+		return &fleet.BundleDeployment{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				fleet.BundleLabel:          name,
+				fleet.BundleNamespaceLabel: "fleet-default",
+			},
+		}}
+	}
+	lists := 0
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(
+			bd("cluster-fleet-default-one", "db"),
+			bd("cluster-fleet-default-two", "cache"),
+		).
+		WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				lists++
+				return c.List(ctx, list, opts...)
+			},
+		}).Build()
+	r := &BundleReconciler{Client: c}
+
+	bundle := &fleet.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "fleet-default"},
+		Spec:       fleet.BundleSpec{DependsOn: []fleet.BundleRef{{Name: "db"}}},
+	}
+	newTarget := func(name string) *target.Target {
+		return &target.Target{
+			Bundle: bundle,
+			Cluster: &fleet.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "fleet-default"},
+				Status:     fleet.ClusterStatus{Namespace: "cluster-fleet-default-" + name},
+			},
+		}
+	}
+
+	if err := r.checkDependencies(context.Background(), bundle, []*target.Target{newTarget("one"), newTarget("two")}); err != nil {
+		t.Fatal(err)
+	}
+	if lists != 1 {
+		t.Errorf("expected bundledeployments to be listed once, got %d lists", lists)
+	}
+	cond := condition.Cond(fleet.BundleConditionDependenciesValid)
+	if cond.IsTrue(&bundle.Status) {
+		t.Fatal("expected dependencies to be invalid")
+	}
+	if msg := cond.GetMessage(&bundle.Status); !strings.Contains(msg, "cluster fleet-default/two") || strings.Contains(msg, "cluster fleet-default/one") {
+		t.Errorf("unexpected message: %s", msg)
+	}
+}
@@ -25,7 +25,6 @@ const (
 func resetStatus(status *fleet.BundleStatus, allTargets []*target.Target) (err error) {
 	status.MaxNew = maxNew
 	status.Summary = fleet.BundleSummary{}
-	status.PartitionStatus = nil
 	status.Unavailable = 0
 	status.NewlyCreated = 0
 	status.Summary = target.Summary(allTargets)
@@ -34,6 +33,18 @@ func resetStatus(status *fleet.BundleStatus, allTargets []*target.Target) (err e
 	return err
 }
 
+// setTargeting records the targeting outcomes in the status: the number of
+// clusters per outcome and, if requested by annotation, the explanation for a
+// single cluster, e.g. its unmet requirement (does not mutate outcomes)
+func setTargeting(status *fleet.BundleStatus, bundle *fleet.Bundle, outcomes []target.Outcome) {
+	status.Targeting = target.TargetingSummary(outcomes)
+
+	status.Explanation = nil
+	if ref := bundle.Annotations[fleet.ExplainClusterAnnotation]; ref != "" {
+		status.Explanation = target.Explain(bundle, outcomes, ref)
+	}
+}
+
 func updateDisplay(status *fleet.BundleStatus) {
 	status.Display.ReadyClusters = fmt.Sprintf("%d/%d",
 		status.Summary.Ready,
@@ -19,8 +19,11 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 var LongRetry = wait.Backoff{
@@ -70,6 +73,21 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	// increased log level, this triggers a lot
 	logger.V(4).Info("Reconciling cluster, cleaning old bundledeployments and updating status", "oldDisplay", cluster.Status.Display)
 
+	if _, changed := mergeFactLabels(cluster.Labels, cluster.Status.Agent); changed {
+		logger.V(1).Info("Updating cluster labels from facts reported by the agent")
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			t := &fleet.Cluster{}
+			if err := r.Get(ctx, req.NamespacedName, t); err != nil {
+				return err
+			}
+			t.Labels, _ = mergeFactLabels(t.Labels, t.Status.Agent)
+			return r.Update(ctx, t)
+		})
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	bundleDeployments := &fleet.BundleDeploymentList{}
 	err = r.List(ctx, bundleDeployments, client.InNamespace(cluster.Status.Namespace))
 	if err != nil {
@@ -188,6 +206,29 @@ func (r *ClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		// removed? This relies on bundledeployments and gitrepos to
 		// update its status. It also needs to trigger on
 		// cluster.Status.Namespace to create the namespace.
+		Watches(
+			// Fan out from cluster group to its current and previous
+			// members, to clean up the bundledeployments of clusters
+			// removed from the group
+			&fleet.ClusterGroup{},
+			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, a client.Object) []ctrl.Request {
+				clusters, err := clusterGroupMembers(ctx, r.Client, a.(*fleet.ClusterGroup))
+				if err != nil {
+					return nil
+				}
+				requests := make([]ctrl.Request, 0, len(clusters))
+				for _, cluster := range clusters {
+					requests = append(requests, ctrl.Request{
+						NamespacedName: types.NamespacedName{
+							Namespace: cluster.Namespace,
+							Name:      cluster.Name,
+						},
+					})
+				}
+				return requests
+			}),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
 		Complete(r)
 }
 
@@ -0,0 +1,100 @@
+package reconciler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+
+	"github.com/rancher/fleet/internal/name"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// labelNameMaxLength is the maximum length of the name part of a label key.
+const labelNameMaxLength = 63
+
+var invalidLabelNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// factLabels returns the reserved labels, which mirror the facts reported by
+// the agent in the cluster's status (pure function)
+func factLabels(agent fleet.AgentStatus) map[string]string {
+	labels := map[string]string{}
+
+	if v, err := semver.NewVersion(agent.KubernetesVersion); err == nil {
+		labels[fleet.ClusterKubernetesVersionLabel] = fmt.Sprintf("%d.%d.%d", v.Major(), v.Minor(), v.Patch())
+		labels[fleet.ClusterKubernetesMinorVersionLabel] = fmt.Sprintf("%d.%d", v.Major(), v.Minor())
+	}
+
+	if agent.Distribution != "" {
+		labels[fleet.ClusterDistributionLabel] = agent.Distribution
+	}
+
+	for _, arch := range agent.Architectures {
+		labels[labelKey(fleet.ClusterArchLabelPrefix, arch)] = "true"
+	}
+
+	for _, os := range agent.OperatingSystems {
+		labels[labelKey(fleet.ClusterOSLabelPrefix, os)] = "true"
+	}
+
+	for _, l := range agent.NodeLabels {
+		if len(validation.IsValidLabelValue(l.Value)) > 0 {
+			continue
+		}
+		labels[labelKey(fleet.ClusterNodeLabelPrefix, strings.ReplaceAll(l.Name, "/", "_"))] = l.Value
+	}
+
+	return labels
+}
+
+// labelKey builds a valid label key from the prefix and the suffix, by
+// replacing invalid characters and limiting the length of the name.
+func labelKey(prefix, suffix string) string {
+	domain, namePrefix, _ := strings.Cut(prefix, "/")
+	n := namePrefix + invalidLabelNameChars.ReplaceAllString(suffix, "-")
+	n = strings.TrimRight(name.Limit(n, labelNameMaxLength), "-_.")
+	return domain + "/" + n
+}
+
+// isFactLabel returns true if the label key is reserved for facts reported
+// by the agent.
+func isFactLabel(key string) bool {
+	switch key {
+	case fleet.ClusterKubernetesVersionLabel, fleet.ClusterKubernetesMinorVersionLabel, fleet.ClusterDistributionLabel:
+		return true
+	}
+	return strings.HasPrefix(key, fleet.ClusterArchLabelPrefix) ||
+		strings.HasPrefix(key, fleet.ClusterOSLabelPrefix) ||
+		strings.HasPrefix(key, fleet.ClusterNodeLabelPrefix)
+}
+
+// mergeFactLabels replaces the reserved fact labels in labels with the
+// desired ones and returns the result and whether it differs from labels
+// (pure function)
+func mergeFactLabels(labels map[string]string, agent fleet.AgentStatus) (map[string]string, bool) {
+	desired := factLabels(agent)
+	result := make(map[string]string, len(labels)+len(desired))
+	changed := false
+
+	for k, v := range labels {
+		if !isFactLabel(k) {
+			result[k] = v
+			continue
+		}
+		if dv, ok := desired[k]; !ok || dv != v {
+			changed = true
+		}
+	}
+
+	for k, v := range desired {
+		if existing, ok := labels[k]; !ok || existing != v {
+			changed = true
+		}
+		result[k] = v
+	}
+
+	return result, changed
+}
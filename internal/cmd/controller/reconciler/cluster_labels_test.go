@@ -0,0 +1,56 @@
+package reconciler
+
+import (
+	"reflect"
+	"testing"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+)
+
+func TestMergeFactLabels(t *testing.T) {
+	agent := fleet.AgentStatus{
+		KubernetesVersion: "v1.28.5+k3s1",
+		Distribution:      "k3s",
+		Architectures:     []string{"amd64", "arm64"},
+		OperatingSystems:  []string{"linux"},
+		NodeLabels: []fleet.NodeLabel{
+			{Name: "topology.kubernetes.io/region", Value: "eu-west"},
+		},
+	}
+
+	existing := map[string]string{
+		"env":                          "prod",
+		"fleet.cattle.io/arch-s390x":   "true",
+		fleet.ClusterDistributionLabel: "rke2",
+	}
+
+	labels, changed := mergeFactLabels(existing, agent)
+	if !changed {
+		t.Fatal("expected labels to change")
+	}
+
+	expected := map[string]string{
+		"env":                                "prod",
+		"fleet.cattle.io/kubernetes-version": "1.28.5",
+		"fleet.cattle.io/kubernetes-minor-version":                 "1.28",
+		"fleet.cattle.io/distribution":                             "k3s",
+		"fleet.cattle.io/arch-amd64":                               "true",
+		"fleet.cattle.io/arch-arm64":                               "true",
+		"fleet.cattle.io/os-linux":                                 "true",
+		"fleet.cattle.io/node-label-topology.kubernetes.io_region": "eu-west",
+	}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+
+	if _, changed := mergeFactLabels(labels, agent); changed {
+		t.Fatal("expected labels to be unchanged")
+	}
+}
+
+func TestLabelKeyIsLimited(t *testing.T) {
+	key := labelKey(fleet.ClusterNodeLabelPrefix, "example.com/a-very-long-label-name-which-exceeds-the-limit-of-label-names")
+	if len(key) > len("fleet.cattle.io/")+labelNameMaxLength {
+		t.Fatalf("label key %s is too long", key)
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 
+	"github.com/rancher/fleet/internal/cmd/controller/target/matcher"
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -98,3 +100,32 @@ func (r *ClusterGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		).
 		Complete(r)
 }
+
+// clusterGroupMembers returns the current members of the cluster group and
+// the previous members, which are still listed in its status, so clusters
+// removed from the group are reconciled, too.
+func clusterGroupMembers(ctx context.Context, c client.Reader, cg *fleet.ClusterGroup) ([]fleet.Cluster, error) {
+	cgs := &fleet.ClusterGroupList{}
+	if err := c.List(ctx, cgs, client.InNamespace(cg.Namespace)); err != nil {
+		return nil, err
+	}
+	groups := make([]*fleet.ClusterGroup, 0, len(cgs.Items))
+	for i := range cgs.Items {
+		groups = append(groups, &cgs.Items[i])
+	}
+	members := matcher.NewClusterGroups(groups)
+
+	clusters := &fleet.ClusterList{}
+	if err := c.List(ctx, clusters, client.InNamespace(cg.Namespace)); err != nil {
+		return nil, err
+	}
+
+	var result []fleet.Cluster
+	for _, cluster := range clusters.Items {
+		cluster := cluster
+		if ok, _ := members.Contains(cg.Name, &cluster); ok || slices.Contains(cg.Status.Clusters, cluster.Name) {
+			result = append(result, cluster)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,48 @@
+package reconciler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestClusterGroupMembers(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := fleet.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := func(name, env string) *fleet.Cluster {
+		return &fleet.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "fleet-default", Labels: map[string]string{"env": env}}}
+	}
+	// the group's selector changed from env=dev to env=prod, its status
+	// still lists the previous member
+	cg := &fleet.ClusterGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "group", Namespace: "fleet-default"},
+		Spec: fleet.ClusterGroupSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+		},
+		Status: fleet.ClusterGroupStatus{Clusters: []string{"dev"}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(cg, cluster("dev", "dev"), cluster("prod", "prod"), cluster("test", "test")).
+		Build()
+
+	clusters, err := clusterGroupMembers(context.Background(), c, cg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, cluster := range clusters {
+		names = append(names, cluster.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"dev", "prod"}) {
+		t.Errorf("expected current and previous members, got %v", names)
+	}
+}
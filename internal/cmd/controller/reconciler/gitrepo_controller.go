@@ -25,6 +25,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -107,6 +108,11 @@ func (r *GitRepoReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 
 	grutil.SetStatusFromResourceKey(ctx, r.Client, gitrepo)
 
+	err = grutil.SetFrozenCondition(ctx, r.Client, gitrepo)
+	if err != nil {
+		return ctrl.Result{}, r.updateErrorStatus(ctx, req.NamespacedName, gitrepo.Status, err)
+	}
+
 	gitrepo.Status.Display.ReadyBundleDeployments = fmt.Sprintf("%d/%d",
 		gitrepo.Status.Summary.Ready,
 		gitrepo.Status.Summary.DesiredReady)
@@ -235,16 +241,41 @@ func (r *GitRepoReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			}),
 		).
 		WithEventFilter(
-			// do not trigger for status changes
+			// do not trigger for status changes, except for a bundle
+			// being frozen or unfrozen
 			predicate.Or(
 				predicate.GenerationChangedPredicate{},
 				predicate.AnnotationChangedPredicate{},
 				predicate.LabelChangedPredicate{},
+				bundleFrozenChangedPredicate(),
 			),
 		).
 		Complete(r)
 }
 
+// bundleFrozenChangedPredicate triggers, if a bundle's frozen condition
+// changed
+func bundleFrozenChangedPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return false },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			n, ok := e.ObjectNew.(*fleet.Bundle)
+			if !ok {
+				return false
+			}
+			o, ok := e.ObjectOld.(*fleet.Bundle)
+			if !ok {
+				return false
+			}
+			cond := condition.Cond(fleet.BundleConditionFrozen)
+			return cond.GetStatus(&n.Status) != cond.GetStatus(&o.Status) ||
+				cond.GetMessage(&n.Status) != cond.GetMessage(&o.Status)
+		},
+	}
+}
+
 func purgeBundles(ctx context.Context, c client.Client, gitrepo types.NamespacedName) error {
 	bundles := &fleet.BundleList{}
 	err := c.List(ctx, bundles, client.MatchingLabels{fleet.RepoLabel: gitrepo.Name}, client.InNamespace(gitrepo.Namespace))
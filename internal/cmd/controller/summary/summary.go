@@ -134,6 +134,12 @@ func MessageFromDeployment(deployment *fleet.BundleDeployment) string {
 	if message == "" {
 		message = MessageFromCondition("Monitored", deployment.Status.Conditions)
 	}
+	if message == "" {
+		message = MessageFromCondition(fleet.BundleDeploymentConditionPostDeployHooks, deployment.Status.Conditions)
+	}
+	if message == "" {
+		message = MessageFromCondition(fleet.BundleDeploymentConditionVerified, deployment.Status.Conditions)
+	}
 	return message
 }
 
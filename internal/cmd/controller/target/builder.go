@@ -4,17 +4,25 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"path/filepath"
 	"sort"
 	"strings"
 	"text/template"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/Masterminds/sprig/v3"
 	"github.com/go-logr/logr"
 
+	"github.com/rancher/fleet/internal/bundlereader"
 	"github.com/rancher/fleet/internal/cmd/controller/options"
 	"github.com/rancher/fleet/internal/cmd/controller/target/matcher"
+	"github.com/rancher/fleet/internal/content"
+	"github.com/rancher/fleet/internal/fleetyaml"
+	"github.com/rancher/fleet/internal/manifest"
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 
+	"github.com/rancher/wrangler/v2/pkg/data"
 	"github.com/rancher/wrangler/v2/pkg/yaml"
 
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -37,25 +45,49 @@ func New(client client.Client) *Manager {
 //
 // The returned target structs contain merged BundleDeploymentOptions.
 // Finally all existing bundledeployments are added to the targets.
-func (m *Manager) Targets(ctx context.Context, bundle *fleet.Bundle, manifestID string) ([]*Target, error) {
+// Additionally the targeting outcome for every cluster in these namespaces is
+// returned, which explains why a cluster is, or is not, deployed to.
+func (m *Manager) Targets(ctx context.Context, bundle *fleet.Bundle, manifestID string) ([]*Target, []Outcome, error) {
 	logger := log.FromContext(ctx).WithName("targets")
 
 	bm, err := matcher.New(bundle)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	namespaces, err := m.getNamespacesForBundle(ctx, bundle)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	freezes, err := m.deploymentFreezes(ctx, bundle, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dependencyHold, err := m.clusterDependencyHold(ctx, bundle)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	var targets []*Target
+	var (
+		targets  []*Target
+		outcomes []Outcome
+	)
 	for _, namespace := range namespaces {
 		clusters := &fleet.ClusterList{}
 		err := m.client.List(ctx, clusters, client.InNamespace(namespace))
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+
+		var windows []fleet.MaintenanceWindow
+		if bundle.Annotations[fleet.IgnoreMaintenanceWindowsAnnotation] != "true" {
+			windows, err = m.maintenanceWindows(ctx, namespace)
+			if err != nil {
+				return nil, nil, err
+			}
 		}
 
 		for _, cluster := range clusters.Items {
@@ -63,33 +95,87 @@ func (m *Manager) Targets(ctx context.Context, bundle *fleet.Bundle, manifestID
 			logger.V(4).Info("Cluster has namespace?", "cluster", cluster.Name, "namespace", cluster.Status.Namespace)
 			clusterGroups, err := m.clusterGroupsForCluster(ctx, &cluster)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
+			outcome := Outcome{Cluster: &cluster, ClusterGroups: clusterGroups}
+
 			target := bm.Match(cluster.Name, clusterGroupsToLabelMap(clusterGroups), cluster.Labels)
+			// check if there is any matching targetCustomization that should be applied
+			targetCustomized := bm.MatchTargetCustomizations(cluster.Name, clusterGroupsToLabelMap(clusterGroups), cluster.Labels)
 			if target == nil {
+				// without restrictions a target matched, so the
+				// restrictions must have excluded the cluster
+				if notSampled := bm.MatchNotSampled(cluster.Name, clusterGroupsToLabelMap(clusterGroups), cluster.Labels); notSampled != nil {
+					outcome.Result = fleet.TargetingNotSampled
+					outcome.Message = fmt.Sprintf("cluster is not part of the %d%% sample of target %q", notSampled.Sample.Percent, notSampled.Name)
+				} else if targetCustomized != nil {
+					outcome.Result = fleet.TargetingRestricted
+					outcome.Message = fmt.Sprintf("target %q matched, but the cluster is not allowed by the target restrictions", targetCustomized.Name)
+				} else {
+					outcome.Result = fleet.TargetingNoMatch
+				}
+				outcomes = append(outcomes, outcome)
 				continue
 			}
-			// check if there is any matching targetCustomization that should be applied
 			targetOpts := target.BundleDeploymentOptions
-			targetCustomized := bm.MatchTargetCustomizations(cluster.Name, clusterGroupsToLabelMap(clusterGroups), cluster.Labels)
+			targetName := target.Name
+			outcome.Target = target.Name
 			if targetCustomized != nil {
+				outcome.TargetCustomization = targetCustomized.Name
 				if targetCustomized.DoNotDeploy {
 					logger.V(1).Info("BundleDeployment creation for Bundle was skipped because doNotDeploy is set to true.")
+					outcome.Result = fleet.TargetingDoNotDeploy
+					outcomes = append(outcomes, outcome)
 					continue
 				}
 				targetOpts = targetCustomized.BundleDeploymentOptions
+				targetName = targetCustomized.Name
+			}
+
+			if reason := unmetRequirement(bundle.Spec.Requires, &cluster); reason != "" {
+				logger.V(1).Info("Skipping cluster with unmet requirement", "cluster", cluster.Name, "reason", reason)
+				outcome.Result = fleet.TargetingUnmetRequirement
+				outcome.Message = reason
+				outcomes = append(outcomes, outcome)
+				continue
 			}
 
 			opts := options.Merge(bundle.Spec.BundleDeploymentOptions, targetOpts)
-			err = preprocessHelmValues(logger, &opts, &cluster)
+			tplCtx := templateContext(&cluster, clusterGroups, bundle, targetName)
+			err = preprocessHelmValues(logger, &opts, &cluster, tplCtx)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
+			}
+
+			// raw YAML and kustomize resources are rendered per cluster,
+			// which results in a separate manifest for each target
+			var targetManifest *manifest.Manifest
+			targetManifestID := manifestID
+			if opts.YAML != nil && opts.YAML.Template != nil && *opts.YAML.Template {
+				targetManifest, err = templateResources(manifest.FromBundle(bundle), opts, tplCtx)
+				if err != nil {
+					return nil, nil, err
+				}
+				targetManifestID, err = targetManifest.ID()
+				if err != nil {
+					return nil, nil, err
+				}
 			}
 
-			deploymentID, err := options.DeploymentID(manifestID, opts)
+			deploymentID, err := options.DeploymentID(targetManifestID, opts)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
+			}
+
+			// a deployment freeze applies regardless of the
+			// maintenance windows
+			hold := freezeHold(ctx, freezes, &cluster)
+			if hold == nil {
+				hold = dependencyHold
+			}
+			if hold == nil {
+				hold = maintenanceHold(ctx, windows, &cluster, clusterGroups, now)
 			}
 
 			targets = append(targets, &Target{
@@ -98,7 +184,20 @@ func (m *Manager) Targets(ctx context.Context, bundle *fleet.Bundle, manifestID
 				Bundle:        bundle,
 				Options:       opts,
 				DeploymentID:  deploymentID,
+				Manifest:      targetManifest,
+				Hold:          hold,
 			})
+
+			outcome.Result = fleet.TargetingMatched
+			outcome.Sampled = target.Sample != nil || targetCustomized != nil && targetCustomized.Sample != nil
+			if outcome.Sampled {
+				outcome.Message = "cluster is part of the sample of the matching target"
+			}
+			if cluster.Status.Namespace == "" {
+				outcome.Result = fleet.TargetingWaitingForNamespace
+				outcome.Message = "waiting for agentmanagement to set cluster.status.namespace"
+			}
+			outcomes = append(outcomes, outcome)
 		}
 	}
 
@@ -106,7 +205,14 @@ func (m *Manager) Targets(ctx context.Context, bundle *fleet.Bundle, manifestID
 		return targets[i].Cluster.Name < targets[j].Cluster.Name
 	})
 
-	return targets, m.foldInDeployments(ctx, bundle, targets)
+	sort.Slice(outcomes, func(i, j int) bool {
+		if outcomes[i].Cluster.Namespace != outcomes[j].Cluster.Namespace {
+			return outcomes[i].Cluster.Namespace < outcomes[j].Cluster.Namespace
+		}
+		return outcomes[i].Cluster.Name < outcomes[j].Cluster.Name
+	})
+
+	return targets, outcomes, m.foldInDeployments(ctx, bundle, targets)
 }
 
 // getNamespacesForBundle returns the namespaces that bundledeployments could
@@ -168,15 +274,8 @@ func (m *Manager) foldInDeployments(ctx context.Context, bundle *fleet.Bundle, t
 	return nil
 }
 
-func preprocessHelmValues(logger logr.Logger, opts *fleet.BundleDeploymentOptions, cluster *fleet.Cluster) (err error) {
-	clusterLabels := yaml.CleanAnnotationsForExport(cluster.Labels)
-	clusterAnnotations := yaml.CleanAnnotationsForExport(cluster.Annotations)
-
-	for k, v := range cluster.Labels {
-		if strings.HasPrefix(k, "fleet.cattle.io/") || strings.HasPrefix(k, "management.cattle.io/") {
-			clusterLabels[k] = v
-		}
-	}
+func preprocessHelmValues(logger logr.Logger, opts *fleet.BundleDeploymentOptions, cluster *fleet.Cluster, templateContext map[string]interface{}) (err error) {
+	clusterLabels := templateLabels(cluster.Labels)
 	if len(clusterLabels) == 0 {
 		return nil
 	}
@@ -199,20 +298,7 @@ func preprocessHelmValues(logger logr.Logger, opts *fleet.BundleDeploymentOption
 	}
 
 	if !opts.Helm.DisablePreProcess {
-		templateValues := map[string]interface{}{}
-		if cluster.Spec.TemplateValues != nil {
-			templateValues = cluster.Spec.TemplateValues.Data
-		}
-
-		values := map[string]interface{}{
-			"ClusterNamespace":   cluster.Namespace,
-			"ClusterName":        cluster.Name,
-			"ClusterLabels":      toDict(clusterLabels),
-			"ClusterAnnotations": toDict(clusterAnnotations),
-			"ClusterValues":      templateValues,
-		}
-
-		opts.Helm.Values.Data, err = processTemplateValues(opts.Helm.Values.Data, values)
+		opts.Helm.Values.Data, err = processTemplateValues(opts.Helm.Values.Data, templateContext)
 		if err != nil {
 			return err
 		}
@@ -223,6 +309,82 @@ func preprocessHelmValues(logger logr.Logger, opts *fleet.BundleDeploymentOption
 
 }
 
+// templateLabels returns the cluster labels available to templates. Like
+// annotations, labels of kubernetes and other tools are removed, but the
+// fleet and management labels are kept (pure function)
+func templateLabels(labels map[string]string) map[string]string {
+	result := yaml.CleanAnnotationsForExport(labels)
+	for k, v := range labels {
+		if strings.HasPrefix(k, "fleet.cattle.io/") || strings.HasPrefix(k, "management.cattle.io/") {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// templateContext returns the values available to templates, which are
+// rendered for the cluster. Besides the cluster's metadata and template
+// values, it contains the cluster groups the cluster belongs to and their
+// merged template values, the status reported by the cluster's agent, the
+// bundle's metadata and the name of the target, which matched the cluster.
+func templateContext(cluster *fleet.Cluster, clusterGroups []*fleet.ClusterGroup, bundle *fleet.Bundle, targetName string) map[string]interface{} {
+	clusterLabels := templateLabels(cluster.Labels)
+	clusterAnnotations := yaml.CleanAnnotationsForExport(cluster.Annotations)
+
+	templateValues := map[string]interface{}{}
+	if cluster.Spec.TemplateValues != nil {
+		templateValues = cluster.Spec.TemplateValues.Data
+	}
+
+	groups := make(map[string]interface{}, len(clusterGroups))
+	for _, cg := range clusterGroups {
+		groups[cg.Name] = toDict(cg.Labels)
+	}
+
+	agent := cluster.Status.Agent
+	return map[string]interface{}{
+		"ClusterNamespace":   cluster.Namespace,
+		"ClusterName":        cluster.Name,
+		"ClusterLabels":      toDict(clusterLabels),
+		"ClusterAnnotations": toDict(clusterAnnotations),
+		"ClusterValues":      templateValues,
+		"ClusterGroups":      groups,
+		"ClusterGroupValues": clusterGroupValues(clusterGroups),
+		"AgentStatus": map[string]interface{}{
+			"KubernetesVersion": agent.KubernetesVersion,
+			"Distribution":      agent.Distribution,
+			"Architectures":     agent.Architectures,
+			"OperatingSystems":  agent.OperatingSystems,
+			"ReadyNodes":        agent.ReadyNodes,
+			"NonReadyNodes":     agent.NonReadyNodes,
+		},
+		"BundleName":      bundle.Name,
+		"BundleNamespace": bundle.Namespace,
+		"BundleCommit":    bundle.Labels[fleet.CommitLabel],
+		"GitRepoName":     bundle.Labels[fleet.RepoLabel],
+		"TargetName":      targetName,
+	}
+}
+
+// clusterGroupValues merges the template values of the cluster groups in
+// alphabetical order of their names, values from later groups take precedence.
+func clusterGroupValues(clusterGroups []*fleet.ClusterGroup) map[string]interface{} {
+	sorted := make([]*fleet.ClusterGroup, len(clusterGroups))
+	copy(sorted, clusterGroups)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	values := map[string]interface{}{}
+	for _, cg := range sorted {
+		if cg.Spec.TemplateValues == nil {
+			continue
+		}
+		values = data.MergeMaps(values, cg.Spec.TemplateValues.Data)
+	}
+	return values
+}
+
 // sprig dictionary functions like "default" and "hasKey" expect map[string]interface{}
 func toDict(values map[string]string) map[string]interface{} {
 	dict := make(map[string]interface{}, len(values))
@@ -272,7 +434,8 @@ func processLabelValues(logger logr.Logger, valuesMap map[string]interface{}, cl
 	return nil
 }
 
-// tplFuncMap returns a mapping of all of the functions from sprig but removes potentially dangerous operations
+// tplFuncMap returns a mapping of all of the functions from sprig but removes potentially dangerous operations.
+// It adds a few helpers, which are useful when templating Kubernetes resources.
 func tplFuncMap() template.FuncMap {
 	f := sprig.TxtFuncMap()
 	delete(f, "env")
@@ -280,9 +443,48 @@ func tplFuncMap() template.FuncMap {
 	delete(f, "include")
 	delete(f, "tpl")
 
+	f["toYaml"] = toYaml
+	f["kubeVersionCompare"] = kubeVersionCompare
+
 	return f
 }
 
+// toYaml marshals the value to YAML, it returns an empty string on errors, like helm's toYaml
+func toYaml(v interface{}) string {
+	data, err := kyaml.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+// kubeVersionCompare checks a Kubernetes version against a semver
+// constraint. Other than sprig's semverCompare, it ignores pre-release and
+// build information, so vendor versions like "v1.28.5-eks-5e0fdde" or
+// "v1.28.5+k3s1" satisfy ">=1.28".
+func kubeVersionCompare(constraint, version string) (bool, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false, err
+	}
+
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	core, err := v.SetPrerelease("")
+	if err != nil {
+		return false, err
+	}
+	core, err = core.SetMetadata("")
+	if err != nil {
+		return false, err
+	}
+
+	return c.Check(&core), nil
+}
+
 func processTemplateValues(helmValues map[string]interface{}, templateContext map[string]interface{}) (map[string]interface{}, error) {
 	data, err := kyaml.Marshal(helmValues)
 	if err != nil {
@@ -313,3 +515,59 @@ func processTemplateValues(helmValues map[string]interface{}, templateContext ma
 
 	return renderedValues, nil
 }
+
+// templateResources renders the raw YAML and kustomize resources of the
+// manifest with the template context and returns them as a new manifest.
+// Resources which are part of a helm chart are not modified.
+func templateResources(m *manifest.Manifest, opts fleet.BundleDeploymentOptions, templateContext map[string]interface{}) (*manifest.Manifest, error) {
+	style := bundlereader.DetermineStyle(m, opts)
+	chartDir := ""
+	if style.IsHelm() {
+		chartDir = filepath.Dir(style.ChartPath)
+	}
+
+	resources := make([]fleet.BundleResource, 0, len(m.Resources))
+	for _, resource := range m.Resources {
+		if !isTemplatedResource(resource.Name, chartDir) {
+			resources = append(resources, resource)
+			continue
+		}
+
+		data, err := content.Decode(resource.Content, resource.Encoding)
+		if err != nil {
+			return nil, err
+		}
+
+		tmpl := template.New(resource.Name).Funcs(tplFuncMap()).Option("missingkey=error").Delims("${", "}")
+		tmpl, err = tmpl.Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse resource %s as template: %w", resource.Name, err)
+		}
+
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, templateContext); err != nil {
+			return nil, fmt.Errorf("failed to render resource %s: %w", resource.Name, err)
+		}
+
+		resources = append(resources, fleet.BundleResource{
+			Name:    resource.Name,
+			Content: b.String(),
+		})
+	}
+
+	return manifest.New(resources), nil
+}
+
+// isTemplatedResource returns true if the resource is a YAML or JSON file,
+// which is neither a fleet.yaml nor part of the chart in chartDir.
+func isTemplatedResource(name string, chartDir string) bool {
+	if name == "" || fleetyaml.IsFleetYaml(name) || fleetyaml.IsFleetYamlSuffix(name) {
+		return false
+	}
+	if chartDir == "." || (chartDir != "" && strings.HasPrefix(name, chartDir+"/")) {
+		return false
+	}
+	return strings.HasSuffix(name, ".yaml") ||
+		strings.HasSuffix(name, ".yml") ||
+		strings.HasSuffix(name, ".json")
+}
@@ -0,0 +1,138 @@
+package target
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rancher/fleet/internal/dependency"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/condition"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// IsClusterDependency returns true if the reference refers to a bundle
+// deployed to other clusters (pure function)
+func IsClusterDependency(ref fleet.BundleRef) bool {
+	return ref.ClusterName != "" || ref.ClusterSelector != nil
+}
+
+// clusterDependencyHold returns a pending status, if a bundle the bundle
+// depends on is not ready on one of the referenced clusters. These
+// dependencies apply to all targets of the bundle.
+func (m *Manager) clusterDependencyHold(ctx context.Context, bundle *fleet.Bundle) (*fleet.PendingStatus, error) {
+	var waiting []string
+	for _, ref := range bundle.Spec.DependsOn {
+		// skip references without a bundle, like the agent does
+		if !IsClusterDependency(ref) || ref.Name == "" && ref.Selector == nil {
+			continue
+		}
+
+		clusters, err := m.referencedClusters(ctx, bundle.Namespace, ref)
+		if err != nil {
+			return nil, err
+		}
+		if len(clusters) == 0 {
+			waiting = append(waiting, "no cluster found for dependency "+describeClusterDependency(ref))
+			continue
+		}
+
+		selector, err := dependency.Selector(ref, bundle.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, cluster := range clusters {
+			reason, err := m.clusterDependencyReady(ctx, cluster, selector)
+			if err != nil {
+				return nil, err
+			}
+			if reason != "" {
+				waiting = append(waiting, fmt.Sprintf("cluster %s: %s", cluster.Name, reason))
+			}
+		}
+	}
+
+	if len(waiting) == 0 {
+		return nil, nil
+	}
+
+	return &fleet.PendingStatus{
+		Reason:  fleet.PendingReasonClusterDependency,
+		Message: "waiting for dependencies on other clusters: " + strings.Join(waiting, "; "),
+	}, nil
+}
+
+// referencedClusters returns the clusters in the namespace, which are
+// referenced by the dependency, sorted by name
+func (m *Manager) referencedClusters(ctx context.Context, namespace string, ref fleet.BundleRef) ([]fleet.Cluster, error) {
+	if ref.ClusterName != "" {
+		cluster := &fleet.Cluster{}
+		err := m.client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.ClusterName}, cluster)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		} else if err != nil {
+			return nil, nil
+		}
+		return []fleet.Cluster{*cluster}, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(ref.ClusterSelector)
+	if err != nil {
+		return nil, err
+	}
+	clusters := &fleet.ClusterList{}
+	if err := m.client.List(ctx, clusters, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	sort.Slice(clusters.Items, func(i, j int) bool {
+		return clusters.Items[i].Name < clusters.Items[j].Name
+	})
+	return clusters.Items, nil
+}
+
+// clusterDependencyReady returns why the bundledeployments matching the
+// selector on the cluster are not ready, or an empty string if they are
+func (m *Manager) clusterDependencyReady(ctx context.Context, cluster fleet.Cluster, selector labels.Selector) (string, error) {
+	if cluster.Status.Namespace == "" {
+		return "waiting for agentmanagement to set cluster.status.namespace", nil
+	}
+
+	bds := &fleet.BundleDeploymentList{}
+	err := m.client.List(ctx, bds, client.InNamespace(cluster.Status.Namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return "", err
+	}
+	if len(bds.Items) == 0 {
+		return fmt.Sprintf("no bundle matching labels %s is deployed", selector.String()), nil
+	}
+
+	var unready []string
+	for _, bd := range bds.Items {
+		if !condition.Cond(fleet.BundleDeploymentConditionReady).IsTrue(&bd) {
+			unready = append(unready, bd.Labels[fleet.BundleLabel])
+		}
+	}
+	if len(unready) > 0 {
+		sort.Strings(unready)
+		return fmt.Sprintf("bundle %s is not ready", strings.Join(unready, ", ")), nil
+	}
+	return "", nil
+}
+
+// describeClusterDependency returns a human readable description of the
+// referenced clusters
+func describeClusterDependency(ref fleet.BundleRef) string {
+	if ref.ClusterName != "" {
+		return "on cluster " + ref.ClusterName
+	}
+	selector, err := metav1.LabelSelectorAsSelector(ref.ClusterSelector)
+	if err != nil {
+		return "on clusters matching an invalid selector"
+	}
+	return "on clusters matching " + selector.String()
+}
@@ -0,0 +1,148 @@
+package target
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rancher/fleet/internal/cmd/controller/summary"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/condition"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var (
+	// a single failing cluster, e.g. one which is temporarily
+	// unreachable, does not roll back a rollout
+	defMaxFailures      = intstr.FromString("10%")
+	defEvaluationWindow = 5 * time.Minute
+)
+
+// ApplyFailurePolicy evaluates the bundle's failure policy. It records the
+// last known good deployment of every target. If more targets failed to
+// deploy the new version than allowed, the rollout of the bundle's generation
+// is halted and the targets are reverted to their known good deployment (does
+// mutate targets and status).
+func ApplyFailurePolicy(status *fleet.BundleStatus, bundle *fleet.Bundle, targets []*Target) error {
+	if bundle.Spec.RolloutStrategy == nil || bundle.Spec.RolloutStrategy.FailurePolicy == nil {
+		return nil
+	}
+	policy := bundle.Spec.RolloutStrategy.FailurePolicy
+
+	now := time.Now()
+	if status.RolloutStarted == nil || status.ObservedGeneration != bundle.Generation {
+		status.RolloutStarted = &metav1.Time{Time: now}
+	}
+
+	for _, target := range targets {
+		recordKnownGood(target)
+	}
+
+	cond := condition.Cond(fleet.BundleConditionRolledBack)
+	if status.RolledBackGeneration == bundle.Generation {
+		// keep the rollout halted, also for targets, which were
+		// updated while the rollback happened
+		for _, target := range targets {
+			revert(target)
+		}
+		return nil
+	}
+
+	window := defEvaluationWindow
+	if policy.EvaluationWindow != nil {
+		window = policy.EvaluationWindow.Duration
+	}
+	evaluateNotReady := now.After(status.RolloutStarted.Add(window))
+
+	var failed []string
+	for _, target := range targets {
+		if isFailed(target, evaluateNotReady) {
+			failed = append(failed, target.Cluster.Namespace+"/"+target.Cluster.Name)
+		}
+	}
+
+	maxFailures, err := maxFailures(len(targets), policy.MaxFailures)
+	if err != nil {
+		return err
+	}
+
+	if len(failed) <= maxFailures {
+		if cond.GetStatus(status) != "" {
+			// a previous generation was rolled back
+			cond.SetStatusBool(status, false)
+			cond.Message(status, "")
+		}
+		return nil
+	}
+
+	for _, target := range targets {
+		revert(target)
+	}
+	status.RolledBackGeneration = bundle.Generation
+
+	count := len(failed)
+	if len(failed) > 10 {
+		failed = append(failed[:10], "...")
+	}
+	cond.SetStatusBool(status, true)
+	cond.Message(status, fmt.Sprintf("rolled back generation %d, after %d clusters failed: %s", bundle.Generation, count, strings.Join(failed, ", ")))
+
+	return nil
+}
+
+// maxFailures returns the number of targets, which may fail (pure function)
+func maxFailures(count int, val *intstr.IntOrString) (int, error) {
+	if val == nil {
+		val = &defMaxFailures
+	}
+	if val.Type == intstr.Int {
+		return val.IntValue(), nil
+	}
+	// limit returns at least one for percentages
+	return limit(count, val)
+}
+
+// isFailed returns true if the target received the new deployment and failed
+// to apply it, or is still not ready after the evaluation window (pure function)
+func isFailed(target *Target, evaluateNotReady bool) bool {
+	if target.Deployment == nil || target.Deployment.Spec.DeploymentID != target.DeploymentID {
+		return false
+	}
+
+	switch summary.GetDeploymentState(target.Deployment) {
+	case fleet.ErrApplied:
+		return true
+	case fleet.NotReady:
+		return evaluateNotReady
+	}
+
+	return false
+}
+
+// recordKnownGood stores the target's current deployment as known good, if it
+// was applied and is ready (mutates target)
+func recordKnownGood(target *Target) {
+	bd := target.Deployment
+	if bd == nil || bd.Spec.DeploymentID == "" {
+		return
+	}
+	if bd.Status.AppliedDeploymentID == bd.Spec.DeploymentID && bd.Status.Ready {
+		bd.Spec.KnownGoodDeploymentID = bd.Spec.DeploymentID
+		bd.Spec.KnownGoodOptions = bd.Spec.Options.DeepCopy()
+	}
+}
+
+// revert resets the target's deployment to the known good deployment, if it
+// received the new deployment (mutates target)
+func revert(target *Target) {
+	bd := target.Deployment
+	if bd == nil || bd.Spec.KnownGoodDeploymentID == "" || bd.Spec.KnownGoodOptions == nil || bd.Spec.DeploymentID != target.DeploymentID ||
+		bd.Spec.DeploymentID == bd.Spec.KnownGoodDeploymentID {
+		return
+	}
+	bd.Spec.DeploymentID = bd.Spec.KnownGoodDeploymentID
+	bd.Spec.Options = *bd.Spec.KnownGoodOptions.DeepCopy()
+}
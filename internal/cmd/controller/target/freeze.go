@@ -0,0 +1,173 @@
+package target
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/condition"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// deploymentFreezes returns the deployment freezes, which are active at the
+// given time and select the bundle. Freezes with invalid selectors are logged
+// and ignored.
+func (m *Manager) deploymentFreezes(ctx context.Context, bundle *fleet.Bundle, now time.Time) ([]fleet.DeploymentFreeze, error) {
+	logger := log.FromContext(ctx).WithName("deployment-freeze")
+
+	freezes := &fleet.DeploymentFreezeList{}
+	if err := m.client.List(ctx, freezes); err != nil {
+		return nil, err
+	}
+
+	var (
+		result   []fleet.DeploymentFreeze
+		nsLabels map[string]string
+	)
+	for _, freeze := range freezes.Items {
+		if !freezeActive(freeze.Spec, now) {
+			continue
+		}
+
+		if freeze.Spec.NamespaceSelector != nil && nsLabels == nil {
+			ns := &corev1.Namespace{}
+			if err := m.client.Get(ctx, types.NamespacedName{Name: bundle.Namespace}, ns); err != nil {
+				return nil, err
+			}
+			nsLabels = ns.Labels
+			if nsLabels == nil {
+				nsLabels = map[string]string{}
+			}
+		}
+
+		ok, err := freezeSelectsBundle(freeze.Spec, nsLabels, bundle.Labels)
+		if err != nil {
+			logger.Error(err, "Invalid bundle selection in deployment freeze", "deploymentFreeze", freeze.Name)
+			continue
+		}
+		if ok {
+			result = append(result, freeze)
+		}
+	}
+
+	return result, nil
+}
+
+// freezeActive returns true if the freeze is active at the given time (pure
+// function)
+func freezeActive(spec fleet.DeploymentFreezeSpec, now time.Time) bool {
+	if spec.Start != nil && now.Before(spec.Start.Time) {
+		return false
+	}
+	if spec.End != nil && !now.Before(spec.End.Time) {
+		return false
+	}
+	return true
+}
+
+// freezeSelectsBundle returns true if the freeze's namespace and bundle
+// selectors match (pure function)
+func freezeSelectsBundle(spec fleet.DeploymentFreezeSpec, nsLabels, bundleLabels map[string]string) (bool, error) {
+	ok, err := selects(spec.NamespaceSelector, nsLabels)
+	if err != nil || !ok {
+		return false, err
+	}
+	return selects(spec.BundleSelector, bundleLabels)
+}
+
+// selects returns true if the selector is empty or matches the labels (pure
+// function)
+func selects(selector *metav1.LabelSelector, l map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+	return sel.Matches(labels.Set(l)), nil
+}
+
+// freezeHold returns a pending status, if one of the active freezes selects
+// the cluster. The status ends with the last of these freezes or is open
+// ended, if one of them has no end.
+func freezeHold(ctx context.Context, freezes []fleet.DeploymentFreeze, cluster *fleet.Cluster) *fleet.PendingStatus {
+	logger := log.FromContext(ctx).WithName("deployment-freeze")
+
+	var (
+		names     []string
+		reasons   []string
+		until     time.Time
+		openEnded bool
+	)
+	for _, freeze := range freezes {
+		ok, err := selects(freeze.Spec.ClusterSelector, cluster.Labels)
+		if err != nil {
+			logger.Error(err, "Invalid cluster selection in deployment freeze", "deploymentFreeze", freeze.Name)
+		}
+		if !ok {
+			continue
+		}
+
+		names = append(names, freeze.Name)
+		if freeze.Spec.Reason != "" {
+			reasons = append(reasons, freeze.Spec.Reason)
+		}
+		if freeze.Spec.End == nil {
+			openEnded = true
+		} else if freeze.Spec.End.After(until) {
+			until = freeze.Spec.End.Time
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	sort.Strings(names)
+	message := fmt.Sprintf("deployment freeze %s is active", strings.Join(names, ", "))
+	if len(reasons) > 0 {
+		sort.Strings(reasons)
+		message += ": " + strings.Join(reasons, ", ")
+	}
+	hold := &fleet.PendingStatus{
+		Reason:  fleet.PendingReasonDeploymentFreeze,
+		Message: message,
+	}
+	if !openEnded {
+		hold.Until = &metav1.Time{Time: until}
+	}
+	return hold
+}
+
+// SetFrozenCondition sets the frozen condition of the bundle, if a deployment
+// freeze holds back at least one of its targets (pure function)
+func SetFrozenCondition(status *fleet.BundleStatus, targets []*Target) {
+	var messages []string
+	seen := map[string]bool{}
+	for _, t := range targets {
+		if t.Hold == nil || t.Hold.Reason != fleet.PendingReasonDeploymentFreeze || seen[t.Hold.Message] {
+			continue
+		}
+		seen[t.Hold.Message] = true
+		messages = append(messages, t.Hold.Message)
+	}
+	sort.Strings(messages)
+
+	cond := condition.Cond(fleet.BundleConditionFrozen)
+	if len(messages) == 0 && cond.GetStatus(status) == "" {
+		// never frozen
+		return
+	}
+	cond.SetStatusBool(status, len(messages) > 0)
+	cond.Message(status, strings.Join(messages, "; "))
+}
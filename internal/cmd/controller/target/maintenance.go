@@ -0,0 +1,143 @@
+package target
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/reugn/go-quartz/quartz"
+
+	"github.com/rancher/fleet/internal/cmd/controller/target/matcher"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// maintenanceWindows returns the maintenance windows in the namespace
+func (m *Manager) maintenanceWindows(ctx context.Context, namespace string) ([]fleet.MaintenanceWindow, error) {
+	windows := &fleet.MaintenanceWindowList{}
+	if err := m.client.List(ctx, windows, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	return windows.Items, nil
+}
+
+// maintenanceHold returns a pending status, if the cluster is selected by
+// maintenance windows and none of them is open at the given time. Invalid
+// windows are logged and never open.
+func maintenanceHold(ctx context.Context, windows []fleet.MaintenanceWindow, cluster *fleet.Cluster, clusterGroups []*fleet.ClusterGroup, now time.Time) *fleet.PendingStatus {
+	logger := log.FromContext(ctx).WithName("maintenance-window")
+
+	var (
+		names []string
+		next  time.Time
+	)
+	for _, window := range windows {
+		ok, err := selectsCluster(window, cluster, clusterGroups)
+		if err != nil {
+			logger.Error(err, "Invalid cluster selection in maintenance window", "maintenanceWindow", window.Name)
+		}
+		if !ok {
+			continue
+		}
+
+		open, opens, err := windowOpen(window.Spec, now)
+		if err != nil {
+			logger.Error(err, "Invalid schedule in maintenance window", "maintenanceWindow", window.Name)
+		}
+		if open {
+			return nil
+		}
+
+		names = append(names, window.Name)
+		if !opens.IsZero() && (next.IsZero() || opens.Before(next)) {
+			next = opens
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	sort.Strings(names)
+	hold := &fleet.PendingStatus{
+		Reason:  fleet.PendingReasonMaintenanceWindow,
+		Message: fmt.Sprintf("waiting for maintenance window %s to open", strings.Join(names, ", ")),
+	}
+	if !next.IsZero() {
+		hold.Until = &metav1.Time{Time: next}
+	}
+	return hold
+}
+
+// selectsCluster returns true if the window's selectors match the cluster
+// (pure function)
+func selectsCluster(window fleet.MaintenanceWindow, cluster *fleet.Cluster, clusterGroups []*fleet.ClusterGroup) (bool, error) {
+	m, err := matcher.NewClusterMatcher(window.Spec.ClusterName, window.Spec.ClusterGroup, window.Spec.ClusterGroupSelector, window.Spec.ClusterSelector)
+	if err != nil {
+		return false, err
+	}
+
+	if len(clusterGroups) == 0 {
+		return m.Match(cluster.Name, "", nil, cluster.Labels), nil
+	}
+	for _, cg := range clusterGroups {
+		if m.Match(cluster.Name, cg.Name, cg.Labels, cluster.Labels) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// windowOpen returns true if the window is open at the given time. Otherwise
+// it returns the time the window opens next (pure function).
+func windowOpen(spec fleet.MaintenanceWindowSpec, now time.Time) (bool, time.Time, error) {
+	loc := time.UTC
+	if spec.TimeZone != "" {
+		var err error
+		loc, err = time.LoadLocation(spec.TimeZone)
+		if err != nil {
+			return false, time.Time{}, err
+		}
+	}
+
+	trigger, err := quartz.NewCronTriggerWithLoc(spec.Schedule, loc)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	// the window is open, if it opened less than its duration ago
+	opened, err := trigger.NextFireTime(now.Add(-spec.Duration.Duration).UnixNano())
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	if opened <= now.UnixNano() {
+		return true, time.Time{}, nil
+	}
+
+	return false, time.Unix(0, opened), nil
+}
+
+// HoldRequeueAfter returns the time until the first held back target, with a
+// staged deployment, may receive it, or zero if there is none (pure function)
+func HoldRequeueAfter(targets []*Target) time.Duration {
+	var result time.Duration
+	for _, t := range targets {
+		if t.Hold == nil || t.Hold.Until == nil || t.Deployment == nil ||
+			t.Deployment.Spec.DeploymentID == t.Deployment.Spec.StagedDeploymentID {
+			continue
+		}
+		d := time.Until(t.Hold.Until.Time)
+		if d <= 0 {
+			d = time.Second
+		}
+		if result == 0 || d < result {
+			result = d
+		}
+	}
+	return result
+}
@@ -51,6 +51,22 @@ func (a *BundleMatch) MatchTargetCustomizations(clusterName string, clusterGroup
 	return nil
 }
 
+// MatchNotSampled returns the first BundleTarget that matches the target criteria, including restrictions, if its
+// sample does not include the cluster. It is used to explain why Match did not return a target.
+func (a *BundleMatch) MatchNotSampled(clusterName string, clusterGroups map[string]map[string]string, clusterLabels map[string]string) *fleet.BundleTarget {
+	for _, targetMatch := range a.matcher.matches {
+		if !matchGroups(targetMatch, clusterName, clusterLabels, clusterGroups, a.matcher.criteriaWithRestrictions) {
+			continue
+		}
+		if inSample(targetMatch.bundleTarget.Sample, clusterName) {
+			return nil
+		}
+		return targetMatch.bundleTarget
+	}
+
+	return nil
+}
+
 type targetMatch struct {
 	bundleTarget *fleet.BundleTarget
 	criteria     *ClusterMatcher
@@ -122,20 +138,33 @@ func criteriaWithoutRestrictions(targetMatch targetMatch, clusterName, clusterGr
 }
 
 // match returns the first BundleTarget, from the matcher's target matches, which matches the specified cluster name, groups and labels, using matching logic implemented via findCriteriaMatch.
+// If the first matching target has a sample, which does not include the cluster, no target is returned. The cluster
+// does not fall through to the following targets, as these usually include the GitRepo's targets.
 func (m *matcher) match(clusterName string, clusterLabels map[string]string, clusterGroups map[string]map[string]string, findCriteriaMatch findCriteriaMatch) *fleet.BundleTarget {
 	for _, targetMatch := range m.matches {
-		if len(clusterGroups) == 0 {
-			if findCriteriaMatch(targetMatch, clusterName, "", nil, clusterLabels) {
-				return targetMatch.bundleTarget
-			}
-		} else {
-			for clusterGroup, clusterGroupLabels := range clusterGroups {
-				if findCriteriaMatch(targetMatch, clusterName, clusterGroup, clusterGroupLabels, clusterLabels) {
-					return targetMatch.bundleTarget
-				}
-			}
+		if !matchGroups(targetMatch, clusterName, clusterLabels, clusterGroups, findCriteriaMatch) {
+			continue
 		}
+		if !inSample(targetMatch.bundleTarget.Sample, clusterName) {
+			return nil
+		}
+		return targetMatch.bundleTarget
 	}
 
 	return nil
 }
+
+// matchGroups returns true if findCriteriaMatch matches the cluster, either without cluster groups or for any of the cluster's groups.
+func matchGroups(targetMatch targetMatch, clusterName string, clusterLabels map[string]string, clusterGroups map[string]map[string]string, findCriteriaMatch findCriteriaMatch) bool {
+	if len(clusterGroups) == 0 {
+		return findCriteriaMatch(targetMatch, clusterName, "", nil, clusterLabels)
+	}
+
+	for clusterGroup, clusterGroupLabels := range clusterGroups {
+		if findCriteriaMatch(targetMatch, clusterName, clusterGroup, clusterGroupLabels, clusterLabels) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,160 @@
+package matcher
+
+import (
+	"fmt"
+	"strings"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ClusterGroups resolves the effective membership of the cluster groups in a
+// namespace. A cluster is a member of a group, if the group's selector
+// matches it, the group lists it explicitly or it is a member of an included
+// group, unless it is a member of an excluded group.
+type ClusterGroups struct {
+	groups []*fleet.ClusterGroup
+	byName map[string]*fleet.ClusterGroup
+}
+
+// NewClusterGroups returns a resolver for the given cluster groups, which
+// must all be in the same namespace
+func NewClusterGroups(groups []*fleet.ClusterGroup) *ClusterGroups {
+	c := &ClusterGroups{
+		groups: groups,
+		byName: map[string]*fleet.ClusterGroup{},
+	}
+	for _, cg := range groups {
+		c.byName[cg.Name] = cg
+	}
+	return c
+}
+
+// Contains returns true if the cluster is a member of the group. Groups,
+// which do not exist, have no members. An error is returned for invalid
+// selectors and cycles of nested groups.
+func (c *ClusterGroups) Contains(group string, cluster *fleet.Cluster) (bool, error) {
+	return c.contains(group, cluster, nil)
+}
+
+func (c *ClusterGroups) contains(group string, cluster *fleet.Cluster, path []string) (bool, error) {
+	for i, p := range path {
+		if p == group {
+			return false, CycleError(append(path[i:], group))
+		}
+	}
+	cg, ok := c.byName[group]
+	if !ok {
+		return false, nil
+	}
+	path = append(path[:len(path):len(path)], group)
+
+	// exclusions take precedence over all other criteria
+	for _, excluded := range cg.Spec.ExcludeGroups {
+		ok, err := c.contains(excluded, cluster, path)
+		if err != nil || ok {
+			return false, err
+		}
+	}
+
+	if cg.Spec.Selector != nil {
+		sel, err := toSelector(cg.Spec.Selector)
+		if err != nil {
+			return false, fmt.Errorf("invalid selector on cluster group %s: %w", cg.Name, err)
+		}
+		if sel.Matches(labels.Set(cluster.Labels)) {
+			return true, nil
+		}
+	}
+
+	for _, name := range cg.Spec.Clusters {
+		if name == cluster.Name {
+			return true, nil
+		}
+	}
+
+	for _, included := range cg.Spec.IncludeGroups {
+		ok, err := c.contains(included, cluster, path)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+// GroupsOf returns the groups the cluster is a member of. Groups, for which
+// the membership can't be resolved, are returned as errors.
+func (c *ClusterGroups) GroupsOf(cluster *fleet.Cluster) ([]*fleet.ClusterGroup, []error) {
+	var (
+		result []*fleet.ClusterGroup
+		errs   []error
+	)
+	for _, cg := range c.groups {
+		ok, err := c.Contains(cg.Name, cluster)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			result = append(result, cg)
+		}
+	}
+	return result, errs
+}
+
+// Cycle returns the names along a cycle of nested groups, which is reachable
+// from the group, e.g. ["a", "b", "a"], or nil if there is none.
+func (c *ClusterGroups) Cycle(group string) []string {
+	done := map[string]bool{}
+
+	var visit func(name string, path []string) []string
+	visit = func(name string, path []string) []string {
+		for i, p := range path {
+			if p == name {
+				return append(path[i:], name)
+			}
+		}
+		cg, ok := c.byName[name]
+		if !ok || done[name] {
+			return nil
+		}
+		path = append(path[:len(path):len(path)], name)
+		for _, nested := range cg.Spec.IncludeGroups {
+			if cycle := visit(nested, path); cycle != nil {
+				return cycle
+			}
+		}
+		for _, nested := range cg.Spec.ExcludeGroups {
+			if cycle := visit(nested, path); cycle != nil {
+				return cycle
+			}
+		}
+		done[name] = true
+		return nil
+	}
+
+	return visit(group, nil)
+}
+
+// References returns true if the group includes or excludes the other group
+// directly (pure function)
+func References(cg *fleet.ClusterGroup, other string) bool {
+	for _, name := range cg.Spec.IncludeGroups {
+		if name == other {
+			return true
+		}
+	}
+	for _, name := range cg.Spec.ExcludeGroups {
+		if name == other {
+			return true
+		}
+	}
+	return false
+}
+
+// CycleError returns an error describing the cycle of nested groups
+func CycleError(path []string) error {
+	return fmt.Errorf("cycle in nested cluster groups: %s", strings.Join(path, " -> "))
+}
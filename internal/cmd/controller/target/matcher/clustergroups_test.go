@@ -0,0 +1,75 @@
+package matcher
+
+import (
+	"reflect"
+	"testing"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func group(name string, spec fleet.ClusterGroupSpec) *fleet.ClusterGroup {
+	return &fleet.ClusterGroup{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+}
+
+func TestClusterGroups(t *testing.T) {
+	groups := NewClusterGroups([]*fleet.ClusterGroup{
+		group("emea", fleet.ClusterGroupSpec{IncludeGroups: []string{"emea-prod", "emea-staging"}, ExcludeGroups: []string{"quarantine"}}),
+		group("emea-prod", fleet.ClusterGroupSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"region": "emea", "env": "prod"}}}),
+		group("emea-staging", fleet.ClusterGroupSpec{Clusters: []string{"staging-1"}}),
+		group("quarantine", fleet.ClusterGroupSpec{Clusters: []string{"prod-2"}}),
+		group("a", fleet.ClusterGroupSpec{IncludeGroups: []string{"b"}}),
+		group("b", fleet.ClusterGroupSpec{ExcludeGroups: []string{"a"}}),
+	})
+
+	cluster := func(name string, labels map[string]string) *fleet.Cluster {
+		return &fleet.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	prodLabels := map[string]string{"region": "emea", "env": "prod"}
+
+	tests := map[string]struct {
+		group    string
+		cluster  *fleet.Cluster
+		expected bool
+	}{
+		"selected by nested group":        {group: "emea", cluster: cluster("prod-1", prodLabels), expected: true},
+		"listed in nested group":          {group: "emea", cluster: cluster("staging-1", nil), expected: true},
+		"excluded group takes precedence": {group: "emea", cluster: cluster("prod-2", prodLabels), expected: false},
+		"not a member":                    {group: "emea", cluster: cluster("us-1", map[string]string{"region": "us"}), expected: false},
+		"missing group has no members":    {group: "apac", cluster: cluster("prod-1", prodLabels), expected: false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ok, err := groups.Contains(test.group, test.cluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, ok)
+			}
+		})
+	}
+
+	if _, err := groups.Contains("a", cluster("prod-1", nil)); err == nil {
+		t.Error("expected an error for the cycle of nested groups")
+	}
+	if cycle := groups.Cycle("a"); !reflect.DeepEqual(cycle, []string{"a", "b", "a"}) {
+		t.Errorf("expected cycle a -> b -> a, got %v", cycle)
+	}
+	if cycle := groups.Cycle("emea"); cycle != nil {
+		t.Errorf("expected no cycle, got %v", cycle)
+	}
+
+	member, errs := groups.GroupsOf(cluster("prod-1", prodLabels))
+	if len(errs) != 2 {
+		t.Errorf("expected errors for both groups of the cycle, got %v", errs)
+	}
+	var names []string
+	for _, cg := range member {
+		names = append(names, cg.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"emea", "emea-prod"}) {
+		t.Errorf("expected cluster to be member of emea and emea-prod, got %v", names)
+	}
+}
@@ -0,0 +1,23 @@
+package matcher
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+)
+
+// inSample returns true if the cluster is part of the sample. The decision only
+// depends on the seed and the cluster name, which keeps the sample stable when
+// clusters are added or removed (pure function).
+func inSample(sample *fleet.TargetSample, clusterName string) bool {
+	if sample == nil || sample.Percent >= 100 {
+		return true
+	}
+	if sample.Percent <= 0 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(sample.Seed + "/" + clusterName))
+	return binary.BigEndian.Uint64(sum[:8])%100 < uint64(sample.Percent)
+}
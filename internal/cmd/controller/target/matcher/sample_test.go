@@ -0,0 +1,37 @@
+package matcher
+
+import (
+	"fmt"
+	"testing"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+)
+
+func TestInSample(t *testing.T) {
+	small := &fleet.TargetSample{Percent: 10, Seed: "canary"}
+	large := &fleet.TargetSample{Percent: 50, Seed: "canary"}
+
+	selected := 0
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("cluster-%d", i)
+		if inSample(small, name) {
+			selected++
+			if !inSample(large, name) {
+				t.Fatalf("expected %s to be part of the larger sample", name)
+			}
+		}
+		if inSample(small, name) != inSample(small, name) {
+			t.Fatalf("expected sample to be stable for %s", name)
+		}
+	}
+	if selected < 50 || selected > 150 {
+		t.Errorf("expected roughly 10%% of 1000 clusters to be selected, got %d", selected)
+	}
+
+	if !inSample(nil, "cluster") || !inSample(&fleet.TargetSample{Percent: 100}, "cluster") {
+		t.Error("expected cluster to be selected without sample or with 100%")
+	}
+	if inSample(&fleet.TargetSample{Percent: 0}, "cluster") {
+		t.Error("expected cluster not to be selected with 0%")
+	}
+}
@@ -0,0 +1,82 @@
+package target
+
+import (
+	"strings"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+)
+
+// Outcome records the targeting decision for a single cluster, i.e. which
+// target matched, or why the cluster is not deployed to.
+type Outcome struct {
+	Cluster             *fleet.Cluster
+	ClusterGroups       []*fleet.ClusterGroup
+	Result              fleet.TargetingOutcome
+	Target              string
+	TargetCustomization string
+	Message             string
+	// Sampled is true if the cluster was selected by the sample of the
+	// matching target or target customization.
+	Sampled bool
+}
+
+// TargetingSummary counts the outcomes by result (pure function)
+func TargetingSummary(outcomes []Outcome) fleet.TargetingSummary {
+	var summary fleet.TargetingSummary
+	for _, outcome := range outcomes {
+		if outcome.Sampled {
+			summary.Sampled++
+		}
+		switch outcome.Result {
+		case fleet.TargetingMatched:
+			summary.Matched++
+		case fleet.TargetingNoMatch:
+			summary.NoMatch++
+		case fleet.TargetingRestricted:
+			summary.Restricted++
+		case fleet.TargetingDoNotDeploy:
+			summary.DoNotDeploy++
+		case fleet.TargetingNotSampled:
+			summary.NotSampled++
+		case fleet.TargetingUnmetRequirement:
+			summary.UnmetRequirement++
+		case fleet.TargetingWaitingForNamespace:
+			summary.WaitingForNamespace++
+		}
+	}
+	return summary
+}
+
+// Explain returns the explanation for the cluster referenced by the value of
+// the explain annotation, which is either "namespace/name" or a name in the
+// bundle's namespace (pure function)
+func Explain(bundle *fleet.Bundle, outcomes []Outcome, ref string) *fleet.TargetingExplanation {
+	namespace, name := bundle.Namespace, ref
+	if i := strings.Index(ref, "/"); i >= 0 {
+		namespace, name = ref[:i], ref[i+1:]
+	}
+
+	for _, outcome := range outcomes {
+		if outcome.Cluster.Namespace != namespace || outcome.Cluster.Name != name {
+			continue
+		}
+
+		explanation := &fleet.TargetingExplanation{
+			Cluster:             namespace + "/" + name,
+			Outcome:             outcome.Result,
+			Target:              outcome.Target,
+			TargetCustomization: outcome.TargetCustomization,
+			Message:             outcome.Message,
+		}
+		for _, cg := range outcome.ClusterGroups {
+			explanation.ClusterGroups = append(explanation.ClusterGroups, cg.Name)
+		}
+		return explanation
+	}
+
+	return &fleet.TargetingExplanation{
+		Cluster: namespace + "/" + name,
+		Outcome: fleet.TargetingClusterNotFound,
+		Message: "cluster not found in the bundle's namespace or the namespaces of matching bundle namespace mappings",
+	}
+}
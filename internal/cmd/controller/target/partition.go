@@ -14,6 +14,7 @@ type partition struct {
 // UpdatePartitions recomputes status, including partitions, from data in allTargets.
 // It creates Deployments in allTargets if they are missing.
 // It updates Deployments in allTargets if they are out of sync (DeploymentID != StagedDeploymentID).
+// For sequential rollouts, a partition is only updated once the previous partitions are done.
 func UpdatePartitions(status *fleet.BundleStatus, allTargets []*Target) (err error) {
 	partitions, err := partitions(allTargets)
 	if err != nil {
@@ -26,7 +27,15 @@ func UpdatePartitions(status *fleet.BundleStatus, allTargets []*Target) (err err
 		return err
 	}
 
-	for _, partition := range partitions {
+	rollout := getRollout(allTargets)
+	if err := ValidateRollout(rollout); err != nil {
+		return err
+	}
+	previous := status.PartitionStatus
+	status.PartitionStatus = nil
+	gate := newGate(rollout, status, allTargets, partitions, previous)
+
+	for i, partition := range partitions {
 		partition := partition // fix gosec warning regarding "Implicit memory aliasing in for loop"
 		for _, target := range partition.Targets {
 			// for a new bundledeployment, only stage the first maxNew (50) targets
@@ -48,15 +57,22 @@ func UpdatePartitions(status *fleet.BundleStatus, allTargets []*Target) (err err
 			}
 		}
 
-		for _, currentTarget := range partition.Targets {
-			// NOTE this will propagate the staged, merged options to the current deployment
-			updateTarget(currentTarget, status, &partition.Status)
+		if gate.allows(i) {
+			for _, currentTarget := range partition.Targets {
+				// NOTE this will propagate the staged, merged options to the current deployment
+				updateTarget(currentTarget, status, &partition.Status)
+			}
 		}
 
 		if updateStatusUnavailable(&partition.Status, partition.Targets) {
 			status.UnavailablePartitions++
 		}
 
+		if rollout.Sequential {
+			gate.update(i, &partitions[i].Status, partition.Targets)
+			continue
+		}
+
 		if status.UnavailablePartitions > status.MaxUnavailablePartitions {
 			break
 		}
@@ -81,6 +97,8 @@ func updateTarget(t *Target, status *fleet.BundleStatus, partitionStatus *fleet.
 	if t.Deployment != nil &&
 		// Not Paused
 		!t.IsPaused() &&
+		// Not held back, e.g. outside of maintenance windows
+		t.Hold == nil &&
 		// Has been staged
 		t.Deployment.Spec.StagedDeploymentID != "" &&
 		// Is out of sync
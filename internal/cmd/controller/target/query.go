@@ -9,8 +9,6 @@ import (
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 
 	"github.com/rancher/fleet/internal/cmd/controller/target/matcher"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 )
 
 func (m *Manager) BundlesForCluster(ctx context.Context, cluster *fleet.Cluster) (bundlesToRefresh, bundlesToCleanup []*fleet.Bundle, err error) {
@@ -86,27 +84,21 @@ func (m *Manager) getBundlesInScopeForCluster(ctx context.Context, cluster *flee
 	return bundleSet.bundles(), nil
 }
 
-func (m *Manager) clusterGroupsForCluster(ctx context.Context, cluster *fleet.Cluster) (result []*fleet.ClusterGroup, _ error) {
+func (m *Manager) clusterGroupsForCluster(ctx context.Context, cluster *fleet.Cluster) ([]*fleet.ClusterGroup, error) {
 	cgs := &fleet.ClusterGroupList{}
 	err := m.client.List(ctx, cgs, client.InNamespace(cluster.Namespace))
 	if err != nil {
 		return nil, err
 	}
 
-	for _, cg := range cgs.Items {
-		cg := cg
-		if cg.Spec.Selector == nil {
-			continue
-		}
-		sel, err := metav1.LabelSelectorAsSelector(cg.Spec.Selector)
-		if err != nil {
-			logrus.Errorf("invalid selector on clusterGroup %s/%s [%v]: %v", cg.Namespace, cg.Name,
-				cg.Spec.Selector, err)
-			continue
-		}
-		if sel.Matches(labels.Set(cluster.Labels)) {
-			result = append(result, &cg)
-		}
+	groups := make([]*fleet.ClusterGroup, 0, len(cgs.Items))
+	for i := range cgs.Items {
+		groups = append(groups, &cgs.Items[i])
+	}
+
+	result, errs := matcher.NewClusterGroups(groups).GroupsOf(cluster)
+	for _, err := range errs {
+		logrus.Errorf("invalid clusterGroup in namespace %s: %v", cluster.Namespace, err)
 	}
 
 	return result, nil
@@ -0,0 +1,59 @@
+package target
+
+import (
+	"fmt"
+	"strings"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+)
+
+// unmetRequirement checks the bundle's requirements against the facts the
+// cluster's agent reported. It returns a description of the first unmet
+// requirement or an empty string, if the cluster satisfies all of them (pure
+// function).
+func unmetRequirement(requires *fleet.BundleRequirements, cluster *fleet.Cluster) string {
+	if requires == nil {
+		return ""
+	}
+
+	agent := cluster.Status.Agent
+	if requires.KubeVersion != "" {
+		if agent.KubernetesVersion == "" {
+			return "kubernetes version not reported by agent"
+		}
+		ok, err := kubeVersionCompare(requires.KubeVersion, agent.KubernetesVersion)
+		if err != nil {
+			return fmt.Sprintf("invalid kubeVersion requirement %q: %v", requires.KubeVersion, err)
+		}
+		if !ok {
+			return fmt.Sprintf("kubernetes version %s does not satisfy %s", agent.KubernetesVersion, requires.KubeVersion)
+		}
+	}
+
+	if len(requires.APIs) > 0 && len(agent.APIResources) == 0 {
+		return "api resources not reported by agent"
+	}
+	for _, api := range requires.APIs {
+		if !servesAPI(agent.APIResources, api) {
+			return fmt.Sprintf("api %s is not served", api)
+		}
+	}
+
+	return ""
+}
+
+// servesAPI returns true if the required API is in the list of resources. The
+// required API is either a "group/version/Kind" or a "group/version", which
+// matches any resource in that group version.
+func servesAPI(resources []string, api string) bool {
+	api = strings.TrimSuffix(api, "/")
+	for _, resource := range resources {
+		if resource == api {
+			return true
+		}
+		if i := strings.LastIndex(resource, "/"); i > 0 && resource[:i] == api {
+			return true
+		}
+	}
+	return false
+}
@@ -1,13 +1,39 @@
 package target
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/rancher/fleet/internal/cmd/controller/target/matcher"
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	"github.com/rancher/wrangler/v2/pkg/condition"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// ValidateRollout returns an error, if the options of the rollout strategy
+// contradict each other (pure function)
+func ValidateRollout(rollout *fleet.RolloutStrategy) error {
+	if rollout != nil && rollout.Sequential && rollout.MaxUnavailablePartitions != nil {
+		return errors.New("maxUnavailablePartitions cannot be used with a sequential rollout, which only updates one partition at a time")
+	}
+	return nil
+}
+
+// SetRolloutValidCondition reports an invalid rollout strategy in the
+// bundle's status. The condition is only added once a strategy was invalid.
+func SetRolloutValidCondition(status *fleet.BundleStatus, err error) {
+	cond := condition.Cond(fleet.BundleConditionRolloutValid)
+	if err == nil && cond.GetStatus(status) == "" {
+		return
+	}
+	cond.SetStatusBool(status, err == nil)
+	if err != nil {
+		cond.Message(status, err.Error())
+	} else {
+		cond.Message(status, "")
+	}
+}
+
 // partitions distributes targets into partitions based on the rollout strategy (pure function)
 func partitions(targets []*Target) ([]partition, error) {
 	rollout := getRollout(targets)
@@ -0,0 +1,138 @@
+package target
+
+import (
+	"time"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// gate decides which partitions of a sequential rollout may be updated. For
+// other rollouts all partitions are allowed, unless the rollout was halted by
+// the failure policy.
+type gate struct {
+	halted     bool
+	sequential bool
+	soak       time.Duration
+	// promoted is the index of the last partition, which may be updated
+	promoted int
+	// readySince is the ReadySince time of the previous partition status
+	// with the same name
+	readySince map[string]*metav1.Time
+	// open is true as long as all partitions so far are done
+	open bool
+	now  time.Time
+}
+
+// newGate returns a gate for the rollout. The previous partition status is
+// used to keep track of the soak duration (pure function).
+func newGate(rollout *fleet.RolloutStrategy, status *fleet.BundleStatus, targets []*Target, partitions []partition, previous []fleet.PartitionStatus) *gate {
+	g := &gate{
+		halted:     len(targets) > 0 && status.RolledBackGeneration != 0 && status.RolledBackGeneration == targets[0].Bundle.Generation,
+		sequential: rollout.Sequential,
+		promoted:   len(partitions) - 1,
+		readySince: map[string]*metav1.Time{},
+		open:       true,
+		now:        time.Now(),
+	}
+	if rollout.SoakDuration != nil {
+		g.soak = rollout.SoakDuration.Duration
+	}
+
+	if rollout.RequireApproval {
+		g.promoted = promotedPartition(targets, partitions)
+	}
+
+	for _, p := range previous {
+		if p.ReadySince != nil {
+			g.readySince[p.Name] = p.ReadySince
+		}
+	}
+
+	return g
+}
+
+// promotedPartition returns the index of the partition named by the bundle's
+// promoted partition annotation. The first partition is always promoted
+// (pure function).
+func promotedPartition(targets []*Target, partitions []partition) int {
+	if len(targets) == 0 {
+		return 0
+	}
+
+	name := targets[0].Bundle.Annotations[fleet.PromotedPartitionAnnotation]
+	for i, p := range partitions {
+		if name != "" && p.Status.Name == name {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// allows returns true if the partition at index i may be updated.
+func (g *gate) allows(i int) bool {
+	if g.halted {
+		return false
+	}
+	if !g.sequential {
+		return true
+	}
+	return g.open && i <= g.promoted
+}
+
+// update sets the phase of the partition at index i and closes the gate for
+// the following partitions, unless the partition is done.
+func (g *gate) update(i int, status *fleet.PartitionStatus, targets []*Target) {
+	ready := true
+	for _, target := range targets {
+		if !upToDate(target) || !target.Deployment.Status.Ready {
+			ready = false
+			break
+		}
+	}
+
+	status.ReadySince = nil
+	if ready {
+		status.ReadySince = g.readySince[status.Name]
+		if status.ReadySince == nil {
+			status.ReadySince = &metav1.Time{Time: g.now}
+		}
+	}
+
+	switch {
+	case ready && g.now.Before(status.ReadySince.Add(g.soak)):
+		status.Phase = fleet.PartitionSoaking
+	case ready:
+		status.Phase = fleet.PartitionDone
+	case !g.open:
+		status.Phase = fleet.PartitionPending
+	case i > g.promoted:
+		status.Phase = fleet.PartitionWaitingForApproval
+	default:
+		status.Phase = fleet.PartitionRollingOut
+	}
+
+	g.open = g.open && status.Phase == fleet.PartitionDone
+}
+
+// RequeueAfter returns the time until the first soaking partition is done, or
+// zero if no partition is soaking (pure function).
+func RequeueAfter(bundle *fleet.Bundle, status *fleet.BundleStatus) time.Duration {
+	rollout := bundle.Spec.RolloutStrategy
+	if rollout == nil || !rollout.Sequential || rollout.SoakDuration == nil {
+		return 0
+	}
+
+	for _, p := range status.PartitionStatus {
+		if p.Phase == fleet.PartitionSoaking && p.ReadySince != nil {
+			if remaining := time.Until(p.ReadySince.Add(rollout.SoakDuration.Duration)); remaining > 0 {
+				return remaining
+			}
+			return time.Second
+		}
+	}
+
+	return 0
+}
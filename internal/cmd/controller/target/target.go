@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/rancher/fleet/internal/cmd/controller/summary"
+	"github.com/rancher/fleet/internal/manifest"
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 
 	"github.com/rancher/wrangler/v2/pkg/yaml"
@@ -44,6 +45,16 @@ type Target struct {
 	Bundle        *fleet.Bundle
 	Options       fleet.BundleDeploymentOptions
 	DeploymentID  string
+	// Manifest is only set if the bundle's resources were rendered
+	// specifically for this target. It needs to be stored, before a
+	// bundledeployment can refer to it.
+	Manifest *manifest.Manifest
+	// Hold is set, if the target may not receive a new deployment, e.g.
+	// because its cluster's maintenance windows are closed, a
+	// deployment freeze is active or a bundle on another cluster it
+	// depends on is not ready. The new
+	// deployment stays staged.
+	Hold *fleet.PendingStatus
 }
 
 // BundleDeployment returns a new bd, it discards annotations, status, etc.
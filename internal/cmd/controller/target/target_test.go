@@ -2,14 +2,28 @@ package target
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	"github.com/rancher/fleet/internal/manifest"
 	"github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/condition"
+	"github.com/rancher/wrangler/v2/pkg/genericcondition"
 )
 
 const bundleYaml = `namespace: default
@@ -361,7 +375,7 @@ func TestDisablePreProcessFlagEnabled(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	err = preprocessHelmValues(zap.New(), bundle, cluster)
+	err = preprocessHelmValues(zap.New(), bundle, cluster, templateContext(cluster, nil, &v1alpha1.Bundle{}, ""))
 	if err != nil {
 		t.Fatalf("error during cluster processing %v", err)
 	}
@@ -415,7 +429,7 @@ func TestDisablePreProcessFlagDisabled(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	err = preprocessHelmValues(zap.New(), bundle, cluster)
+	err = preprocessHelmValues(zap.New(), bundle, cluster, templateContext(cluster, nil, &v1alpha1.Bundle{}, ""))
 	if err != nil {
 		t.Fatalf("error during cluster processing %v", err)
 	}
@@ -448,7 +462,7 @@ func TestDisablePreProcessFlagMissing(t *testing.T) {
 		t.Fatal(err.Error())
 	}
 
-	err = preprocessHelmValues(zap.New(), bundle, cluster)
+	err = preprocessHelmValues(zap.New(), bundle, cluster, templateContext(cluster, nil, &v1alpha1.Bundle{}, ""))
 	if err != nil {
 		t.Fatalf("error during cluster processing %v", err)
 	}
@@ -467,3 +481,906 @@ func TestDisablePreProcessFlagMissing(t *testing.T) {
 	}
 
 }
+
+const rawYamlWithTemplate = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ${ .ClusterName }-config
+data:
+  env: ${ .ClusterLabels.envType | quote }
+  value: ${ .ClusterValues.someKey }
+`
+
+func TestTemplateResources(t *testing.T) {
+	cluster, _, err := getClusterAndBundle(bundleYamlWithDisablePreProcessMissing)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cluster.Labels["envType"] = "dev"
+
+	m := manifest.New([]v1alpha1.BundleResource{
+		{Name: "fleet.yaml", Content: "yaml:\n  template: ${ .ClusterName }\n"},
+		{Name: "configmap.yaml", Content: rawYamlWithTemplate},
+		{Name: "README.md", Content: "${ .ClusterName }"},
+	})
+
+	templated, err := templateResources(m, v1alpha1.BundleDeploymentOptions{}, templateContext(cluster, nil, &v1alpha1.Bundle{}, ""))
+	if err != nil {
+		t.Fatalf("error during resource templating %v", err)
+	}
+
+	for _, testCase := range []struct {
+		Name            string
+		ExpectedContent string
+	}{
+		{
+			Name:            "fleet.yaml",
+			ExpectedContent: "yaml:\n  template: ${ .ClusterName }\n",
+		},
+		{
+			Name:            "configmap.yaml",
+			ExpectedContent: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test-cluster-config\ndata:\n  env: \"dev\"\n  value: someValue\n",
+		},
+		{
+			Name:            "README.md",
+			ExpectedContent: "${ .ClusterName }",
+		},
+	} {
+		found := false
+		for _, resource := range templated.Resources {
+			if resource.Name != testCase.Name {
+				continue
+			}
+			found = true
+			if resource.Content != testCase.ExpectedContent {
+				t.Fatalf("resource %s was not the expected value. Expected: '%s' Actual: '%s'", testCase.Name, testCase.ExpectedContent, resource.Content)
+			}
+		}
+		if !found {
+			t.Fatalf("resource %s not found", testCase.Name)
+		}
+	}
+
+	originalID, err := m.ID()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	templatedID, err := templated.ID()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if originalID == templatedID {
+		t.Fatal("expected templated manifest to have a different ID")
+	}
+}
+
+func TestTemplateResourcesSkipsChart(t *testing.T) {
+	cluster, _, err := getClusterAndBundle(bundleYamlWithDisablePreProcessMissing)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	chartTemplate := "name: {{ .Release.Name }}-${ .ClusterName }"
+	m := manifest.New([]v1alpha1.BundleResource{
+		{Name: "Chart.yaml", Content: "name: test"},
+		{Name: "templates/deployment.yaml", Content: chartTemplate},
+	})
+
+	templated, err := templateResources(m, v1alpha1.BundleDeploymentOptions{}, templateContext(cluster, nil, &v1alpha1.Bundle{}, ""))
+	if err != nil {
+		t.Fatalf("error during resource templating %v", err)
+	}
+
+	if templated.Resources[1].Content != chartTemplate {
+		t.Fatalf("chart template was modified: '%s'", templated.Resources[1].Content)
+	}
+}
+
+func TestTargetsTemplateResources(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := func(name string) *v1alpha1.Cluster {
+		return &v1alpha1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "fleet-default", Labels: map[string]string{"env": name}},
+			Status:     v1alpha1.ClusterStatus{Namespace: "cluster-" + name},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster("dev"), cluster("prod"), cluster("test")).Build()
+
+	enabled, disabled := true, false
+	bundle := &v1alpha1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "fleet-default"},
+		Spec: v1alpha1.BundleSpec{
+			BundleDeploymentOptions: v1alpha1.BundleDeploymentOptions{YAML: &v1alpha1.YAMLOptions{Template: &enabled}},
+			Resources: []v1alpha1.BundleResource{
+				{Name: "configmap.yaml", Content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: ${ .ClusterName }-config\n"},
+			},
+			Targets: []v1alpha1.BundleTarget{
+				// a target customization disables templating again
+				{Name: "test", ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "test"}},
+					BundleDeploymentOptions: v1alpha1.BundleDeploymentOptions{YAML: &v1alpha1.YAMLOptions{Template: &disabled}}},
+				{Name: "all", ClusterSelector: &metav1.LabelSelector{}},
+			},
+		},
+	}
+
+	targets, _, err := New(c).Targets(context.TODO(), bundle, "s-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 3 {
+		t.Fatalf("expected 3 targets, got %d", len(targets))
+	}
+
+	deploymentIDs := map[string]bool{}
+	for _, target := range targets {
+		deploymentIDs[target.DeploymentID] = true
+		if target.Cluster.Name == "test" {
+			if target.Manifest != nil {
+				t.Errorf("expected the resources of cluster test not to be templated")
+			}
+			continue
+		}
+		if target.Manifest == nil {
+			t.Fatalf("expected the resources of cluster %s to be templated", target.Cluster.Name)
+		}
+		expected := "name: " + target.Cluster.Name + "-config"
+		if content := target.Manifest.Resources[0].Content; !strings.Contains(content, expected) {
+			t.Errorf("expected the resources of cluster %s to contain %q, got %q", target.Cluster.Name, expected, content)
+		}
+	}
+	if len(deploymentIDs) != 3 {
+		t.Errorf("expected a deployment ID per cluster, got %v", deploymentIDs)
+	}
+}
+
+const bundleYamlWithContextTemplate = `namespace: default
+helm:
+  releaseName: labels
+  values:
+    group: '${ if hasKey .ClusterGroups "prod" }${ .ClusterGroups.prod.region }${ end }'
+    kubeVersion: "${ .AgentStatus.KubernetesVersion }"
+    supportsNewAPI: '${ kubeVersionCompare ">=1.28" .AgentStatus.KubernetesVersion | quote }'
+    nodes: "${ .AgentStatus.ReadyNodes | quote }"
+    bundle: "${ .BundleNamespace }/${ .BundleName }"
+    commit: "${ .BundleCommit }"
+    repo: "${ .GitRepoName }"
+    target: "${ .TargetName }"
+`
+
+func TestTemplateContext(t *testing.T) {
+	cluster, bundleOpts, err := getClusterAndBundle(bundleYamlWithContextTemplate)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cluster.Status.Agent.KubernetesVersion = "v1.28.5-eks-5e0fdde"
+	cluster.Status.Agent.ReadyNodes = 3
+
+	groups := []*v1alpha1.ClusterGroup{
+		{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"region": "eu-west"}}},
+	}
+	bundle := &v1alpha1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-bundle",
+			Namespace: "fleet-default",
+			Labels: map[string]string{
+				v1alpha1.CommitLabel: "abc123",
+				v1alpha1.RepoLabel:   "my-repo",
+			},
+		},
+	}
+
+	err = preprocessHelmValues(zap.New(), bundleOpts, cluster, templateContext(cluster, groups, bundle, "prod-target"))
+	if err != nil {
+		t.Fatalf("error during cluster processing %v", err)
+	}
+
+	valuesObj := bundleOpts.Helm.Values.Data
+
+	for _, testCase := range []struct {
+		Key           string
+		ExpectedValue string
+	}{
+		{Key: "group", ExpectedValue: "eu-west"},
+		{Key: "kubeVersion", ExpectedValue: "v1.28.5-eks-5e0fdde"},
+		{Key: "supportsNewAPI", ExpectedValue: "true"},
+		{Key: "nodes", ExpectedValue: "3"},
+		{Key: "bundle", ExpectedValue: "fleet-default/my-bundle"},
+		{Key: "commit", ExpectedValue: "abc123"},
+		{Key: "repo", ExpectedValue: "my-repo"},
+		{Key: "target", ExpectedValue: "prod-target"},
+	} {
+		if field, ok := valuesObj[testCase.Key]; !ok {
+			t.Fatalf("key %s not found", testCase.Key)
+		} else if field != testCase.ExpectedValue {
+			t.Fatalf("key %s was not the expected value. Expected: '%s' Actual: '%s'", testCase.Key, testCase.ExpectedValue, field)
+		}
+	}
+}
+
+func TestKubeVersionCompare(t *testing.T) {
+	for _, testCase := range []struct {
+		Constraint string
+		Version    string
+		Expected   bool
+	}{
+		{Constraint: ">=1.28", Version: "v1.28.5+k3s1", Expected: true},
+		{Constraint: ">=1.28", Version: "v1.28.5-eks-5e0fdde", Expected: true},
+		{Constraint: ">=1.28", Version: "v1.27.9+rke2r1", Expected: false},
+		{Constraint: "<1.25", Version: "1.24.0", Expected: true},
+	} {
+		result, err := kubeVersionCompare(testCase.Constraint, testCase.Version)
+		if err != nil {
+			t.Fatalf("unexpected error for %s %s: %v", testCase.Constraint, testCase.Version, err)
+		}
+		if result != testCase.Expected {
+			t.Fatalf("expected %s %s to be %t", testCase.Constraint, testCase.Version, testCase.Expected)
+		}
+	}
+
+	if _, err := kubeVersionCompare(">=1.28", "not-a-version"); err == nil {
+		t.Fatal("expected error for invalid version")
+	}
+}
+
+func TestClusterGroupValues(t *testing.T) {
+	groups := []*v1alpha1.ClusterGroup{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "b-region"},
+			Spec: v1alpha1.ClusterGroupSpec{
+				TemplateValues: &v1alpha1.GenericMap{Data: map[string]interface{}{
+					"endpoint": "https://eu.example.com",
+					"nested":   map[string]interface{}{"b": "from-b"},
+				}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "a-all"},
+			Spec: v1alpha1.ClusterGroupSpec{
+				TemplateValues: &v1alpha1.GenericMap{Data: map[string]interface{}{
+					"endpoint": "https://global.example.com",
+					"nested":   map[string]interface{}{"a": "from-a", "b": "from-a"},
+				}},
+			},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c-no-values"}},
+	}
+
+	values := clusterGroupValues(groups)
+
+	if values["endpoint"] != "https://eu.example.com" {
+		t.Fatalf("expected values of later group to take precedence, got %v", values["endpoint"])
+	}
+
+	nested, ok := values["nested"].(map[string]interface{})
+	if !ok {
+		t.Fatal("key nested not found")
+	}
+	if nested["a"] != "from-a" || nested["b"] != "from-b" {
+		t.Fatalf("nested values were not merged: %v", nested)
+	}
+
+	if groups[0].Name != "b-region" {
+		t.Fatal("cluster groups were reordered")
+	}
+}
+
+func TestUnmetRequirement(t *testing.T) {
+	cluster := &v1alpha1.Cluster{
+		Status: v1alpha1.ClusterStatus{
+			Agent: v1alpha1.AgentStatus{
+				KubernetesVersion: "v1.27.9+rke2r1",
+				APIResources:      []string{"apps/v1/Deployment", "monitoring.coreos.com/v1/ServiceMonitor", "v1/ConfigMap"},
+			},
+		},
+	}
+
+	for _, testCase := range []struct {
+		Name     string
+		Requires *v1alpha1.BundleRequirements
+		Unmet    bool
+	}{
+		{Name: "no requirements", Requires: nil},
+		{Name: "kube version met", Requires: &v1alpha1.BundleRequirements{KubeVersion: ">=1.27"}},
+		{Name: "kube version unmet", Requires: &v1alpha1.BundleRequirements{KubeVersion: ">=1.28"}, Unmet: true},
+		{Name: "invalid constraint", Requires: &v1alpha1.BundleRequirements{KubeVersion: "foo"}, Unmet: true},
+		{Name: "kind served", Requires: &v1alpha1.BundleRequirements{APIs: []string{"monitoring.coreos.com/v1/ServiceMonitor", "v1/ConfigMap"}}},
+		{Name: "group version served", Requires: &v1alpha1.BundleRequirements{APIs: []string{"monitoring.coreos.com/v1"}}},
+		{Name: "kind not served", Requires: &v1alpha1.BundleRequirements{APIs: []string{"monitoring.coreos.com/v1/PodMonitor"}}, Unmet: true},
+		{Name: "group version not served", Requires: &v1alpha1.BundleRequirements{APIs: []string{"monitoring.coreos.com/v1beta1"}}, Unmet: true},
+	} {
+		reason := unmetRequirement(testCase.Requires, cluster)
+		if (reason != "") != testCase.Unmet {
+			t.Errorf("%s: unexpected result %q", testCase.Name, reason)
+		}
+	}
+
+	if reason := unmetRequirement(&v1alpha1.BundleRequirements{APIs: []string{"v1/ConfigMap"}}, &v1alpha1.Cluster{}); reason == "" {
+		t.Error("expected requirement to be unmet, if the agent did not report api resources")
+	}
+}
+
+func TestTargetsOutcomes(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := func(name, env, namespace string) *v1alpha1.Cluster {
+		return &v1alpha1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "fleet-default", Labels: map[string]string{"env": env}},
+			Status: v1alpha1.ClusterStatus{
+				Namespace: namespace,
+				Agent:     v1alpha1.AgentStatus{KubernetesVersion: "v1.27.9"},
+			},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		cluster("dev", "dev", "cluster-dev"),
+		cluster("prod", "prod", "cluster-prod"),
+		cluster("new", "prod", ""),
+		cluster("test", "test", "cluster-test"),
+		cluster("qa", "qa", "cluster-qa"),
+		cluster("other", "other", "cluster-other"),
+	).Build()
+
+	selector := func(env string) *metav1.LabelSelector {
+		return &metav1.LabelSelector{MatchLabels: map[string]string{"env": env}}
+	}
+	bundle := &v1alpha1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "fleet-default"},
+		Spec: v1alpha1.BundleSpec{
+			Targets: []v1alpha1.BundleTarget{
+				{Name: "prod", ClusterSelector: selector("prod")},
+				{Name: "dev", ClusterSelector: selector("dev"), DoNotDeploy: true},
+				{Name: "test", ClusterSelector: selector("test")},
+				{Name: "qa", ClusterSelector: selector("qa")},
+			},
+			TargetRestrictions: []v1alpha1.BundleTargetRestriction{
+				{ClusterSelector: selector("prod")},
+				{ClusterSelector: selector("dev")},
+				{ClusterSelector: selector("test")},
+			},
+		},
+	}
+	targets, outcomes, err := New(c).Targets(context.TODO(), bundle, "s-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 3 {
+		t.Fatalf("expected 3 targets, got %d", len(targets))
+	}
+
+	expected := map[string]v1alpha1.TargetingOutcome{
+		"dev":   v1alpha1.TargetingDoNotDeploy,
+		"new":   v1alpha1.TargetingWaitingForNamespace,
+		"other": v1alpha1.TargetingNoMatch,
+		"prod":  v1alpha1.TargetingMatched,
+		"qa":    v1alpha1.TargetingRestricted,
+		"test":  v1alpha1.TargetingMatched,
+	}
+	for _, outcome := range outcomes {
+		if outcome.Result != expected[outcome.Cluster.Name] {
+			t.Errorf("expected outcome %s for cluster %s, got %s", expected[outcome.Cluster.Name], outcome.Cluster.Name, outcome.Result)
+		}
+	}
+
+	summary := TargetingSummary(outcomes)
+	if summary != (v1alpha1.TargetingSummary{Matched: 2, NoMatch: 1, Restricted: 1, DoNotDeploy: 1, WaitingForNamespace: 1}) {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	explanation := Explain(bundle, outcomes, "qa")
+	if explanation.Cluster != "fleet-default/qa" || explanation.Outcome != v1alpha1.TargetingRestricted || explanation.Message == "" {
+		t.Errorf("unexpected explanation %+v", explanation)
+	}
+
+	explanation = Explain(bundle, outcomes, "fleet-local/qa")
+	if explanation.Outcome != v1alpha1.TargetingClusterNotFound {
+		t.Errorf("unexpected explanation %+v", explanation)
+	}
+
+	bundle.Spec.Requires = &v1alpha1.BundleRequirements{KubeVersion: ">=1.28"}
+	targets, outcomes, err = New(c).Targets(context.TODO(), bundle, "s-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 0 {
+		t.Fatalf("expected no targets, got %d", len(targets))
+	}
+	if summary := TargetingSummary(outcomes); summary.UnmetRequirement != 3 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestTargetsSample(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for i := 0; i < 100; i++ {
+		builder = builder.WithObjects(&v1alpha1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("cluster-%d", i), Namespace: "fleet-default"},
+			Status:     v1alpha1.ClusterStatus{Namespace: fmt.Sprintf("cluster-ns-%d", i)},
+		})
+	}
+
+	bundle := &v1alpha1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "fleet-default"},
+		Spec: v1alpha1.BundleSpec{
+			Targets: []v1alpha1.BundleTarget{
+				{Name: "canary", ClusterSelector: &metav1.LabelSelector{}, Sample: &v1alpha1.TargetSample{Percent: 20, Seed: "seed"}},
+			},
+		},
+	}
+
+	targets, outcomes, err := New(builder.Build()).Targets(context.TODO(), bundle, "s-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := TargetingSummary(outcomes)
+	if summary.Sampled != len(targets) || summary.Matched != len(targets) || summary.NotSampled != 100-len(targets) {
+		t.Errorf("unexpected summary %+v for %d targets", summary, len(targets))
+	}
+	if len(targets) == 0 || len(targets) > 40 {
+		t.Errorf("expected roughly 20 of 100 clusters to be sampled, got %d", len(targets))
+	}
+
+	// clusters outside of the sample of a fleet.yaml targetCustomization
+	// do not fall through to the GitRepo's targets
+	sampled := len(targets)
+	bundle.Spec.Targets = append(bundle.Spec.Targets, v1alpha1.BundleTarget{Name: "rest", ClusterSelector: &metav1.LabelSelector{}})
+	bundle.Spec.TargetRestrictions = []v1alpha1.BundleTargetRestriction{{Name: "rest", ClusterSelector: &metav1.LabelSelector{}}}
+	targets, outcomes, err = New(builder.Build()).Targets(context.TODO(), bundle, "s-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != sampled {
+		t.Errorf("expected only the %d sampled clusters to be targeted, got %d", sampled, len(targets))
+	}
+	for _, target := range targets {
+		if !slices.ContainsFunc(outcomes, func(o Outcome) bool {
+			return o.Cluster.Name == target.Cluster.Name && o.Target == "canary"
+		}) {
+			t.Errorf("expected cluster %s to be targeted by the canary target", target.Cluster.Name)
+		}
+	}
+	if summary := TargetingSummary(outcomes); summary.NotSampled != 100-sampled {
+		t.Errorf("unexpected summary %+v for %d targets", summary, sampled)
+	}
+}
+
+func TestUpdatePartitionsSequential(t *testing.T) {
+	bundle := &v1alpha1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "fleet-default"},
+		Spec: v1alpha1.BundleSpec{
+			RolloutStrategy: &v1alpha1.RolloutStrategy{
+				Sequential:      true,
+				RequireApproval: true,
+				Partitions: []v1alpha1.Partition{
+					{Name: "canary", ClusterGroup: "canary"},
+					{Name: "prod", ClusterGroup: "prod"},
+				},
+			},
+		},
+	}
+
+	newTarget := func(name string) *Target {
+		return &Target{
+			Bundle:        bundle,
+			Cluster:       &v1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "fleet-default"}},
+			ClusterGroups: []*v1alpha1.ClusterGroup{{ObjectMeta: metav1.ObjectMeta{Name: name}}},
+			DeploymentID:  "new",
+			Deployment: &v1alpha1.BundleDeployment{
+				Spec:   v1alpha1.BundleDeploymentSpec{DeploymentID: "old", StagedDeploymentID: "old"},
+				Status: v1alpha1.BundleDeploymentStatus{AppliedDeploymentID: "old", Ready: true},
+			},
+		}
+	}
+	canary, prod := newTarget("canary"), newTarget("prod")
+	targets := []*Target{canary, prod}
+
+	status := &v1alpha1.BundleStatus{MaxNew: 50}
+	update := func() {
+		t.Helper()
+		var err error
+		status.Unavailable = Unavailable(targets)
+		status.MaxUnavailable, err = MaxUnavailable(targets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := UpdatePartitions(status, targets); err != nil {
+			t.Fatal(err)
+		}
+	}
+	phases := func() []v1alpha1.PartitionPhase {
+		var result []v1alpha1.PartitionPhase
+		for _, p := range status.PartitionStatus {
+			result = append(result, p.Phase)
+		}
+		return result
+	}
+	applied := func(target *Target) {
+		target.Deployment.Status.AppliedDeploymentID = target.Deployment.Spec.DeploymentID
+	}
+
+	update()
+	if canary.Deployment.Spec.DeploymentID != "new" || prod.Deployment.Spec.DeploymentID != "old" {
+		t.Fatalf("expected only canary to be updated, got %s and %s", canary.Deployment.Spec.DeploymentID, prod.Deployment.Spec.DeploymentID)
+	}
+	if p := phases(); p[0] != v1alpha1.PartitionRollingOut || p[1] != v1alpha1.PartitionPending {
+		t.Fatalf("unexpected phases %v", p)
+	}
+
+	applied(canary)
+	bundle.Spec.RolloutStrategy.SoakDuration = &metav1.Duration{Duration: time.Hour}
+	update()
+	if p := phases(); p[0] != v1alpha1.PartitionSoaking || p[1] != v1alpha1.PartitionPending {
+		t.Fatalf("unexpected phases %v", p)
+	}
+	if d := RequeueAfter(bundle, status); d <= 0 || d > time.Hour {
+		t.Fatalf("unexpected requeue after soaking %s", d)
+	}
+
+	// soak duration passed
+	status.PartitionStatus[0].ReadySince = &metav1.Time{Time: time.Now().Add(-2 * time.Hour)}
+	update()
+	if p := phases(); p[0] != v1alpha1.PartitionDone || p[1] != v1alpha1.PartitionWaitingForApproval {
+		t.Fatalf("unexpected phases %v", p)
+	}
+	if prod.Deployment.Spec.DeploymentID != "old" {
+		t.Fatal("expected prod not to be updated without approval")
+	}
+
+	bundle.Annotations = map[string]string{v1alpha1.PromotedPartitionAnnotation: "prod"}
+	update()
+	if prod.Deployment.Spec.DeploymentID != "new" {
+		t.Fatal("expected prod to be updated after approval")
+	}
+	if p := phases(); p[0] != v1alpha1.PartitionDone || p[1] != v1alpha1.PartitionRollingOut {
+		t.Fatalf("unexpected phases %v", p)
+	}
+}
+
+func TestUpdatePartitionsSequentialMaxUnavailablePartitions(t *testing.T) {
+	bundle := &v1alpha1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "fleet-default"},
+		Spec: v1alpha1.BundleSpec{
+			RolloutStrategy: &v1alpha1.RolloutStrategy{
+				Sequential:               true,
+				MaxUnavailablePartitions: &intstr.IntOrString{Type: intstr.Int, IntVal: 1},
+			},
+		},
+	}
+	targets := []*Target{{
+		Bundle:       bundle,
+		Cluster:      &v1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "one", Namespace: "fleet-default"}},
+		DeploymentID: "new",
+	}}
+
+	if err := UpdatePartitions(&v1alpha1.BundleStatus{MaxNew: 50}, targets); err == nil {
+		t.Fatal("expected maxUnavailablePartitions to be rejected for a sequential rollout")
+	}
+
+	// the bundle reports the invalid strategy in a condition
+	status := &v1alpha1.BundleStatus{}
+	SetRolloutValidCondition(status, ValidateRollout(bundle.Spec.RolloutStrategy))
+	cond := condition.Cond(v1alpha1.BundleConditionRolloutValid)
+	if !cond.IsFalse(status) || !strings.Contains(cond.GetMessage(status), "maxUnavailablePartitions") {
+		t.Errorf("expected the rollout to be reported as invalid, got %+v", status.Conditions)
+	}
+
+	bundle.Spec.RolloutStrategy.MaxUnavailablePartitions = nil
+	SetRolloutValidCondition(status, ValidateRollout(bundle.Spec.RolloutStrategy))
+	if !cond.IsTrue(status) || cond.GetMessage(status) != "" {
+		t.Errorf("expected the fixed rollout to be reported as valid, got %+v", status.Conditions)
+	}
+
+	status = &v1alpha1.BundleStatus{}
+	SetRolloutValidCondition(status, nil)
+	if len(status.Conditions) != 0 {
+		t.Errorf("expected no condition for a bundle, whose rollout was never invalid, got %+v", status.Conditions)
+	}
+}
+
+func TestApplyFailurePolicy(t *testing.T) {
+	bundle := &v1alpha1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "fleet-default", Generation: 2},
+		Spec: v1alpha1.BundleSpec{
+			RolloutStrategy: &v1alpha1.RolloutStrategy{
+				FailurePolicy: &v1alpha1.FailurePolicy{MaxFailures: &intstr.IntOrString{Type: intstr.Int, IntVal: 0}},
+			},
+		},
+	}
+
+	newTarget := func(name string) *Target {
+		return &Target{
+			Bundle:       bundle,
+			Cluster:      &v1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "fleet-default"}},
+			DeploymentID: "new",
+			Deployment: &v1alpha1.BundleDeployment{
+				Spec:   v1alpha1.BundleDeploymentSpec{DeploymentID: "old", StagedDeploymentID: "old", Options: v1alpha1.BundleDeploymentOptions{DefaultNamespace: "old"}},
+				Status: v1alpha1.BundleDeploymentStatus{AppliedDeploymentID: "old", Ready: true},
+			},
+		}
+	}
+	failing, pending := newTarget("failing"), newTarget("pending")
+	targets := []*Target{failing, pending}
+
+	status := &v1alpha1.BundleStatus{ObservedGeneration: 2}
+	if err := ApplyFailurePolicy(status, bundle, targets); err != nil {
+		t.Fatal(err)
+	}
+	if failing.Deployment.Spec.KnownGoodDeploymentID != "old" {
+		t.Fatal("expected ready deployment to be recorded as known good")
+	}
+	if condition.Cond(v1alpha1.BundleConditionRolledBack).GetStatus(status) != "" {
+		t.Fatal("expected no rolled back condition before a rollback")
+	}
+
+	// the new deployment fails to apply on the first cluster
+	failing.Deployment.Spec.DeploymentID = "new"
+	failing.Deployment.Spec.Options = v1alpha1.BundleDeploymentOptions{DefaultNamespace: "new"}
+	failing.Deployment.Status.Conditions = []genericcondition.GenericCondition{
+		{Type: v1alpha1.BundleDeploymentConditionDeployed, Status: "False", Message: "failed"},
+	}
+
+	if err := ApplyFailurePolicy(status, bundle, targets); err != nil {
+		t.Fatal(err)
+	}
+	if status.RolledBackGeneration != 2 {
+		t.Fatalf("expected generation to be rolled back, got %d", status.RolledBackGeneration)
+	}
+	if failing.Deployment.Spec.DeploymentID != "old" || failing.Deployment.Spec.Options.DefaultNamespace != "old" {
+		t.Fatalf("expected deployment to be reverted, got %s", failing.Deployment.Spec.DeploymentID)
+	}
+	if !condition.Cond(v1alpha1.BundleConditionRolledBack).IsTrue(status) {
+		t.Fatal("expected rolled back condition")
+	}
+
+	status.MaxNew = 50
+	status.MaxUnavailable = 10
+	if err := UpdatePartitions(status, targets); err != nil {
+		t.Fatal(err)
+	}
+	if pending.Deployment.Spec.DeploymentID != "old" || failing.Deployment.Spec.DeploymentID != "old" {
+		t.Fatal("expected rollout to be halted")
+	}
+	if pending.Deployment.Spec.StagedDeploymentID != "new" {
+		t.Fatal("expected new deployment to stay staged")
+	}
+}
+
+func TestMaxFailuresDefault(t *testing.T) {
+	for count, expected := range map[int]int{1: 1, 3: 1, 20: 2, 100: 10} {
+		n, err := maxFailures(count, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != expected {
+			t.Errorf("maxFailures(%d, nil) = %d, expected %d", count, n, expected)
+		}
+	}
+}
+
+func TestMaintenanceHold(t *testing.T) {
+	// weekdays from 10pm to midnight in Berlin
+	window := v1alpha1.MaintenanceWindow{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly"},
+		Spec: v1alpha1.MaintenanceWindowSpec{
+			Schedule:        "0 0 22 ? * MON-FRI",
+			Duration:        metav1.Duration{Duration: 2 * time.Hour},
+			TimeZone:        "Europe/Berlin",
+			ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+		},
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+
+	prod := &v1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"env": "prod"}}}
+	dev := &v1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "dev", Labels: map[string]string{"env": "dev"}}}
+	windows := []v1alpha1.MaintenanceWindow{window}
+
+	// Wednesday afternoon
+	afternoon := time.Date(2024, 3, 13, 15, 0, 0, 0, berlin)
+	hold := maintenanceHold(context.TODO(), windows, prod, nil, afternoon)
+	if hold == nil || hold.Reason != v1alpha1.PendingReasonMaintenanceWindow {
+		t.Fatalf("expected cluster to be held back, got %+v", hold)
+	}
+	if expected := time.Date(2024, 3, 13, 22, 0, 0, 0, berlin); hold.Until == nil || !hold.Until.Time.Equal(expected) {
+		t.Fatalf("expected hold until %s, got %v", expected, hold.Until)
+	}
+
+	if hold := maintenanceHold(context.TODO(), windows, dev, nil, afternoon); hold != nil {
+		t.Fatalf("expected cluster without maintenance window not to be held back, got %+v", hold)
+	}
+
+	// Wednesday night, while the window is open
+	night := time.Date(2024, 3, 13, 23, 30, 0, 0, berlin)
+	if hold := maintenanceHold(context.TODO(), windows, prod, nil, night); hold != nil {
+		t.Fatalf("expected open window not to hold back cluster, got %+v", hold)
+	}
+
+	// Saturday night
+	saturday := time.Date(2024, 3, 16, 23, 0, 0, 0, berlin)
+	hold = maintenanceHold(context.TODO(), windows, prod, nil, saturday)
+	if expected := time.Date(2024, 3, 18, 22, 0, 0, 0, berlin); hold == nil || hold.Until == nil || !hold.Until.Time.Equal(expected) {
+		t.Fatalf("expected hold until monday, got %+v", hold)
+	}
+
+	target := &Target{
+		Bundle:     &v1alpha1.Bundle{},
+		Cluster:    prod,
+		Hold:       hold,
+		Deployment: &v1alpha1.BundleDeployment{Spec: v1alpha1.BundleDeploymentSpec{DeploymentID: "old", StagedDeploymentID: "new"}},
+	}
+	status := &v1alpha1.BundleStatus{MaxUnavailable: 10}
+	updateTarget(target, status, &v1alpha1.PartitionStatus{MaxUnavailable: 10})
+	if target.Deployment.Spec.DeploymentID != "old" {
+		t.Fatal("expected held back target to keep its deployment")
+	}
+}
+
+func TestTargetsFreeze(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	end := metav1.NewTime(now.Add(time.Hour).Truncate(time.Second))
+	cluster := func(name, env string) *v1alpha1.Cluster {
+		return &v1alpha1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "fleet-default", Labels: map[string]string{"env": env}},
+			Status:     v1alpha1.ClusterStatus{Namespace: "cluster-" + name},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "fleet-default", Labels: map[string]string{"tier": "prod"}}},
+		cluster("prod", "prod"),
+		cluster("dev", "dev"),
+		&v1alpha1.DeploymentFreeze{
+			ObjectMeta: metav1.ObjectMeta{Name: "holidays"},
+			Spec: v1alpha1.DeploymentFreezeSpec{
+				Reason:            "end of year",
+				End:               &end,
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "prod"}},
+				ClusterSelector:   &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			},
+		},
+		&v1alpha1.DeploymentFreeze{
+			ObjectMeta: metav1.ObjectMeta{Name: "past"},
+			Spec: v1alpha1.DeploymentFreezeSpec{
+				End: &metav1.Time{Time: now.Add(-time.Hour)},
+			},
+		},
+		&v1alpha1.DeploymentFreeze{
+			ObjectMeta: metav1.ObjectMeta{Name: "other-bundles"},
+			Spec: v1alpha1.DeploymentFreezeSpec{
+				BundleSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}},
+			},
+		},
+	).Build()
+
+	bundle := &v1alpha1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "fleet-default", Labels: map[string]string{"app": "app"}},
+		Spec: v1alpha1.BundleSpec{
+			Targets: []v1alpha1.BundleTarget{{Name: "all", ClusterSelector: &metav1.LabelSelector{}}},
+		},
+	}
+	targets, _, err := New(c).Targets(context.TODO(), bundle, "s-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("expected 2 targets, got %d", len(targets))
+	}
+
+	for _, target := range targets {
+		switch target.Cluster.Name {
+		case "dev":
+			if target.Hold != nil {
+				t.Fatalf("expected dev cluster not to be frozen, got %+v", target.Hold)
+			}
+		case "prod":
+			hold := target.Hold
+			if hold == nil || hold.Reason != v1alpha1.PendingReasonDeploymentFreeze {
+				t.Fatalf("expected prod cluster to be frozen, got %+v", hold)
+			}
+			if expected := "deployment freeze holidays is active: end of year"; hold.Message != expected {
+				t.Fatalf("expected message %q, got %q", expected, hold.Message)
+			}
+			if hold.Until == nil || !hold.Until.Equal(&end) {
+				t.Fatalf("expected hold until %s, got %v", end, hold.Until)
+			}
+		}
+	}
+
+	status := &v1alpha1.BundleStatus{}
+	SetFrozenCondition(status, targets)
+	if !condition.Cond(v1alpha1.BundleConditionFrozen).IsTrue(status) {
+		t.Fatalf("expected bundle to be frozen, got %+v", status.Conditions)
+	}
+
+	SetFrozenCondition(status, nil)
+	if !condition.Cond(v1alpha1.BundleConditionFrozen).IsFalse(status) {
+		t.Fatalf("expected bundle not to be frozen anymore, got %+v", status.Conditions)
+	}
+}
+
+func TestTargetsClusterDependency(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := func(name, role string) *v1alpha1.Cluster {
+		return &v1alpha1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "fleet-default", Labels: map[string]string{"role": role}},
+			Status:     v1alpha1.ClusterStatus{Namespace: "cluster-" + name},
+		}
+	}
+	registry := &v1alpha1.BundleDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "registry",
+			Namespace: "cluster-central",
+			Labels: map[string]string{
+				v1alpha1.BundleLabel:          "registry",
+				v1alpha1.BundleNamespaceLabel: "fleet-default",
+			},
+		},
+	}
+	bundle := &v1alpha1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "fleet-default"},
+		Spec: v1alpha1.BundleSpec{
+			Targets:   []v1alpha1.BundleTarget{{Name: "edge", ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "edge"}}}},
+			DependsOn: []v1alpha1.BundleRef{{Name: "registry", ClusterName: "central"}},
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster("central", "central"), cluster("edge", "edge"), registry).Build()
+	targets, _, err := New(c).Targets(context.TODO(), bundle, "s-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 {
+		t.Fatalf("expected 1 target, got %d", len(targets))
+	}
+	hold := targets[0].Hold
+	if hold == nil || hold.Reason != v1alpha1.PendingReasonClusterDependency {
+		t.Fatalf("expected target to wait for the registry, got %+v", hold)
+	}
+	if expected := "waiting for dependencies on other clusters: cluster central: bundle registry is not ready"; hold.Message != expected {
+		t.Fatalf("expected message %q, got %q", expected, hold.Message)
+	}
+
+	condition.Cond(v1alpha1.BundleDeploymentConditionReady).SetStatusBool(registry, true)
+	c = fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster("central", "central"), cluster("edge", "edge"), registry).Build()
+	targets, _, err = New(c).Targets(context.TODO(), bundle, "s-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets[0].Hold != nil {
+		t.Fatalf("expected ready dependency not to hold back the target, got %+v", targets[0].Hold)
+	}
+
+	bundle.Spec.DependsOn = []v1alpha1.BundleRef{{Name: "broker", ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "central"}}}}
+	targets, _, err = New(c).Targets(context.TODO(), bundle, "s-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hold := targets[0].Hold; hold == nil || hold.Message != "waiting for dependencies on other clusters: cluster central: no bundle matching labels fleet.cattle.io/bundle-name=broker,fleet.cattle.io/bundle-namespace=fleet-default is deployed" {
+		t.Fatalf("expected target to wait for the undeployed broker, got %+v", hold)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"sync"
 
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 	"github.com/rancher/fleet/pkg/version"
 
 	corev1 "github.com/rancher/wrangler/v2/pkg/generated/controllers/core/v1"
@@ -67,6 +68,10 @@ type Config struct {
 	// AgentCheckinInterval determines how often agents update their clusters status, defaults to 15m
 	AgentCheckinInterval metav1.Duration `json:"agentCheckinInterval,omitempty"`
 
+	// AgentNodeLabels are the keys of node labels, which agents report in
+	// their cluster's status. The values are mirrored as cluster labels.
+	AgentNodeLabels []string `json:"agentNodeLabels,omitempty"`
+
 	// ManageAgent if present and set to false, no bundles will be created to manage agents
 	ManageAgent *bool `json:"manageAgent,omitempty"`
 
@@ -101,6 +106,42 @@ type Config struct {
 
 	// IgnoreClusterRegistrationLabels if set to true, the labels on the cluster registration resource will not be copied to the cluster resource.
 	IgnoreClusterRegistrationLabels bool `json:"ignoreClusterRegistrationLabels,omitempty"`
+
+	// DriftIgnore lists fields, which the agent ignores when checking
+	// deployed resources for modifications, in addition to the diff
+	// options of each bundle. Used by the agent only.
+	// +optional
+	DriftIgnore []DriftIgnoreRule `json:"driftIgnore,omitempty"`
+
+	// DisableDefaultDriftIgnore disables the built-in rules for well-known
+	// mutations, like the replicas of resources scaled by a
+	// HorizontalPodAutoscaler or injected webhook CA bundles. Used by the
+	// agent only.
+	// +optional
+	DisableDefaultDriftIgnore bool `json:"disableDefaultDriftIgnore,omitempty"`
+
+	// HealthChecks compute the readiness of resources, which the agent
+	// cannot summarize. The health checks of a bundle take precedence.
+	// Used by the agent only.
+	// +optional
+	HealthChecks []fleet.HealthCheck `json:"healthChecks,omitempty"`
+}
+
+// DriftIgnoreRule selects resources and the fields, which are ignored when
+// checking them for modifications. The selectors are glob patterns, e.g.
+// "*.cert-manager.io", empty selectors match all resources.
+type DriftIgnoreRule struct {
+	Group     string `json:"group,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	// JSONPointers are RFC 6901 pointers to the ignored fields, e.g.
+	// "/spec/replicas".
+	JSONPointers []string `json:"jsonPointers,omitempty"`
+	// JSONPaths are JSONPath expressions of the ignored fields, consisting
+	// of field names and [*] or [index] subscripts, e.g.
+	// "{.webhooks[*].clientConfig.caBundle}".
+	JSONPaths []string `json:"jsonPaths,omitempty"`
 }
 
 type Bootstrap struct {
@@ -0,0 +1,250 @@
+// Package dependency builds the graph of the bundles deployed to a cluster and
+// their dependsOn references. It resolves references the same way as the
+// agent does at deploy time.
+package dependency
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Graph contains the bundles deployed to a single cluster. The nodes are
+// identified by the bundle's namespace and name, e.g. "fleet-default/app".
+type Graph struct {
+	nodes map[string]*node
+}
+
+type node struct {
+	namespace string
+	labels    labels.Set
+	dependsOn []fleet.BundleRef
+}
+
+// Edge is a resolved dependsOn reference
+type Edge struct {
+	From string
+	To   string
+}
+
+// New returns an empty graph
+func New() *Graph {
+	return &Graph{nodes: map[string]*node{}}
+}
+
+// FromBundleDeployments returns the graph of the bundledeployments in a
+// cluster's namespace
+func FromBundleDeployments(bds []fleet.BundleDeployment) *Graph {
+	g := New()
+	for _, bd := range bds {
+		g.Add(bd.Labels[fleet.BundleNamespaceLabel], bd.Labels[fleet.BundleLabel], bd.Labels, bd.Spec.DependsOn)
+	}
+	return g
+}
+
+// Key returns the key of a bundle in the graph
+func Key(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// Add adds a bundle, which is deployed to the cluster, replacing an existing
+// node for the same bundle. The labels are the labels of its bundledeployment.
+func (g *Graph) Add(namespace, name string, l map[string]string, dependsOn []fleet.BundleRef) {
+	if name == "" {
+		return
+	}
+	g.nodes[Key(namespace, name)] = &node{
+		namespace: namespace,
+		labels:    labels.Set(l),
+		dependsOn: dependsOn,
+	}
+}
+
+// Keys returns the sorted keys of all bundles in the graph
+func (g *Graph) Keys() []string {
+	keys := make([]string, 0, len(g.nodes))
+	for k := range g.nodes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Dependencies returns the keys of the bundles the bundle depends on and a
+// description of every reference, which matches no bundle in the cluster.
+func (g *Graph) Dependencies(key string) ([]string, []string, error) {
+	n, ok := g.nodes[key]
+	if !ok {
+		return nil, nil, nil
+	}
+
+	var (
+		deps        []string
+		unsatisfied []string
+	)
+	seen := map[string]bool{}
+	for _, ref := range n.dependsOn {
+		// skip empty references, the agent ignores them as well, and
+		// references to bundles on other clusters
+		if ref.Name == "" && ref.Selector == nil || ref.ClusterName != "" || ref.ClusterSelector != nil {
+			continue
+		}
+		selector, err := Selector(ref, n.namespace)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		found := false
+		for _, k := range g.Keys() {
+			if !selector.Matches(g.nodes[k].labels) {
+				continue
+			}
+			found = true
+			if !seen[k] {
+				seen[k] = true
+				deps = append(deps, k)
+			}
+		}
+		if !found {
+			unsatisfied = append(unsatisfied, describe(ref))
+		}
+	}
+
+	return deps, unsatisfied, nil
+}
+
+// Cycle returns the keys along a dependency cycle, which is reachable from
+// the bundle, e.g. ["ns/a", "ns/b", "ns/a"], or nil if there is none.
+func (g *Graph) Cycle(key string) ([]string, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var path []string
+
+	var visit func(k string) ([]string, error)
+	visit = func(k string) ([]string, error) {
+		state[k] = visiting
+		path = append(path, k)
+
+		deps, _, err := g.Dependencies(k)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deps {
+			switch state[d] {
+			case visiting:
+				for i, p := range path {
+					if p == d {
+						return append(append([]string{}, path[i:]...), d), nil
+					}
+				}
+			case done:
+				continue
+			default:
+				if cycle, err := visit(d); cycle != nil || err != nil {
+					return cycle, err
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[k] = done
+		return nil, nil
+	}
+
+	if _, ok := g.nodes[key]; !ok {
+		return nil, nil
+	}
+	return visit(key)
+}
+
+// Edges returns all resolved dependencies and, for every bundle, the
+// references which match no bundle in the cluster.
+func (g *Graph) Edges() ([]Edge, map[string][]string, error) {
+	var edges []Edge
+	unsatisfied := map[string][]string{}
+	for _, k := range g.Keys() {
+		deps, missing, err := g.Dependencies(k)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, d := range deps {
+			edges = append(edges, Edge{From: k, To: d})
+		}
+		if len(missing) > 0 {
+			unsatisfied[k] = missing
+		}
+	}
+	return edges, unsatisfied, nil
+}
+
+// WriteDOT writes the graph in the DOT language of Graphviz. Unsatisfiable
+// references are drawn as dashed red edges to a placeholder node.
+func (g *Graph) WriteDOT(w io.Writer, name string) error {
+	edges, unsatisfied, err := g.Edges()
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "digraph %s {\n", strconv.Quote(name)); err != nil {
+		return err
+	}
+	for _, k := range g.Keys() {
+		if _, err := fmt.Fprintf(w, "  %s;\n", strconv.Quote(k)); err != nil {
+			return err
+		}
+	}
+	for _, e := range edges {
+		if _, err := fmt.Fprintf(w, "  %s -> %s;\n", strconv.Quote(e.From), strconv.Quote(e.To)); err != nil {
+			return err
+		}
+	}
+	for _, k := range g.Keys() {
+		for _, ref := range unsatisfied[k] {
+			missing := strconv.Quote("missing: " + ref)
+			if _, err := fmt.Fprintf(w, "  %s [shape=box, style=dashed, color=red];\n  %s -> %s [style=dashed, color=red];\n", missing, strconv.Quote(k), missing); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = fmt.Fprintln(w, "}")
+	return err
+}
+
+// Selector returns the label selector for the bundledeployments of a dependsOn
+// reference. The name is a shortcut for the bundle name label in the
+// namespace of the depending bundle.
+func Selector(ref fleet.BundleRef, namespace string) (labels.Selector, error) {
+	ls := &metav1.LabelSelector{}
+	if ref.Selector != nil {
+		ls = ref.Selector.DeepCopy()
+	}
+	if ref.Name != "" {
+		ls = metav1.AddLabelToSelector(ls, fleet.BundleLabel, ref.Name)
+		ls = metav1.AddLabelToSelector(ls, fleet.BundleNamespaceLabel, namespace)
+	}
+	return metav1.LabelSelectorAsSelector(ls)
+}
+
+// describe returns a human readable description of the reference
+func describe(ref fleet.BundleRef) string {
+	if ref.Selector == nil {
+		return ref.Name
+	}
+	selector, err := metav1.LabelSelectorAsSelector(ref.Selector)
+	if err != nil {
+		return ref.Name
+	}
+	if ref.Name == "" {
+		return selector.String()
+	}
+	return ref.Name + " (" + selector.String() + ")"
+}
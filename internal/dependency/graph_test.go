@@ -0,0 +1,65 @@
+package dependency_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/fleet/internal/dependency"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func bd(name string, l map[string]string, dependsOn ...fleet.BundleRef) fleet.BundleDeployment {
+	labels := map[string]string{
+		fleet.BundleLabel:          name,
+		fleet.BundleNamespaceLabel: "fleet-default",
+	}
+	for k, v := range l {
+		labels[k] = v
+	}
+	return fleet.BundleDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cluster-prod", Labels: labels},
+		Spec:       fleet.BundleDeploymentSpec{DependsOn: dependsOn},
+	}
+}
+
+func TestGraph(t *testing.T) {
+	graph := dependency.FromBundleDeployments([]fleet.BundleDeployment{
+		bd("app", nil, fleet.BundleRef{Name: "db"}, fleet.BundleRef{Name: "cache"}),
+		bd("db", map[string]string{"tier": "data"}, fleet.BundleRef{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "operator"}}}),
+		bd("operator", map[string]string{"role": "operator"}, fleet.BundleRef{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "data"}}}),
+		bd("monitoring", nil, fleet.BundleRef{}),
+	})
+
+	deps, unsatisfied, err := graph.Dependencies("fleet-default/app")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fleet-default/db"}, deps)
+	assert.Equal(t, []string{"cache"}, unsatisfied)
+
+	cycle, err := graph.Cycle("fleet-default/app")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fleet-default/db", "fleet-default/operator", "fleet-default/db"}, cycle)
+
+	cycle, err = graph.Cycle("fleet-default/monitoring")
+	require.NoError(t, err)
+	assert.Nil(t, cycle)
+
+	var buf bytes.Buffer
+	require.NoError(t, graph.WriteDOT(&buf, "fleet-default/prod"))
+	assert.Equal(t, `digraph "fleet-default/prod" {
+  "fleet-default/app";
+  "fleet-default/db";
+  "fleet-default/monitoring";
+  "fleet-default/operator";
+  "fleet-default/app" -> "fleet-default/db";
+  "fleet-default/db" -> "fleet-default/operator";
+  "fleet-default/operator" -> "fleet-default/db";
+  "missing: cache" [shape=box, style=dashed, color=red];
+  "fleet-default/app" -> "missing: cache" [style=dashed, color=red];
+}
+`, buf.String())
+}
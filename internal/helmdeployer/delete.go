@@ -24,6 +24,14 @@ func (h *Helm) DeleteRelease(ctx context.Context, deployment DeployedBundle) err
 // Delete the release for the given bundleID. The bundleID is the name of the
 // bundledeployment.
 func (h *Helm) Delete(ctx context.Context, bundleID string) error {
+	// the bundle might have been deployed with server-side apply
+	if err := h.DeleteInventory(ctx, bundleID); err != nil {
+		return err
+	}
+	if err := h.DeleteHooks(ctx, bundleID); err != nil {
+		return err
+	}
+
 	releaseName := ""
 	keepResources := false
 	deployments, err := h.ListDeployments(h.NewListAction())
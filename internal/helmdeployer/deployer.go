@@ -3,6 +3,7 @@ package helmdeployer
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -49,6 +50,11 @@ type Helm struct {
 	defaultNamespace string
 	labelPrefix      string
 	labelSuffix      string
+
+	// applyClients caches the clients used for server-side apply by
+	// service account
+	applyClients     map[string]client.Client
+	applyClientsLock sync.Mutex
 }
 
 type Resources struct {
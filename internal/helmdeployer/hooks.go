@@ -0,0 +1,228 @@
+package helmdeployer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rancher/fleet/internal/content"
+	"github.com/rancher/fleet/internal/helmdeployer/render"
+	"github.com/rancher/fleet/internal/manifest"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// HookBundleIDLabel is the bundledeployment of a hook job
+	HookBundleIDLabel = "fleet.cattle.io/hook-bundle-id"
+	// HookPhaseLabel is the phase a hook job runs in, e.g. "preDeploy"
+	HookPhaseLabel = "fleet.cattle.io/hook-phase"
+	// HookPathAnnotation is the path of the hook job's manifest in the bundle
+	HookPathAnnotation = "fleet.cattle.io/hook-path"
+	// HookDeploymentIDAnnotation is the deployment ID the hook job runs for
+	HookDeploymentIDAnnotation = "fleet.cattle.io/hook-deployment-id"
+
+	HookPreDeploy  = "preDeploy"
+	HookPostDeploy = "postDeploy"
+
+	DefaultHookTimeout = 10 * time.Minute
+)
+
+// HookResult describes the jobs of a hook phase, which did not complete
+type HookResult struct {
+	Pending []string
+	Failed  []string
+}
+
+func (r HookResult) Completed() bool {
+	return len(r.Pending) == 0 && len(r.Failed) == 0
+}
+
+// RunHooks starts the jobs of the hooks for the bundledeployment's current
+// deployment ID, unless they exist already, and returns their state. Jobs of
+// previous deployments are deleted. The manifest is only loaded if jobs need
+// to be started. Jobs, which the cluster owner's policy does not permit,
+// are not started.
+func (h *Helm) RunHooks(ctx context.Context, bd *fleet.BundleDeployment, phase string, hooks []fleet.DeploymentHook, load func(context.Context) (*manifest.Manifest, error)) (HookResult, error) {
+	logger := log.FromContext(ctx).WithName("RunHooks").WithValues("phase", phase)
+	result := HookResult{}
+
+	jobs := &batchv1.JobList{}
+	if err := h.client.List(ctx, jobs, client.MatchingLabels{HookBundleIDLabel: bd.Name, HookPhaseLabel: phase}); err != nil {
+		return result, err
+	}
+
+	c, err := h.applyClient(ctx, bd.Spec.Options.ServiceAccount)
+	if err != nil {
+		return result, err
+	}
+
+	current := map[string]*batchv1.Job{}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Annotations[HookDeploymentIDAnnotation] == bd.Spec.DeploymentID {
+			if job.DeletionTimestamp == nil {
+				current[job.Annotations[HookPathAnnotation]] = job
+			}
+			continue
+		}
+		if err := deleteJob(ctx, c, job); err != nil {
+			return result, err
+		}
+	}
+
+	policy, err := h.Policy(ctx, bd)
+	if err != nil {
+		return result, err
+	}
+
+	_, defaultNamespace, _ := h.getOpts(bd.Name, bd.Spec.Options)
+	var m *manifest.Manifest
+	for _, hook := range hooks {
+		hookPath := render.CleanPath(hook.Path)
+		if job, ok := current[hookPath]; ok {
+			pending, failed := jobState(job, hookTimeout(hook), time.Now())
+			switch {
+			case failed != "":
+				result.Failed = append(result.Failed, fmt.Sprintf("job %s/%s: %s%s", job.Namespace, job.Name, failed, h.jobLogs(ctx, job)))
+			case pending:
+				result.Pending = append(result.Pending, fmt.Sprintf("job %s/%s", job.Namespace, job.Name))
+			}
+			continue
+		}
+
+		if m == nil {
+			if m, err = load(ctx); err != nil {
+				return result, err
+			}
+		}
+		job, err := hookJob(m, bd, phase, hookPath, defaultNamespace)
+		if err != nil {
+			return result, err
+		}
+		if err := policy.Check(batchv1.SchemeGroupVersion.WithKind("Job"), job.Namespace, job.Name, false); err != nil {
+			return result, fmt.Errorf("%s hook %s: %w", phase, hookPath, err)
+		}
+		logger.Info("Starting hook job", "job", job.Namespace+"/"+job.Name, "path", hookPath)
+		if err := startJob(ctx, c, job); err != nil {
+			return result, err
+		}
+		result.Pending = append(result.Pending, fmt.Sprintf("job %s/%s", job.Namespace, job.Name))
+	}
+
+	return result, nil
+}
+
+// DeleteHooks deletes the hook jobs and helm test pods of the
+// bundledeployment
+func (h *Helm) DeleteHooks(ctx context.Context, bundleID string) error {
+	jobs := &batchv1.JobList{}
+	if err := h.client.List(ctx, jobs, client.MatchingLabels{HookBundleIDLabel: bundleID}); err != nil {
+		return err
+	}
+	for i := range jobs.Items {
+		if err := deleteJob(ctx, h.client, &jobs.Items[i]); err != nil {
+			return err
+		}
+	}
+	pods := &corev1.PodList{}
+	if err := h.client.List(ctx, pods, client.MatchingLabels{HookBundleIDLabel: bundleID, HookPhaseLabel: HookHelmTest}); err != nil {
+		return err
+	}
+	for i := range pods.Items {
+		if err := client.IgnoreNotFound(h.client.Delete(ctx, &pods.Items[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startJob creates the job. A hook job with the same name from a previous
+// deployment is deleted first, the job is then created by a later call.
+func startJob(ctx context.Context, c client.Client, job *batchv1.Job) error {
+	old := &batchv1.Job{}
+	err := c.Get(ctx, client.ObjectKeyFromObject(job), old)
+	if err == nil {
+		if old.Labels[HookBundleIDLabel] != job.Labels[HookBundleIDLabel] {
+			return fmt.Errorf("%s hook %s: job %s/%s exists and is not a hook of the bundle", job.Labels[HookPhaseLabel], job.Annotations[HookPathAnnotation], job.Namespace, job.Name)
+		}
+		return deleteJob(ctx, c, old)
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+	return client.IgnoreAlreadyExists(c.Create(ctx, job, client.FieldOwner(FieldManager)))
+}
+
+func deleteJob(ctx context.Context, c client.Client, job *batchv1.Job) error {
+	return client.IgnoreNotFound(c.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)))
+}
+
+// hookJob returns the job of the hook from the manifest (pure function)
+func hookJob(m *manifest.Manifest, bd *fleet.BundleDeployment, phase, hookPath, defaultNamespace string) (*batchv1.Job, error) {
+	for _, resource := range m.Resources {
+		if render.CleanPath(resource.Name) != hookPath {
+			continue
+		}
+		data, err := content.Decode(resource.Content, resource.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("%s hook %s: %w", phase, hookPath, err)
+		}
+		job := &batchv1.Job{}
+		if err := yaml.Unmarshal(data, job); err != nil {
+			return nil, fmt.Errorf("%s hook %s: %w", phase, hookPath, err)
+		}
+		if job.APIVersion != batchv1.SchemeGroupVersion.String() || job.Kind != "Job" {
+			return nil, fmt.Errorf("%s hook %s: expected a batch/v1 Job, found %s %s", phase, hookPath, job.APIVersion, job.Kind)
+		}
+		if job.Namespace == "" {
+			job.Namespace = defaultNamespace
+		}
+		job.Labels = mergeMaps(job.Labels, map[string]string{
+			HookBundleIDLabel: bd.Name,
+			HookPhaseLabel:    phase,
+		})
+		job.Annotations = mergeMaps(job.Annotations, map[string]string{
+			HookPathAnnotation:         hookPath,
+			HookDeploymentIDAnnotation: bd.Spec.DeploymentID,
+		})
+		return job, nil
+	}
+	return nil, fmt.Errorf("%s hook %s: file not found in bundle", phase, hookPath)
+}
+
+// jobState returns whether the job is still running, or why it failed
+// (pure function)
+func jobState(job *batchv1.Job, timeout time.Duration, now time.Time) (bool, string) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return false, ""
+		case batchv1.JobFailed:
+			if c.Message != "" {
+				return false, c.Message
+			}
+			return false, "failed"
+		}
+	}
+	if now.Sub(job.CreationTimestamp.Time) > timeout {
+		return false, fmt.Sprintf("did not complete within %s", timeout)
+	}
+	return true, ""
+}
+
+func hookTimeout(hook fleet.DeploymentHook) time.Duration {
+	if hook.Timeout != nil && hook.Timeout.Duration > 0 {
+		return hook.Timeout.Duration
+	}
+	return DefaultHookTimeout
+}
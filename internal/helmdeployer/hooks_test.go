@@ -0,0 +1,62 @@
+package helmdeployer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/fleet/internal/helmdeployer/render"
+	"github.com/rancher/fleet/internal/manifest"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHookJob(t *testing.T) {
+	bd := &fleet.BundleDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app"},
+		Spec:       fleet.BundleDeploymentSpec{DeploymentID: "s-123:abc"},
+	}
+	m := manifest.New([]fleet.BundleResource{
+		{Name: "deployment.yaml", Content: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n"},
+		{Name: "hooks/migrate.yaml", Content: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n  labels:\n    app: web\n"},
+	})
+
+	job, err := hookJob(m, bd, HookPreDeploy, render.CleanPath("./hooks/migrate.yaml"), "app-ns")
+	require.NoError(t, err)
+	assert.Equal(t, "app-ns", job.Namespace)
+	assert.Equal(t, map[string]string{"app": "web", HookBundleIDLabel: "app", HookPhaseLabel: HookPreDeploy}, job.Labels)
+	assert.Equal(t, map[string]string{HookPathAnnotation: "hooks/migrate.yaml", HookDeploymentIDAnnotation: "s-123:abc"}, job.Annotations)
+
+	_, err = hookJob(m, bd, HookPreDeploy, "deployment.yaml", "app-ns")
+	assert.ErrorContains(t, err, "expected a batch/v1 Job")
+
+	_, err = hookJob(m, bd, HookPostDeploy, "hooks/missing.yaml", "app-ns")
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestJobState(t *testing.T) {
+	now := time.Now()
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-time.Minute))}}
+
+	pending, failed := jobState(job, DefaultHookTimeout, now)
+	assert.True(t, pending)
+	assert.Empty(t, failed)
+
+	pending, failed = jobState(job, 30*time.Second, now)
+	assert.False(t, pending)
+	assert.Equal(t, "did not complete within 30s", failed)
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"}}
+	_, failed = jobState(job, DefaultHookTimeout, now)
+	assert.Equal(t, "Job has reached the specified backoff limit", failed)
+
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	pending, failed = jobState(job, 30*time.Second, now)
+	assert.False(t, pending)
+	assert.Empty(t, failed)
+}
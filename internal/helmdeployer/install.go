@@ -17,13 +17,15 @@ import (
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // Deploy deploys an unpacked content resource with helm. bundleID is the name of the bundledeployment.
-func (h *Helm) Deploy(ctx context.Context, bundleID string, manifest *manifest.Manifest, options fleet.BundleDeploymentOptions) (*Resources, error) {
+// The rendered objects are checked against the policy, if not nil.
+func (h *Helm) Deploy(ctx context.Context, bundleID string, manifest *manifest.Manifest, options fleet.BundleDeploymentOptions, policy *BundlePolicy) (*Resources, error) {
 	if options.Helm == nil {
 		options.Helm = &fleet.HelmOptions{}
 	}
@@ -31,6 +33,28 @@ func (h *Helm) Deploy(ctx context.Context, bundleID string, manifest *manifest.M
 		options.Kustomize = &fleet.KustomizeOptions{}
 	}
 
+	chart, err := h.loadChart(bundleID, manifest, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if resources, err := h.install(ctx, bundleID, manifest, chart, options, policy, true); err != nil {
+		return nil, err
+	} else if h.template {
+		return releaseToResources(resources)
+	}
+
+	release, err := h.install(ctx, bundleID, manifest, chart, options, policy, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return releaseToResources(release)
+}
+
+// loadChart wraps the manifest into a chart and annotates it with the
+// bundle's metadata
+func (h *Helm) loadChart(bundleID string, manifest *manifest.Manifest, options fleet.BundleDeploymentOptions) (*chart.Chart, error) {
 	tar, err := render.HelmChart(bundleID, manifest, options)
 	if err != nil {
 		return nil, err
@@ -59,22 +83,11 @@ func (h *Helm) Deploy(ctx context.Context, bundleID string, manifest *manifest.M
 		chart.Schema = nil
 	}
 
-	if resources, err := h.install(ctx, bundleID, manifest, chart, options, true); err != nil {
-		return nil, err
-	} else if h.template {
-		return releaseToResources(resources)
-	}
-
-	release, err := h.install(ctx, bundleID, manifest, chart, options, false)
-	if err != nil {
-		return nil, err
-	}
-
-	return releaseToResources(release)
+	return chart, nil
 }
 
 // install runs helm install or upgrade and supports dry running the action. Will run helm rollback in case of a failed upgrade.
-func (h *Helm) install(ctx context.Context, bundleID string, manifest *manifest.Manifest, chart *chart.Chart, options fleet.BundleDeploymentOptions, dryRun bool) (*release.Release, error) {
+func (h *Helm) install(ctx context.Context, bundleID string, manifest *manifest.Manifest, chart *chart.Chart, options fleet.BundleDeploymentOptions, policy *BundlePolicy, dryRun bool) (*release.Release, error) {
 	logger := log.FromContext(ctx).WithName("HelmDeployer").WithName("install").WithValues("commit", manifest.Commit, "dryRun", dryRun)
 	timeout, defaultNamespace, releaseName := h.getOpts(bundleID, options)
 
@@ -109,12 +122,14 @@ func (h *Helm) install(ctx context.Context, bundleID string, manifest *manifest.
 	}
 
 	pr := &postRender{
-		labelPrefix: h.labelPrefix,
-		labelSuffix: h.labelSuffix,
-		bundleID:    bundleID,
-		manifest:    manifest,
-		opts:        options,
-		chart:       chart,
+		labelPrefix:      h.labelPrefix,
+		labelSuffix:      h.labelSuffix,
+		bundleID:         bundleID,
+		manifest:         manifest,
+		opts:             options,
+		chart:            chart,
+		policy:           policy,
+		defaultNamespace: defaultNamespace,
 	}
 
 	if !h.useGlobalCfg {
@@ -150,6 +165,9 @@ func (h *Helm) install(ctx context.Context, bundleID string, manifest *manifest.
 			u.Wait = true
 		}
 		if !dryRun {
+			if err := h.checkUnrendered(&cfg, chart, values, releaseName, defaultNamespace, policy, pr.mapper, true); err != nil {
+				return nil, err
+			}
 			logger.Info("Installing helm release")
 		}
 		return u.Run(chart, values)
@@ -174,6 +192,10 @@ func (h *Helm) install(ctx context.Context, bundleID string, manifest *manifest.
 		u.Wait = true
 	}
 	if !dryRun {
+		// helm does not upgrade CRDs
+		if err := h.checkUnrendered(&cfg, chart, values, releaseName, defaultNamespace, policy, pr.mapper, false); err != nil {
+			return nil, err
+		}
 		logger.Info("Upgrading helm release")
 	}
 	rel, err := u.Run(releaseName, chart, values)
@@ -192,6 +214,61 @@ func (h *Helm) install(ctx context.Context, bundleID string, manifest *manifest.
 	return rel, err
 }
 
+// checkUnrendered renders the chart client-side and checks the hooks and,
+// for installs, the CRDs against the policy. Helm deploys them without the
+// post renderer, which checks the other objects. It runs right before the
+// release is installed or upgraded.
+func (h *Helm) checkUnrendered(cfg *action.Configuration, ch *chart.Chart, values map[string]interface{}, releaseName, namespace string, policy *BundlePolicy, mapper meta.RESTMapper, withCRDs bool) error {
+	if policy == nil {
+		return nil
+	}
+
+	// a client-only install replaces the kube client and the storage of
+	// its configuration
+	renderCfg := *cfg
+	u := action.NewInstall(&renderCfg)
+	u.ClientOnly = true
+	u.DryRun = true
+	u.Replace = true
+	u.ReleaseName = releaseName
+	u.Namespace = namespace
+	if cfg.Capabilities != nil {
+		if cfg.Capabilities.KubeVersion.Version != "" {
+			u.KubeVersion = &cfg.Capabilities.KubeVersion
+		}
+		if cfg.Capabilities.APIVersions != nil {
+			u.APIVersions = cfg.Capabilities.APIVersions
+		}
+	}
+	rel, err := u.Run(ch, values)
+	if err != nil {
+		return err
+	}
+
+	var crds []chart.CRD
+	if withCRDs {
+		crds = ch.CRDObjects()
+	}
+	return policy.checkManifests(unrenderedManifests(rel, crds), mapper, namespace)
+}
+
+// unrenderedManifests returns the manifests of the release's hooks and of
+// the CRDs, which helm deploys without the post renderer (pure function)
+func unrenderedManifests(rel *release.Release, crds []chart.CRD) []string {
+	var manifests []string
+	if rel != nil {
+		for _, hook := range rel.Hooks {
+			manifests = append(manifests, hook.Manifest)
+		}
+	}
+	for _, crd := range crds {
+		if crd.File != nil {
+			manifests = append(manifests, string(crd.File.Data))
+		}
+	}
+	return manifests
+}
+
 func (h *Helm) mustUninstall(cfg *action.Configuration, releaseName string) (bool, error) {
 	r, err := cfg.Releases.Last(releaseName)
 	if err != nil {
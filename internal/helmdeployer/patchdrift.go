@@ -0,0 +1,118 @@
+package helmdeployer
+
+import (
+	"context"
+	"fmt"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/merr"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// PatchDrift corrects drift without a helm rollback. It reverts the fields
+// of the modified objects with their merge patches, which keep the ignored
+// fields from the diff options, also inside of lists. It creates missing
+// objects from the deployed resources and deletes extra ones.
+func (h *Helm) PatchDrift(ctx context.Context, bd *fleet.BundleDeployment, modified []fleet.ModifiedStatus, resources *Resources) error {
+	logger := log.FromContext(ctx).WithName("PatchDrift")
+
+	c, err := h.applyClient(ctx, bd.Spec.Options.ServiceAccount)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, m := range modified {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(m.APIVersion)
+		obj.SetKind(m.Kind)
+		obj.SetNamespace(m.Namespace)
+		obj.SetName(m.Name)
+
+		switch {
+		case m.Create:
+			desired := desiredObject(resources, m)
+			if desired == nil {
+				errs = append(errs, fmt.Errorf("correcting drift of %s: object is not part of the deployed resources", m.String()))
+				continue
+			}
+			if bd.Spec.Options.DeployMode != fleet.DeployModeServerSideApply {
+				setReleaseMetadata(desired, bd.Name, bd.Status.Release)
+			}
+			logger.Info("Drift correction: creating missing object", "object", m.String())
+			err = client.IgnoreAlreadyExists(c.Create(ctx, desired, client.FieldOwner(FieldManager)))
+		case m.Delete:
+			logger.Info("Drift correction: deleting extra object", "object", m.String())
+			err = c.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground))
+			if meta.IsNoMatchError(err) {
+				err = nil
+			}
+			err = client.IgnoreNotFound(err)
+		case m.Patch != "":
+			logger.Info("Drift correction: patching modified object", "object", m.String())
+			err = client.IgnoreNotFound(c.Patch(ctx, obj, client.RawPatch(types.MergePatchType, []byte(m.Patch)), client.FieldOwner(FieldManager)))
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("correcting drift of %s: %w", m.String(), err))
+		}
+	}
+
+	return merr.NewErrors(errs...)
+}
+
+// desiredObject returns a copy of the deployed object, which is reported as
+// missing, in the namespace it is missing from (pure function)
+func desiredObject(resources *Resources, m fleet.ModifiedStatus) *unstructured.Unstructured {
+	if resources == nil {
+		return nil
+	}
+
+	gk := schema.FromAPIVersionAndKind(m.APIVersion, m.Kind).GroupKind()
+	for _, obj := range resources.Objects {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || u.GroupVersionKind().GroupKind() != gk || u.GetName() != m.Name {
+			continue
+		}
+		// helm releases don't record the namespace of namespaced objects
+		if u.GetNamespace() != "" && u.GetNamespace() != m.Namespace {
+			continue
+		}
+		desired := u.DeepCopy()
+		desired.SetNamespace(m.Namespace)
+		desired.SetResourceVersion("")
+		return desired
+	}
+	return nil
+}
+
+// setReleaseMetadata sets the labels and annotations helm adds to the
+// objects of a release, so the next upgrade adopts the object (pure function)
+func setReleaseMetadata(obj *unstructured.Unstructured, bundleID, resourcesID string) {
+	releaseName, _, namespace, err := getReleaseNameVersionAndNamespace(bundleID, resourcesID)
+	if err != nil {
+		return
+	}
+	addReleaseMetadata(obj, releaseName, namespace)
+}
+
+// addReleaseMetadata sets the labels and annotations of the helm release
+// with the given name and namespace on the object (pure function)
+func addReleaseMetadata(obj *unstructured.Unstructured, releaseName, namespace string) {
+	obj.SetLabels(mergeMaps(obj.GetLabels(), map[string]string{
+		"app.kubernetes.io/managed-by": "Helm",
+	}))
+	obj.SetAnnotations(mergeMaps(obj.GetAnnotations(), map[string]string{
+		"meta.helm.sh/release-name":      releaseName,
+		"meta.helm.sh/release-namespace": namespace,
+	}))
+}
@@ -0,0 +1,106 @@
+package helmdeployer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/fleet/internal/cmd/agent/deployer/applied"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	wapply "github.com/rancher/wrangler/v2/pkg/apply"
+	"github.com/rancher/wrangler/v2/pkg/objectset"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestDesiredObject(t *testing.T) {
+	deploy := newObject("apps/v1", "Deployment", "", "web")
+	deploy.SetResourceVersion("1")
+	other := newObject("v1", "ConfigMap", "other", "web")
+	resources := &Resources{Objects: []runtime.Object{other, deploy}}
+
+	desired := desiredObject(resources, fleet.ModifiedStatus{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "app", Name: "web", Create: true})
+	if assert.NotNil(t, desired) {
+		assert.Equal(t, "app", desired.GetNamespace())
+		assert.Empty(t, desired.GetResourceVersion())
+	}
+	assert.Empty(t, deploy.GetNamespace(), "deployed resources are not modified")
+
+	assert.Nil(t, desiredObject(resources, fleet.ModifiedStatus{APIVersion: "v1", Kind: "ConfigMap", Namespace: "app", Name: "web", Create: true}))
+	assert.Nil(t, desiredObject(nil, fleet.ModifiedStatus{APIVersion: "apps/v1", Kind: "Deployment", Name: "web"}))
+}
+
+func TestSetReleaseMetadata(t *testing.T) {
+	obj := newObject("v1", "ConfigMap", "app", "config")
+	obj.SetLabels(map[string]string{"app": "web"})
+
+	setReleaseMetadata(obj, "bd", "app/release:3")
+	assert.Equal(t, map[string]string{"app": "web", "app.kubernetes.io/managed-by": "Helm"}, obj.GetLabels())
+	assert.Equal(t, map[string]string{
+		"meta.helm.sh/release-name":      "release",
+		"meta.helm.sh/release-namespace": "app",
+	}, obj.GetAnnotations())
+}
+
+func TestPatchDriftKeepsIgnoredListFields(t *testing.T) {
+	ctx := context.Background()
+	webhooks := func(caBundle, failurePolicy string) *unstructured.Unstructured {
+		obj := newObject("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration", "", "webhook")
+		obj.Object["webhooks"] = []interface{}{map[string]interface{}{
+			"name":                    "validate.example.com",
+			"admissionReviewVersions": []interface{}{"v1"},
+			"sideEffects":             "None",
+			"failurePolicy":           failurePolicy,
+			"clientConfig": map[string]interface{}{
+				"caBundle": caBundle,
+				"service":  map[string]interface{}{"name": "webhook", "namespace": "app"},
+			},
+		}}
+		return obj
+	}
+	// the caBundle is injected on the cluster, the failure policy drifted
+	live := webhooks("Y2E=", "Ignore")
+	desired := webhooks("", "Fail")
+	unstructured.RemoveNestedField(desired.Object["webhooks"].([]interface{})[0].(map[string]interface{}), "clientConfig", "caBundle")
+
+	h, c := newSSATestHelm(t, live.DeepCopy())
+	bd := &fleet.BundleDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "bd"},
+		Spec: fleet.BundleDeploymentSpec{Options: fleet.BundleDeploymentOptions{Diff: &fleet.DiffOptions{
+			ComparePatches: []fleet.ComparePatch{{
+				APIVersion:   "admissionregistration.k8s.io/v1",
+				Kind:         "ValidatingWebhookConfiguration",
+				Name:         "webhook",
+				JsonPointers: []string{"/webhooks/0/clientConfig/caBundle"},
+			}},
+		}}},
+	}
+
+	plan := wapply.Plan{Update: wapply.PatchByGVK{}, Objects: []runtime.Object{live}}
+	plan.Update.Add(live.GroupVersionKind(), "", "webhook", "")
+	plan, err := applied.Diff(plan, bd, nil, nil, "app", desired)
+	require.NoError(t, err)
+	patch := plan.Update[live.GroupVersionKind()][objectset.ObjectKey{Name: "webhook"}]
+	require.NotEmpty(t, patch)
+
+	err = h.PatchDrift(ctx, bd, []fleet.ModifiedStatus{{
+		APIVersion: "admissionregistration.k8s.io/v1",
+		Kind:       "ValidatingWebhookConfiguration",
+		Name:       "webhook",
+		Patch:      patch,
+	}}, nil)
+	require.NoError(t, err)
+
+	result := newObject("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration", "", "webhook")
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(result), result))
+	webhook := result.Object["webhooks"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Fail", webhook["failurePolicy"])
+	caBundle, _, _ := unstructured.NestedString(webhook, "clientConfig", "caBundle")
+	assert.Equal(t, "Y2E=", caBundle, "expected the ignored field to be kept")
+}
@@ -0,0 +1,311 @@
+package helmdeployer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gobwas/glob"
+
+	"github.com/rancher/fleet/internal/cmd/controller/agentmanagement/controllers/manageagent"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/name"
+	wyaml "github.com/rancher/wrangler/v2/pkg/yaml"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// PolicyConfigMapName is the name of the config map in the agent's
+	// namespace, which contains the policy of the cluster owner
+	PolicyConfigMapName = "fleet-agent-policy"
+
+	policyKey = "policy"
+)
+
+// Policy restricts the objects bundles may deploy to the agent's cluster.
+// It is owned by the cluster owner and not by the fleet manager, e.g.
+//
+//	rules:
+//	- bundleNamespaces: ["fleet-default"]
+//	  deny:
+//	  - clusterScoped: true
+//	  - group: rbac.authorization.k8s.io
+//	- bundleSelector:
+//	    matchLabels:
+//	      team: web
+//	  allow:
+//	  - namespaces: ["web-*"]
+//
+// The agent's own bundle is exempt, so a policy cannot block agent updates.
+type Policy struct {
+	Rules []PolicyRule `json:"rules,omitempty"`
+}
+
+// PolicyRule restricts the objects of the bundles it selects. A rule
+// without selectors applies to all bundles.
+type PolicyRule struct {
+	// BundleNamespaces are glob patterns for the namespaces of the bundles
+	// on the upstream cluster, e.g. "fleet-default".
+	BundleNamespaces []string `json:"bundleNamespaces,omitempty"`
+	// BundleSelector selects bundles by the labels of their
+	// bundledeployments.
+	BundleSelector *metav1.LabelSelector `json:"bundleSelector,omitempty"`
+	// Allow restricts the bundles to the matching objects, if set.
+	Allow []ResourceSelector `json:"allow,omitempty"`
+	// Deny forbids the matching objects. It takes precedence over Allow.
+	Deny []ResourceSelector `json:"deny,omitempty"`
+}
+
+// ResourceSelector matches objects. Group, Version and Kind are glob
+// patterns, empty selectors match all objects.
+type ResourceSelector struct {
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+	// Namespaces are glob patterns, which match the namespace of
+	// namespaced objects. Cluster-scoped objects do not match, if set.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// ClusterScoped only matches cluster-scoped objects.
+	ClusterScoped bool `json:"clusterScoped,omitempty"`
+}
+
+// BundlePolicy contains the rules of the policy, which apply to a
+// bundledeployment
+type BundlePolicy struct {
+	source string
+	// protected is the config map containing the policy
+	protected types.NamespacedName
+	rules     []indexedRule
+}
+
+type indexedRule struct {
+	index int
+	PolicyRule
+}
+
+// Policy returns the rules of the cluster owner's policy, which apply to
+// the bundledeployment, or nil if there is no policy. The agent's own bundle
+// is exempt.
+func (h *Helm) Policy(ctx context.Context, bd *fleet.BundleDeployment) (*BundlePolicy, error) {
+	if isAgentBundle(bd) {
+		return nil, nil
+	}
+
+	key := types.NamespacedName{Namespace: h.agentNamespace, Name: PolicyConfigMapName}
+	cm := &corev1.ConfigMap{}
+	err := h.client.Get(ctx, key, cm)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{}
+	if err := yaml.Unmarshal([]byte(cm.Data[policyKey]), policy); err != nil {
+		return nil, fmt.Errorf("invalid policy in config map %s: %w", key, err)
+	}
+	return policy.forBundle(bd, key)
+}
+
+// isAgentBundle returns true for the agent bundle, which the fleet manager
+// creates for the cluster in the cluster's namespace. The labels are set by
+// the fleet manager (pure function).
+func isAgentBundle(bd *fleet.BundleDeployment) bool {
+	clusterName := bd.Labels[fleet.ClusterLabel]
+	return clusterName != "" &&
+		bd.Labels[fleet.RepoLabel] == "" &&
+		bd.Labels[fleet.BundleNamespaceLabel] == bd.Labels[fleet.ClusterNamespaceLabel] &&
+		bd.Labels[fleet.BundleLabel] == name.SafeConcatName(manageagent.AgentBundleName, clusterName)
+}
+
+// forBundle returns the rules, which apply to the bundledeployment (pure
+// function)
+func (p *Policy) forBundle(bd *fleet.BundleDeployment, source types.NamespacedName) (*BundlePolicy, error) {
+	result := &BundlePolicy{
+		source:    fmt.Sprintf("config map %s", source),
+		protected: source,
+	}
+	for i, rule := range p.Rules {
+		if len(rule.BundleNamespaces) > 0 && !matchesAny(rule.BundleNamespaces, bd.Labels[fleet.BundleNamespaceLabel]) {
+			continue
+		}
+		if rule.BundleSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(rule.BundleSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bundle selector in rule %d of policy in %s: %w", i+1, result.source, err)
+			}
+			if !selector.Matches(labels.Set(bd.Labels)) {
+				continue
+			}
+		}
+		result.rules = append(result.rules, indexedRule{index: i + 1, PolicyRule: rule})
+	}
+	return result, nil
+}
+
+// Check returns an error if the policy does not permit the object (pure
+// function)
+func (p *BundlePolicy) Check(gvk schema.GroupVersionKind, namespace, name string, clusterScoped bool) error {
+	if p == nil {
+		return nil
+	}
+
+	object := describePolicyObject(gvk, namespace, name, clusterScoped)
+	if gvk.Group == "" && gvk.Kind == "ConfigMap" && namespace == p.protected.Namespace && name == p.protected.Name {
+		return fmt.Errorf("policy violation: %s is the policy of the cluster and cannot be deployed by a bundle", object)
+	}
+
+	for _, rule := range p.rules {
+		for _, sel := range rule.Deny {
+			if sel.matches(gvk, namespace, clusterScoped) {
+				return fmt.Errorf("policy violation: %s is denied by rule %d of the policy in %s", object, rule.index, p.source)
+			}
+		}
+	}
+	for _, rule := range p.rules {
+		if len(rule.Allow) == 0 {
+			continue
+		}
+		allowed := false
+		for _, sel := range rule.Allow {
+			if sel.matches(gvk, namespace, clusterScoped) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("policy violation: %s is not allowed by rule %d of the policy in %s", object, rule.index, p.source)
+		}
+	}
+	return nil
+}
+
+// checkObjects checks the rendered objects against the policy. The scope
+// of objects is looked up with the mapper, or from the CRDs among the
+// objects, for custom resources which are not installed yet.
+func (p *BundlePolicy) checkObjects(objs []runtime.Object, mapper meta.RESTMapper, defaultNamespace string) error {
+	if p == nil {
+		return nil
+	}
+
+	crdScopes := map[schema.GroupKind]bool{}
+	for _, obj := range objs {
+		if u, ok := obj.(*unstructured.Unstructured); ok && u.GetKind() == CRDKind {
+			group, _, _ := unstructured.NestedString(u.Object, "spec", "group")
+			kind, _, _ := unstructured.NestedString(u.Object, "spec", "names", "kind")
+			scope, _, _ := unstructured.NestedString(u.Object, "spec", "scope")
+			crdScopes[schema.GroupKind{Group: group, Kind: kind}] = scope == string(meta.RESTScopeNameRoot)
+		}
+	}
+
+	for _, obj := range objs {
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+		gvk := obj.GetObjectKind().GroupVersionKind()
+
+		clusterScoped, known := crdScopes[gvk.GroupKind()]
+		if mapper != nil {
+			mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if err == nil {
+				clusterScoped, known = mapping.Scope.Name() == meta.RESTScopeNameRoot, true
+			} else if !meta.IsNoMatchError(err) {
+				return err
+			}
+		}
+		if !known {
+			return fmt.Errorf("policy violation: cannot determine the scope of %s", describePolicyObject(gvk, m.GetNamespace(), m.GetName(), false))
+		}
+
+		namespace := ""
+		if !clusterScoped {
+			namespace = m.GetNamespace()
+			if namespace == "" {
+				namespace = defaultNamespace
+			}
+		}
+		if err := p.Check(gvk, namespace, m.GetName(), clusterScoped); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkManifests checks the objects of the YAML manifests against the
+// policy, e.g. of hooks, which helm deploys without the post renderer
+func (p *BundlePolicy) checkManifests(manifests []string, mapper meta.RESTMapper, defaultNamespace string) error {
+	if p == nil {
+		return nil
+	}
+
+	var objs []runtime.Object
+	for _, manifest := range manifests {
+		o, err := wyaml.ToObjects(bytes.NewBufferString(manifest))
+		if err != nil {
+			return err
+		}
+		objs = append(objs, o...)
+	}
+	return p.checkObjects(objs, mapper, defaultNamespace)
+}
+
+func (s ResourceSelector) matches(gvk schema.GroupVersionKind, namespace string, clusterScoped bool) bool {
+	if !matchesGlob(s.Group, gvk.Group) || !matchesGlob(s.Version, gvk.Version) || !matchesGlob(s.Kind, gvk.Kind) {
+		return false
+	}
+	if s.ClusterScoped {
+		return clusterScoped
+	}
+	if len(s.Namespaces) > 0 {
+		return !clusterScoped && matchesAny(s.Namespaces, namespace)
+	}
+	return true
+}
+
+// describePolicyObject returns a description of the object for policy violations,
+// e.g. `rbac.authorization.k8s.io/v1 ClusterRole "admin"`
+func describePolicyObject(gvk schema.GroupVersionKind, namespace, name string, clusterScoped bool) string {
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	if clusterScoped || namespace == "" {
+		return fmt.Sprintf("%s %s %q", apiVersion, kind, name)
+	}
+	return fmt.Sprintf("%s %s %q in namespace %q", apiVersion, kind, name, namespace)
+}
+
+func matchesAny(patterns []string, text string) bool {
+	for _, pattern := range patterns {
+		if matchesGlob(pattern, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesGlob returns true if the pattern is empty or the glob pattern
+// matches the text
+func matchesGlob(pattern, text string) bool {
+	if pattern == "" || pattern == text {
+		return true
+	}
+	if !strings.ContainsAny(pattern, "*?[{\\") {
+		return false
+	}
+	g, err := glob.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	return g.Match(text)
+}
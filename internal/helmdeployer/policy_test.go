@@ -0,0 +1,181 @@
+package helmdeployer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var policySource = types.NamespacedName{Namespace: "cattle-fleet-system", Name: PolicyConfigMapName}
+
+func TestPolicyForBundle(t *testing.T) {
+	policy := &Policy{Rules: []PolicyRule{
+		{BundleNamespaces: []string{"fleet-*"}, Deny: []ResourceSelector{{ClusterScoped: true}}},
+		{BundleSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}}, Allow: []ResourceSelector{{Namespaces: []string{"web-*"}}}},
+		{Deny: []ResourceSelector{{Group: "rbac.authorization.k8s.io"}}},
+	}}
+
+	bd := &fleet.BundleDeployment{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{fleet.BundleNamespaceLabel: "fleet-default", "team": "web"}}}
+	p, err := policy.forBundle(bd, policySource)
+	require.NoError(t, err)
+	assert.Len(t, p.rules, 3)
+
+	bd = &fleet.BundleDeployment{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{fleet.BundleNamespaceLabel: "platform"}}}
+	p, err = policy.forBundle(bd, policySource)
+	require.NoError(t, err)
+	require.Len(t, p.rules, 1)
+	assert.Equal(t, 3, p.rules[0].index)
+}
+
+func TestPolicyCheck(t *testing.T) {
+	bd := &fleet.BundleDeployment{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{fleet.BundleNamespaceLabel: "fleet-default", "team": "web"}}}
+	p, err := (&Policy{Rules: []PolicyRule{
+		{BundleNamespaces: []string{"fleet-default"}, Deny: []ResourceSelector{{ClusterScoped: true}, {Group: "rbac.authorization.k8s.io"}}},
+		{BundleSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}}, Allow: []ResourceSelector{{Namespaces: []string{"web-*"}}}},
+	}}).forBundle(bd, policySource)
+	require.NoError(t, err)
+
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	assert.NoError(t, p.Check(deployment, "web-prod", "web", false))
+	assert.EqualError(t, p.Check(deployment, "kube-system", "web", false),
+		`policy violation: apps/v1 Deployment "web" in namespace "kube-system" is not allowed by rule 2 of the policy in config map cattle-fleet-system/fleet-agent-policy`)
+
+	role := schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role"}
+	assert.EqualError(t, p.Check(role, "web-prod", "web", false),
+		`policy violation: rbac.authorization.k8s.io/v1 Role "web" in namespace "web-prod" is denied by rule 1 of the policy in config map cattle-fleet-system/fleet-agent-policy`)
+
+	namespace := schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}
+	assert.ErrorContains(t, p.Check(namespace, "", "web-prod", true), `v1 Namespace "web-prod" is denied by rule 1`)
+
+	configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	p, err = (&Policy{}).forBundle(bd, policySource)
+	require.NoError(t, err)
+	assert.NoError(t, p.Check(configMap, "cattle-fleet-system", "other", false))
+	assert.ErrorContains(t, p.Check(configMap, "cattle-fleet-system", PolicyConfigMapName, false), "is the policy of the cluster")
+
+	var none *BundlePolicy
+	assert.NoError(t, none.Check(role, "kube-system", "admin", false))
+}
+
+func TestPolicyCheckObjects(t *testing.T) {
+	p, err := (&Policy{Rules: []PolicyRule{
+		{Allow: []ResourceSelector{{Namespaces: []string{"app"}}, {Kind: "Widget", ClusterScoped: true}, {Kind: CRDKind}}},
+	}}).forBundle(&fleet.BundleDeployment{}, policySource)
+	require.NoError(t, err)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: CRDKind}, meta.RESTScopeRoot)
+
+	object := func(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(apiVersion)
+		u.SetKind(kind)
+		u.SetNamespace(namespace)
+		u.SetName(name)
+		return u
+	}
+	crd := object("apiextensions.k8s.io/v1", CRDKind, "", "widgets.example.com")
+	crd.Object["spec"] = map[string]interface{}{
+		"group": "example.com",
+		"scope": "Cluster",
+		"names": map[string]interface{}{"kind": "Widget"},
+	}
+
+	// the scope of widgets is taken from the CRD, config maps are in the
+	// default namespace
+	objs := []runtime.Object{crd, object("example.com/v1", "Widget", "", "w"), object("v1", "ConfigMap", "", "cm")}
+	assert.NoError(t, p.checkObjects(objs, mapper, "app"))
+
+	objs = []runtime.Object{object("v1", "ConfigMap", "other", "cm")}
+	assert.ErrorContains(t, p.checkObjects(objs, mapper, "app"), `v1 ConfigMap "cm" in namespace "other" is not allowed by rule 1`)
+
+	objs = []runtime.Object{object("example.com/v1", "Gadget", "app", "g")}
+	assert.ErrorContains(t, p.checkObjects(objs, mapper, "app"), `cannot determine the scope of example.com/v1 Gadget "g" in namespace "app"`)
+
+	var none *BundlePolicy
+	assert.NoError(t, none.checkObjects(objs, mapper, "app"))
+}
+
+func TestPolicyCheckManifests(t *testing.T) {
+	p, err := (&Policy{Rules: []PolicyRule{
+		{Deny: []ResourceSelector{{ClusterScoped: true}}},
+	}}).forBundle(&fleet.BundleDeployment{}, policySource)
+	require.NoError(t, err)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: CRDKind}, meta.RESTScopeRoot)
+
+	rel := &release.Release{Hooks: []*release.Hook{
+		{Manifest: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n"},
+	}}
+	assert.NoError(t, p.checkManifests(unrenderedManifests(rel, nil), mapper, "app"))
+
+	// hooks and CRDs are not passed to the post renderer
+	rel.Hooks = append(rel.Hooks, &release.Hook{Manifest: "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: admin\n"})
+	assert.ErrorContains(t, p.checkManifests(unrenderedManifests(rel, nil), mapper, "app"), `ClusterRole "admin" is denied by rule 1`)
+
+	crds := []chart.CRD{{File: &chart.File{Data: []byte("apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: widgets.example.com\n")}}}
+	assert.ErrorContains(t, p.checkManifests(unrenderedManifests(nil, crds), mapper, "app"), `CustomResourceDefinition "widgets.example.com" is denied by rule 1`)
+}
+
+func TestIsAgentBundle(t *testing.T) {
+	bd := func(bundle, repo string) *fleet.BundleDeployment {
+		return &fleet.BundleDeployment{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+			fleet.BundleLabel:           bundle,
+			fleet.BundleNamespaceLabel:  "fleet-default",
+			fleet.ClusterLabel:          "local",
+			fleet.ClusterNamespaceLabel: "fleet-default",
+			fleet.RepoLabel:             repo,
+		}}}
+	}
+
+	assert.True(t, isAgentBundle(bd("fleet-agent-local", "")))
+	// bundles of git repos are checked, even if their name starts with
+	// the agent bundle's name
+	assert.False(t, isAgentBundle(bd("fleet-agent-foo", "")))
+	assert.False(t, isAgentBundle(bd("fleet-agent-local", "fleet-agent")))
+	assert.False(t, isAgentBundle(&fleet.BundleDeployment{ObjectMeta: metav1.ObjectMeta{Name: "fleet-agent-local"}}))
+}
+
+func TestCheckUnrendered(t *testing.T) {
+	p, err := (&Policy{Rules: []PolicyRule{
+		{Deny: []ResourceSelector{{ClusterScoped: true}}},
+	}}).forBundle(&fleet.BundleDeployment{}, policySource)
+	require.NoError(t, err)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "app", Version: "0.1.0"},
+		Templates: []*chart.File{
+			{Name: "templates/cm.yaml", Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n")},
+			{Name: "templates/hook.yaml", Data: []byte("apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: admin\n  annotations:\n    helm.sh/hook: pre-install\n")},
+		},
+	}
+	cfg := &action.Configuration{Log: func(string, ...interface{}) {}}
+	h := &Helm{}
+
+	err = h.checkUnrendered(cfg, ch, nil, "app", "app", p, mapper, true)
+	assert.ErrorContains(t, err, `ClusterRole "admin" is denied by rule 1`)
+
+	assert.NoError(t, h.checkUnrendered(cfg, ch, nil, "app", "app", nil, mapper, true))
+}
@@ -30,6 +30,9 @@ type postRender struct {
 	chart       *chart.Chart
 	mapper      meta.RESTMapper
 	opts        fleet.BundleDeploymentOptions
+	// policy of the cluster owner, which the objects must comply with
+	policy           *BundlePolicy
+	defaultNamespace string
 }
 
 func (p *postRender) Run(renderedManifests *bytes.Buffer) (modifiedManifests *bytes.Buffer, err error) {
@@ -107,6 +110,10 @@ func (p *postRender) Run(renderedManifests *bytes.Buffer) (modifiedManifests *by
 		}
 	}
 
+	if err := p.policy.checkObjects(objs, p.mapper, p.defaultNamespace); err != nil {
+		return nil, err
+	}
+
 	data, err = yaml.ToBytes(objs)
 	return bytes.NewBuffer(data), err
 }
@@ -2,6 +2,7 @@ package render
 
 import (
 	"io"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -22,6 +23,8 @@ import (
 // HelmChart applies overlays to "manifest"-style gitrepos and transforms the
 // manifest into a helm chart tgz
 func HelmChart(name string, m *manifest.Manifest, options fleet.BundleDeploymentOptions) (io.Reader, error) {
+	m = withoutHooks(m, options.Hooks, options.Verify)
+
 	var (
 		style = bundlereader.DetermineStyle(m, options)
 		err   error
@@ -46,6 +49,39 @@ func HelmChart(name string, m *manifest.Manifest, options fleet.BundleDeployment
 	return m.ToTarGZ()
 }
 
+// withoutHooks removes the job manifests of the hooks and the verification
+// job, which the agent runs before and after deploying the bundle
+func withoutHooks(m *manifest.Manifest, hooks *fleet.DeploymentHooks, verify *fleet.VerifyOptions) *manifest.Manifest {
+	var jobs []fleet.DeploymentHook
+	if hooks != nil {
+		jobs = append(jobs, hooks.PreDeploy...)
+		jobs = append(jobs, hooks.PostDeploy...)
+	}
+	if verify != nil && verify.Job != nil {
+		jobs = append(jobs, *verify.Job)
+	}
+	if len(jobs) == 0 {
+		return m
+	}
+	paths := map[string]bool{}
+	for _, hook := range jobs {
+		paths[CleanPath(hook.Path)] = true
+	}
+	result := &manifest.Manifest{Commit: m.Commit}
+	for _, resource := range m.Resources {
+		if !paths[CleanPath(resource.Name)] {
+			result.Resources = append(result.Resources, resource)
+		}
+	}
+	return result
+}
+
+// CleanPath returns the path of a hook or bundle resource in the form used by
+// the manifest, e.g. "hooks/migrate.yaml"
+func CleanPath(p string) string {
+	return path.Clean("/" + p)[1:]
+}
+
 // process filters the manifests resources and adds a Chart.yaml if missing
 func process(name string, m *manifest.Manifest, style bundlereader.Style) (*manifest.Manifest, error) {
 	newManifest := toChart(m, style)
@@ -10,6 +10,7 @@ import (
 
 	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -28,6 +29,24 @@ func (h *Helm) RemoveExternalChanges(ctx context.Context, bd *fleet.BundleDeploy
 		return err
 	}
 
+	// the policy may have changed since the release was deployed
+	policy, err := h.Policy(ctx, bd)
+	if err != nil {
+		return err
+	}
+	if policy != nil {
+		var mapper meta.RESTMapper
+		if !h.useGlobalCfg {
+			if mapper, err = cfg.RESTClientGetter.ToRESTMapper(); err != nil {
+				return err
+			}
+		}
+		manifests := append([]string{currentRelease.Manifest}, unrenderedManifests(currentRelease, nil)...)
+		if err := policy.checkManifests(manifests, mapper, defaultNamespace); err != nil {
+			return err
+		}
+	}
+
 	r := action.NewRollback(&cfg)
 	r.Version = currentRelease.Version
 	if bd.Spec.CorrectDrift.Force {
@@ -0,0 +1,711 @@
+package helmdeployer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"github.com/rancher/fleet/internal/manifest"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"github.com/rancher/wrangler/v2/pkg/yaml"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// FieldManager is the field manager of objects deployed with server-side apply
+	FieldManager = "fleet-agent"
+	// InventoryLabel marks the secrets, which record the objects deployed
+	// with server-side apply
+	InventoryLabel = "fleet.cattle.io/inventory"
+	// InventorySecretType is the type of the inventory secrets
+	InventorySecretType = "fleet.cattle.io/inventory"
+
+	inventoryKey = "inventory"
+)
+
+// inventory records the objects of a bundledeployment, which were applied
+// with server-side apply. It takes the place of the helm release history.
+type inventory struct {
+	Revision         int    `json:"revision"`
+	DefaultNamespace string `json:"defaultNamespace,omitempty"`
+	ServiceAccount   string `json:"serviceAccount,omitempty"`
+	KeepResources    bool   `json:"keepResources,omitempty"`
+	// Objects are the objects of the current revision
+	Objects []*unstructured.Unstructured `json:"objects,omitempty"`
+	// Previous references the objects of the previous revision
+	Previous []objectRef `json:"previous,omitempty"`
+	// Prune references the objects, which are no longer part of the bundle
+	// and still need to be deleted
+	Prune []objectRef `json:"prune,omitempty"`
+}
+
+type objectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Keep is true for objects with helm's "keep" resource policy, which
+	// are never deleted
+	Keep bool `json:"keep,omitempty"`
+}
+
+// ServerSideApply deploys the bundle by applying the objects rendered from
+// its chart with server-side apply, instead of installing a helm release.
+// Objects of earlier revisions, which are no longer rendered, are pruned.
+// Helm hooks are not run. bundleID is the name of the bundledeployment.
+func (h *Helm) ServerSideApply(ctx context.Context, bundleID string, manifest *manifest.Manifest, options fleet.BundleDeploymentOptions, policy *BundlePolicy) (*Resources, error) {
+	logger := log.FromContext(ctx).WithName("ServerSideApply").WithValues("commit", manifest.Commit)
+	ctx = log.IntoContext(ctx, logger)
+
+	if options.Helm == nil {
+		options.Helm = &fleet.HelmOptions{}
+	}
+	if options.Kustomize == nil {
+		options.Kustomize = &fleet.KustomizeOptions{}
+	}
+
+	chart, err := h.loadChart(bundleID, manifest, options)
+	if err != nil {
+		return nil, err
+	}
+
+	_, defaultNamespace, _ := h.getOpts(bundleID, options)
+	objs, err := h.render(ctx, bundleID, manifest, chart, options, policy, defaultNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := h.applyClient(ctx, options.ServiceAccount)
+	if err != nil {
+		return nil, err
+	}
+	return h.applyInventory(ctx, c, bundleID, objs, defaultNamespace, options)
+}
+
+// applyInventory applies the rendered objects with the client, records
+// them in the inventory and prunes objects of earlier revisions.
+func (h *Helm) applyInventory(ctx context.Context, c client.Client, bundleID string, objs []*unstructured.Unstructured, defaultNamespace string, options fleet.BundleDeploymentOptions) (*Resources, error) {
+	logger := log.FromContext(ctx)
+
+	if err := setNamespaces(c, objs, defaultNamespace); err != nil {
+		return nil, err
+	}
+
+	previous, err := h.getInventory(ctx, bundleID)
+	if err != nil {
+		return nil, err
+	}
+
+	// record the new revision before applying, so objects are pruned
+	// even if applying fails midway
+	inv := nextInventory(previous, objs)
+	inv.DefaultNamespace = defaultNamespace
+	inv.ServiceAccount = options.ServiceAccount
+	inv.KeepResources = options.KeepResources
+	if err := h.saveInventory(ctx, bundleID, inv); err != nil {
+		return nil, err
+	}
+
+	if err := ensureNamespace(ctx, c, defaultNamespace); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Applying objects", "revision", inv.Revision, "objects", len(objs))
+	if err := apply(ctx, c, objs, false); err != nil {
+		return nil, err
+	}
+
+	if len(inv.Prune) > 0 {
+		logger.Info("Pruning objects, which are no longer part of the bundle", "objects", len(inv.Prune))
+		if err := prune(ctx, c, inv.Prune); err != nil {
+			return nil, err
+		}
+		inv.Prune = nil
+		if err := h.saveInventory(ctx, bundleID, inv); err != nil {
+			return nil, err
+		}
+	}
+
+	// the objects are owned by the inventory now, drop the history of an
+	// earlier helm release without uninstalling it
+	if err := h.forgetReleases(ctx, bundleID); err != nil {
+		return nil, err
+	}
+
+	return inv.resources(bundleID), nil
+}
+
+// EnsureApplied returns true if the objects of the given revision were
+// applied completely.
+func (h *Helm) EnsureApplied(ctx context.Context, bundleID, resourcesID string) (bool, error) {
+	_, version, _, err := getReleaseNameVersionAndNamespace(bundleID, resourcesID)
+	if err != nil {
+		return false, err
+	}
+
+	inv, err := h.getInventory(ctx, bundleID)
+	if err != nil {
+		return false, err
+	}
+	return inv != nil && inv.Revision == version && len(inv.Prune) == 0, nil
+}
+
+// AppliedResources returns the objects of the given revision from the
+// inventory
+func (h *Helm) AppliedResources(ctx context.Context, bundleID, resourcesID string) (*Resources, error) {
+	_, version, _, err := getReleaseNameVersionAndNamespace(bundleID, resourcesID)
+	if err != nil {
+		return &Resources{}, err
+	}
+
+	inv, err := h.getInventory(ctx, bundleID)
+	if err != nil {
+		return nil, err
+	}
+	if inv == nil || inv.Revision != version {
+		return &Resources{}, nil
+	}
+	return inv.resources(bundleID), nil
+}
+
+// PreviouslyAppliedResources returns references to the objects of the
+// revision before the given one. Only their kind, namespace and name are set.
+func (h *Helm) PreviouslyAppliedResources(ctx context.Context, bundleID, resourcesID string) (*Resources, error) {
+	_, version, _, err := getReleaseNameVersionAndNamespace(bundleID, resourcesID)
+	if err != nil {
+		return &Resources{}, err
+	}
+
+	inv, err := h.getInventory(ctx, bundleID)
+	if err != nil {
+		return nil, err
+	}
+	if inv == nil || inv.Revision != version {
+		return &Resources{}, nil
+	}
+
+	resources := &Resources{DefaultNamespace: inv.DefaultNamespace}
+	for _, ref := range inv.Previous {
+		resources.Objects = append(resources.Objects, ref.object())
+	}
+	return resources, nil
+}
+
+// Reapply applies the objects of the current revision again, to remove
+// changes made outside of fleet. Conflicting field managers are overridden,
+// if forced by the drift correction options.
+func (h *Helm) Reapply(ctx context.Context, bd *fleet.BundleDeployment) error {
+	log.FromContext(ctx).WithName("Reapply").Info("Drift correction: server-side apply")
+
+	inv, err := h.getInventory(ctx, bd.Name)
+	if err != nil {
+		return err
+	}
+	if inv == nil {
+		return ErrNoRelease
+	}
+
+	c, err := h.applyClient(ctx, inv.ServiceAccount)
+	if err != nil {
+		return err
+	}
+	force := bd.Spec.CorrectDrift != nil && bd.Spec.CorrectDrift.Force
+	return apply(ctx, c, inv.Objects, force)
+}
+
+// ListInventories returns the bundledeployments, which were deployed with
+// server-side apply
+func (h *Helm) ListInventories(ctx context.Context) ([]DeployedBundle, error) {
+	secrets := &corev1.SecretList{}
+	err := h.client.List(ctx, secrets, client.InNamespace(h.agentNamespace), client.MatchingLabels{InventoryLabel: "true"})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []DeployedBundle
+	for _, secret := range secrets.Items {
+		bundleID := secret.Annotations[BundleIDAnnotation]
+		if bundleID == "" || secret.Type != InventorySecretType {
+			continue
+		}
+		inv, err := decodeInventory(secret.Data[inventoryKey])
+		if err != nil {
+			// a corrupt inventory must not stop the cleanup of
+			// other bundledeployments
+			log.FromContext(ctx).Error(err, "Skipping invalid inventory", "secret", secret.Name, "bundleID", bundleID)
+			continue
+		}
+		result = append(result, DeployedBundle{
+			BundleID:      bundleID,
+			ReleaseName:   inv.DefaultNamespace + "/" + bundleID,
+			KeepResources: inv.KeepResources,
+		})
+	}
+	return result, nil
+}
+
+// DeleteInventory deletes the objects of a bundledeployment, which was
+// deployed with server-side apply, unless they should be kept, and its
+// inventory.
+func (h *Helm) DeleteInventory(ctx context.Context, bundleID string) error {
+	inv, err := h.getInventory(ctx, bundleID)
+	if err != nil || inv == nil {
+		return err
+	}
+
+	// never delete the fleet-agent, just "forget" it
+	if inv.KeepResources || strings.HasPrefix(bundleID, "fleet-agent") {
+		return h.ForgetInventory(ctx, bundleID)
+	}
+
+	c, err := h.applyClient(ctx, inv.ServiceAccount)
+	if err != nil {
+		return err
+	}
+	return h.deleteInventory(ctx, c, bundleID, inv)
+}
+
+// deleteInventory deletes the objects of the inventory with the client and
+// the inventory itself
+func (h *Helm) deleteInventory(ctx context.Context, c client.Client, bundleID string, inv *inventory) error {
+	log.FromContext(ctx).WithName("DeleteInventory").Info("Deleting objects deployed with server-side apply", "bundleID", bundleID)
+	if err := prune(ctx, c, append(refs(inv.Objects), inv.Prune...)); err != nil {
+		return err
+	}
+	return h.ForgetInventory(ctx, bundleID)
+}
+
+// ForgetInventory deletes the inventory of a bundledeployment, but keeps
+// its objects
+func (h *Helm) ForgetInventory(ctx context.Context, bundleID string) error {
+	secret := &corev1.Secret{}
+	secret.Namespace = h.agentNamespace
+	secret.Name = inventoryName(bundleID)
+	return client.IgnoreNotFound(h.client.Delete(ctx, secret))
+}
+
+// render returns the objects of the chart, like helm install would deploy
+// them, without accessing the helm release storage
+func (h *Helm) render(ctx context.Context, bundleID string, manifest *manifest.Manifest, chart *chart.Chart, options fleet.BundleDeploymentOptions, policy *BundlePolicy, defaultNamespace string) ([]*unstructured.Unstructured, error) {
+	_, _, releaseName := h.getOpts(bundleID, options)
+
+	values, err := h.getValues(ctx, options, defaultNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := h.getCfg(ctx, defaultNamespace, options.ServiceAccount)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Releases = storage.Init(driver.NewMemory())
+
+	pr := &postRender{
+		labelPrefix:      h.labelPrefix,
+		labelSuffix:      h.labelSuffix,
+		bundleID:         bundleID,
+		manifest:         manifest,
+		opts:             options,
+		chart:            chart,
+		policy:           policy,
+		defaultNamespace: defaultNamespace,
+	}
+	mapper, err := cfg.RESTClientGetter.ToRESTMapper()
+	if err != nil {
+		return nil, err
+	}
+	pr.mapper = mapper
+
+	u := action.NewInstall(&cfg)
+	u.ClientOnly = true
+	u.DryRun = true
+	u.IncludeCRDs = true
+	if cfg.Capabilities != nil {
+		if cfg.Capabilities.KubeVersion.Version != "" {
+			u.KubeVersion = &cfg.Capabilities.KubeVersion
+		}
+		if cfg.Capabilities.APIVersions != nil {
+			u.APIVersions = cfg.Capabilities.APIVersions
+		}
+	}
+	u.EnableDNS = !options.Helm.DisableDNS
+	u.ReleaseName = releaseName
+	u.Namespace = defaultNamespace
+	u.PostRenderer = pr
+
+	rel, err := u.Run(chart, values)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := manifestToObjects(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	// helm never deletes the CRDs of the crds/ directory
+	crds, err := chartCRDNames(chart)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if obj.GetKind() == CRDKind && crds[obj.GetName()] {
+			obj.SetAnnotations(mergeMaps(obj.GetAnnotations(), map[string]string{kube.ResourcePolicyAnno: kube.KeepPolicy}))
+		}
+		// a helm release adopts the objects after switching back to helm
+		addReleaseMetadata(obj, releaseName, defaultNamespace)
+	}
+	return objs, nil
+}
+
+// chartCRDNames returns the names of the CRDs in the crds/ directories of
+// the chart and its dependencies
+func chartCRDNames(chart *chart.Chart) (map[string]bool, error) {
+	names := map[string]bool{}
+	for _, crd := range chart.CRDObjects() {
+		objs, err := yaml.ToObjects(bytes.NewReader(crd.File.Data))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", crd.Filename, err)
+		}
+		for _, obj := range objs {
+			if m, err := meta.Accessor(obj); err == nil {
+				names[m.GetName()] = true
+			}
+		}
+	}
+	return names, nil
+}
+
+func manifestToObjects(rel *release.Release) ([]*unstructured.Unstructured, error) {
+	objs, err := yaml.ToObjects(bytes.NewBufferString(rel.Manifest))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object of type %T in rendered manifest", obj)
+		}
+		result = append(result, u)
+	}
+	return result, nil
+}
+
+// applyClient returns a client for the local cluster, which impersonates the
+// service account. Clients are cached per service account, as each one
+// discovers the API resources of the cluster.
+func (h *Helm) applyClient(ctx context.Context, serviceAccount string) (client.Client, error) {
+	getter := h.getter
+
+	serviceAccountNamespace, serviceAccountName, err := h.getServiceAccount(ctx, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	key := serviceAccountNamespace + "/" + serviceAccountName
+	h.applyClientsLock.Lock()
+	defer h.applyClientsLock.Unlock()
+	if c, ok := h.applyClients[key]; ok {
+		return c, nil
+	}
+
+	if serviceAccountName != "" {
+		getter, err = newImpersonatingGetter(serviceAccountNamespace, serviceAccountName, h.getter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	restConfig, err := getter.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	c, err := client.New(restConfig, client.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	if h.applyClients == nil {
+		h.applyClients = map[string]client.Client{}
+	}
+	h.applyClients[key] = c
+	return c, nil
+}
+
+// setNamespaces sets the default namespace on namespaced objects, which
+// have none
+func setNamespaces(c client.Client, objs []*unstructured.Unstructured, defaultNamespace string) error {
+	for _, obj := range objs {
+		if obj.GetNamespace() != "" {
+			continue
+		}
+		namespaced, err := c.IsObjectNamespaced(obj)
+		if err != nil {
+			return fmt.Errorf("mapping %s: %w", describeObject(obj), err)
+		}
+		if namespaced {
+			obj.SetNamespace(defaultNamespace)
+		}
+	}
+	return nil
+}
+
+// ensureNamespace creates the namespace, like helm does for a release
+func ensureNamespace(ctx context.Context, c client.Client, name string) error {
+	ns := &corev1.Namespace{}
+	err := c.Get(ctx, types.NamespacedName{Name: name}, ns)
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+	ns.Name = name
+	return client.IgnoreAlreadyExists(c.Create(ctx, ns))
+}
+
+// apply applies the objects with server-side apply, CRDs and namespaces
+// first. Unless forced, fields owned by other field managers are reported as
+// conflicts.
+func apply(ctx context.Context, c client.Client, objs []*unstructured.Unstructured, force bool) error {
+	opts := []client.PatchOption{client.FieldOwner(FieldManager)}
+	if force {
+		opts = append(opts, client.ForceOwnership)
+	}
+
+	sorted := append([]*unstructured.Unstructured{}, objs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return applyOrder(sorted[i].GetKind()) < applyOrder(sorted[j].GetKind())
+	})
+	for _, obj := range sorted {
+		// Patch updates the object with the response
+		obj = obj.DeepCopy()
+		if err := c.Patch(ctx, obj, client.Apply, opts...); err != nil {
+			return fmt.Errorf("applying %s: %w", describeObject(obj), err)
+		}
+	}
+	return nil
+}
+
+// prune deletes the referenced objects in reverse apply order, except for
+// the ones which should be kept
+func prune(ctx context.Context, c client.Client, objs []objectRef) error {
+	sorted := append([]objectRef{}, objs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return applyOrder(sorted[i].Kind) > applyOrder(sorted[j].Kind)
+	})
+	for _, ref := range sorted {
+		if ref.Keep {
+			continue
+		}
+		obj := ref.object()
+		err := c.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if client.IgnoreNotFound(err) != nil && !meta.IsNoMatchError(err) {
+			return fmt.Errorf("pruning %s: %w", describeObject(obj), err)
+		}
+	}
+	return nil
+}
+
+func applyOrder(kind string) int {
+	switch kind {
+	case CRDKind:
+		return 0
+	case "Namespace":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// nextInventory returns the inventory for the next revision. Objects of the
+// previous revision, which are not part of the next one, are pruned (pure
+// function)
+func nextInventory(previous *inventory, objs []*unstructured.Unstructured) *inventory {
+	next := &inventory{
+		Revision: 1,
+		Objects:  objs,
+	}
+	if previous == nil {
+		return next
+	}
+
+	next.Revision = previous.Revision + 1
+	next.Previous = refs(previous.Objects)
+	current := map[string]bool{}
+	for _, ref := range refs(objs) {
+		current[ref.key()] = true
+	}
+	for _, ref := range append(next.Previous, previous.Prune...) {
+		if !current[ref.key()] {
+			current[ref.key()] = true
+			next.Prune = append(next.Prune, ref)
+		}
+	}
+	return next
+}
+
+func refs(objs []*unstructured.Unstructured) []objectRef {
+	result := make([]objectRef, 0, len(objs))
+	for _, obj := range objs {
+		result = append(result, objectRef{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+			Keep:       obj.GetAnnotations()[kube.ResourcePolicyAnno] == kube.KeepPolicy,
+		})
+	}
+	return result
+}
+
+// key identifies the object independent of its API version
+func (r objectRef) key() string {
+	gk := schema.FromAPIVersionAndKind(r.APIVersion, r.Kind).GroupKind()
+	return gk.String() + "/" + r.Namespace + "/" + r.Name
+}
+
+func (r objectRef) object() *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(r.APIVersion)
+	obj.SetKind(r.Kind)
+	obj.SetNamespace(r.Namespace)
+	obj.SetName(r.Name)
+	return obj
+}
+
+func (inv *inventory) resources(bundleID string) *Resources {
+	resources := &Resources{
+		ID:               fmt.Sprintf("%s/%s:%d", inv.DefaultNamespace, bundleID, inv.Revision),
+		DefaultNamespace: inv.DefaultNamespace,
+	}
+	for _, obj := range inv.Objects {
+		resources.Objects = append(resources.Objects, runtime.Object(obj.DeepCopy()))
+	}
+	return resources
+}
+
+func describeObject(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetKind() + " " + obj.GetName()
+	}
+	return obj.GetKind() + " " + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+func inventoryName(bundleID string) string {
+	return "fleet-inventory-" + bundleID
+}
+
+// getInventory returns the inventory of the bundledeployment, or nil if
+// there is none
+func (h *Helm) getInventory(ctx context.Context, bundleID string) (*inventory, error) {
+	secret := &corev1.Secret{}
+	err := h.client.Get(ctx, types.NamespacedName{Namespace: h.agentNamespace, Name: inventoryName(bundleID)}, secret)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeInventory(secret.Data[inventoryKey])
+}
+
+func (h *Helm) saveInventory(ctx context.Context, bundleID string, inv *inventory) error {
+	data, err := encodeInventory(inv)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{}
+	err = h.client.Get(ctx, types.NamespacedName{Namespace: h.agentNamespace, Name: inventoryName(bundleID)}, secret)
+	if apierrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   h.agentNamespace,
+				Name:        inventoryName(bundleID),
+				Labels:      map[string]string{InventoryLabel: "true"},
+				Annotations: map[string]string{BundleIDAnnotation: bundleID},
+			},
+			Type: InventorySecretType,
+			Data: map[string][]byte{inventoryKey: data},
+		}
+		return h.client.Create(ctx, secret)
+	} else if err != nil {
+		return err
+	}
+
+	secret.Data = map[string][]byte{inventoryKey: data}
+	return h.client.Update(ctx, secret)
+}
+
+// forgetReleases deletes the history of helm releases of the bundle, but
+// keeps the deployed objects
+func (h *Helm) forgetReleases(ctx context.Context, bundleID string) error {
+	rels, err := h.globalCfg.Releases.List(func(r *release.Release) bool {
+		return r.Chart.Metadata.Annotations[BundleIDAnnotation] == bundleID &&
+			r.Chart.Metadata.Annotations[AgentNamespaceAnnotation] == h.agentNamespace
+	})
+	if err != nil {
+		return err
+	}
+	for _, rel := range rels {
+		log.FromContext(ctx).Info("Deleting helm release history, the bundle is deployed with server-side apply", "release", rel.Name, "version", rel.Version)
+		if _, err := h.globalCfg.Releases.Delete(rel.Name, rel.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeInventory returns the gzip compressed JSON of the inventory (pure
+// function)
+func encodeInventory(inv *inventory) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(w).Encode(inv); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeInventory is the inverse of encodeInventory (pure function)
+func decodeInventory(data []byte) (*inventory, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("reading inventory: %w", err)
+	}
+	defer r.Close()
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading inventory: %w", err)
+	}
+	inv := &inventory{}
+	if err := json.Unmarshal(raw, inv); err != nil {
+		return nil, fmt.Errorf("reading inventory: %w", err)
+	}
+	return inv, nil
+}
@@ -0,0 +1,384 @@
+package helmdeployer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"github.com/rancher/fleet/internal/manifest"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	wyaml "github.com/rancher/wrangler/v2/pkg/yaml"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	restfake "k8s.io/client-go/rest/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func newObject(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func TestNextInventory(t *testing.T) {
+	cm := newObject("v1", "ConfigMap", "app", "config")
+	deploy := newObject("apps/v1", "Deployment", "app", "web")
+	crd := newObject("apiextensions.k8s.io/v1", CRDKind, "", "things.example.com")
+	crd.SetAnnotations(map[string]string{kube.ResourcePolicyAnno: kube.KeepPolicy})
+
+	first := nextInventory(nil, []*unstructured.Unstructured{cm, deploy, crd})
+	assert.Equal(t, 1, first.Revision)
+	assert.Empty(t, first.Previous)
+	assert.Empty(t, first.Prune)
+
+	// a new API version of the same object is not pruned
+	deployV2 := newObject("apps/v2", "Deployment", "app", "web")
+	second := nextInventory(first, []*unstructured.Unstructured{deployV2})
+	assert.Equal(t, 2, second.Revision)
+	assert.Len(t, second.Previous, 3)
+	assert.Equal(t, []objectRef{
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "app", Name: "config"},
+		{APIVersion: "apiextensions.k8s.io/v1", Kind: CRDKind, Name: "things.example.com", Keep: true},
+	}, second.Prune)
+
+	// objects, which were not pruned yet, are carried over
+	third := nextInventory(second, []*unstructured.Unstructured{deployV2, cm})
+	assert.Equal(t, 3, third.Revision)
+	assert.Equal(t, []objectRef{
+		{APIVersion: "apiextensions.k8s.io/v1", Kind: CRDKind, Name: "things.example.com", Keep: true},
+	}, third.Prune)
+}
+
+func TestInventoryEncoding(t *testing.T) {
+	inv := nextInventory(nil, []*unstructured.Unstructured{newObject("v1", "ConfigMap", "app", "config")})
+	inv.DefaultNamespace = "app"
+	inv.KeepResources = true
+
+	data, err := encodeInventory(inv)
+	require.NoError(t, err)
+	decoded, err := decodeInventory(data)
+	require.NoError(t, err)
+	assert.Equal(t, inv, decoded)
+
+	resources := decoded.resources("bd")
+	assert.Equal(t, "app/bd:1", resources.ID)
+	assert.Len(t, resources.Objects, 1)
+
+	_, err = decodeInventory([]byte("not compressed"))
+	assert.Error(t, err)
+}
+
+const testAgentNamespace = "cattle-fleet-system"
+
+func newSSATestHelm(t *testing.T, objs ...client.Object) (*Helm, client.Client) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion})
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).WithObjects(objs...).
+		WithInterceptorFuncs(interceptor.Funcs{Patch: fakeApply}).
+		Build()
+	h := &Helm{
+		client:         c,
+		agentNamespace: testAgentNamespace,
+		globalCfg: action.Configuration{
+			RESTClientGetter: testRESTClientGetter{mapper: mapper},
+			KubeClient:       &adoptingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}, client: c, mapper: mapper},
+			Releases:         storage.Init(driver.NewMemory()),
+			Capabilities:     chartutil.DefaultCapabilities,
+			Log:              func(string, ...interface{}) {},
+		},
+		useGlobalCfg: true,
+		applyClients: map[string]client.Client{"/": c},
+	}
+	return h, c
+}
+
+type testRESTClientGetter struct {
+	genericclioptions.RESTClientGetter
+	mapper meta.RESTMapper
+}
+
+func (g testRESTClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	return g.mapper, nil
+}
+
+func (g testRESTClientGetter) ToRESTConfig() (*rest.Config, error) {
+	return &rest.Config{}, nil
+}
+
+// adoptingKubeClient looks up the objects of a helm release with the fake
+// client, so helm checks if it can adopt existing objects. Changes are
+// only printed.
+type adoptingKubeClient struct {
+	kubefake.PrintingKubeClient
+	client client.Client
+	mapper meta.RESTMapper
+}
+
+func (k *adoptingKubeClient) Build(r io.Reader, _ bool) (kube.ResourceList, error) {
+	objs, err := wyaml.ToObjects(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result kube.ResourceList
+	for _, obj := range objs {
+		u := obj.(*unstructured.Unstructured)
+		gvk := u.GroupVersionKind()
+		mapping, err := k.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, err
+		}
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace && u.GetNamespace() == "" {
+			u.SetNamespace("app")
+		}
+		result = append(result, &resource.Info{
+			Client:    k.restClient(u),
+			Mapping:   mapping,
+			Namespace: u.GetNamespace(),
+			Name:      u.GetName(),
+			Object:    u,
+		})
+	}
+	return result, nil
+}
+
+// restClient returns a REST client, which responds with the object from the
+// fake client
+func (k *adoptingKubeClient) restClient(obj *unstructured.Unstructured) *restfake.RESTClient {
+	return &restfake.RESTClient{
+		NegotiatedSerializer: clientgoscheme.Codecs.WithoutConversion(),
+		Client: restfake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			existing := &unstructured.Unstructured{}
+			existing.SetGroupVersionKind(obj.GroupVersionKind())
+			err := k.client.Get(req.Context(), client.ObjectKeyFromObject(obj), existing)
+			if apierrors.IsNotFound(err) {
+				return &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+			} else if err != nil {
+				return nil, err
+			}
+			data, err := existing.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			header := http.Header{}
+			header.Set("Content-Type", runtime.ContentTypeJSON)
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(bytes.NewReader(data))}, nil
+		}),
+	}
+}
+
+// fakeApply emulates server-side apply, which the fake client does not
+// support, by creating or replacing the object
+func fakeApply(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Patch(ctx, obj, patch, opts...)
+	}
+	existing := obj.DeepCopyObject().(client.Object)
+	err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	if apierrors.IsNotFound(err) {
+		return c.Create(ctx, obj)
+	} else if err != nil {
+		return err
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	return c.Update(ctx, obj)
+}
+
+func exists(t *testing.T, c client.Client, obj *unstructured.Unstructured) bool {
+	t.Helper()
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(obj.GroupVersionKind())
+	err := c.Get(context.Background(), client.ObjectKeyFromObject(obj), u)
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	require.NoError(t, err)
+	return true
+}
+
+func TestApplyInventoryPrunesRemovedObjects(t *testing.T) {
+	ctx := context.Background()
+	h, c := newSSATestHelm(t)
+
+	cm := newObject("v1", "ConfigMap", "", "config")
+	secret := newObject("v1", "Secret", "", "credentials")
+	resources, err := h.applyInventory(ctx, c, "bd", []*unstructured.Unstructured{cm, secret}, "app", fleet.BundleDeploymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "app/bd:1", resources.ID)
+	assert.Equal(t, "app", cm.GetNamespace(), "expected the default namespace to be set")
+	assert.True(t, exists(t, c, cm))
+	assert.True(t, exists(t, c, secret))
+
+	applied, err := h.EnsureApplied(ctx, "bd", resources.ID)
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	// the config map is no longer part of the bundle
+	resources, err = h.applyInventory(ctx, c, "bd", []*unstructured.Unstructured{newObject("v1", "Secret", "", "credentials")}, "app", fleet.BundleDeploymentOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "app/bd:2", resources.ID)
+	assert.False(t, exists(t, c, cm), "expected the removed object to be pruned")
+	assert.True(t, exists(t, c, secret))
+
+	inv, err := h.getInventory(ctx, "bd")
+	require.NoError(t, err)
+	assert.Empty(t, inv.Prune)
+	assert.Len(t, inv.Previous, 2)
+}
+
+func TestDeleteInventory(t *testing.T) {
+	ctx := context.Background()
+	h, c := newSSATestHelm(t)
+
+	cm := newObject("v1", "ConfigMap", "app", "config")
+	_, err := h.applyInventory(ctx, c, "bd", []*unstructured.Unstructured{cm}, "app", fleet.BundleDeploymentOptions{})
+	require.NoError(t, err)
+
+	inv, err := h.getInventory(ctx, "bd")
+	require.NoError(t, err)
+	require.NoError(t, h.deleteInventory(ctx, c, "bd", inv))
+
+	assert.False(t, exists(t, c, cm))
+	inv, err = h.getInventory(ctx, "bd")
+	require.NoError(t, err)
+	assert.Nil(t, inv)
+}
+
+func TestSwitchDeployMode(t *testing.T) {
+	ctx := context.Background()
+	h, c := newSSATestHelm(t)
+	m := manifest.New([]fleet.BundleResource{
+		{Name: "config.yaml", Content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n"},
+	})
+	opts := fleet.BundleDeploymentOptions{DefaultNamespace: "app"}
+
+	// switching from helm to server-side apply drops the release history
+	rel := &release.Release{
+		Name:    "bd",
+		Version: 1,
+		Info:    &release.Info{Status: release.StatusDeployed},
+		Chart: &chart.Chart{Metadata: &chart.Metadata{Annotations: map[string]string{
+			BundleIDAnnotation:       "bd",
+			AgentNamespaceAnnotation: testAgentNamespace,
+		}}},
+	}
+	require.NoError(t, h.globalCfg.Releases.Create(rel))
+
+	_, err := h.ServerSideApply(ctx, "bd", m, opts, nil)
+	require.NoError(t, err)
+
+	_, err = h.globalCfg.Releases.History("bd")
+	assert.ErrorIs(t, err, driver.ErrReleaseNotFound, "expected the helm release history to be deleted")
+
+	deployed, err := h.ListInventories(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []DeployedBundle{{BundleID: "bd", ReleaseName: "app/bd"}}, deployed)
+
+	// the objects can only be adopted by the release of their bundle
+	_, err = h.Deploy(ctx, "other", m, opts, nil)
+	assert.ErrorContains(t, err, "cannot be imported into the current release")
+
+	// switching back to helm adopts the objects
+	_, err = h.Deploy(ctx, "bd", m, opts, nil)
+	require.NoError(t, err)
+	rel, err = h.globalCfg.Releases.Last("bd")
+	require.NoError(t, err)
+	assert.Equal(t, release.StatusDeployed, rel.Info.Status)
+
+	// the inventory is forgotten afterwards, but the objects are kept
+	cm := newObject("v1", "ConfigMap", "app", "config")
+	require.NoError(t, h.ForgetInventory(ctx, "bd"))
+	assert.True(t, exists(t, c, cm))
+	deployed, err = h.ListInventories(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, deployed)
+}
+
+func TestListInventoriesSkipsInvalidInventory(t *testing.T) {
+	ctx := context.Background()
+	corrupt := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   testAgentNamespace,
+			Name:        inventoryName("corrupt"),
+			Labels:      map[string]string{InventoryLabel: "true"},
+			Annotations: map[string]string{BundleIDAnnotation: "corrupt"},
+		},
+		Type: InventorySecretType,
+		Data: map[string][]byte{inventoryKey: []byte("not compressed")},
+	}
+	h, c := newSSATestHelm(t, corrupt)
+
+	_, err := h.applyInventory(ctx, c, "bd", []*unstructured.Unstructured{newObject("v1", "ConfigMap", "app", "config")}, "app", fleet.BundleDeploymentOptions{})
+	require.NoError(t, err)
+
+	deployed, err := h.ListInventories(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []DeployedBundle{{BundleID: "bd", ReleaseName: "app/bd"}}, deployed)
+}
+
+func TestRenderKeepsChartCRDs(t *testing.T) {
+	h, _ := newSSATestHelm(t)
+	crd := func(name string) []byte {
+		return []byte("apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: " + name + "\n")
+	}
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "app", Version: "0.1.0"},
+		Templates: []*chart.File{
+			{Name: "templates/crd.yaml", Data: crd("templated.example.com")},
+		},
+		Files: []*chart.File{
+			{Name: "crds/crd.yaml", Data: crd("things.example.com")},
+		},
+	}
+	// CRDs of the templates are deleted, if requested
+	opts := fleet.BundleDeploymentOptions{DeleteCRDResources: true, Helm: &fleet.HelmOptions{}}
+
+	objs, err := h.render(context.Background(), "bd", manifest.New(nil), ch, opts, nil, "app")
+	require.NoError(t, err)
+	require.Len(t, objs, 2)
+
+	keep := map[string]bool{}
+	for _, obj := range objs {
+		keep[obj.GetName()] = obj.GetAnnotations()[kube.ResourcePolicyAnno] == kube.KeepPolicy
+		assert.Equal(t, "Helm", obj.GetLabels()["app.kubernetes.io/managed-by"])
+		assert.Equal(t, "bd", obj.GetAnnotations()["meta.helm.sh/release-name"])
+		assert.Equal(t, "app", obj.GetAnnotations()["meta.helm.sh/release-namespace"])
+	}
+	assert.Equal(t, map[string]bool{"things.example.com": true, "templated.example.com": false}, keep)
+}
@@ -34,7 +34,7 @@ func Template(ctx context.Context, bundleID string, manifest *manifest.Manifest,
 	h.globalCfg.Log = logrus.Infof
 	h.globalCfg.Releases = storage.Init(mem)
 
-	resources, err := h.Deploy(ctx, bundleID, manifest, options)
+	resources, err := h.Deploy(ctx, bundleID, manifest, options, nil)
 	if err != nil {
 		return nil, err
 	}
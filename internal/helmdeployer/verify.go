@@ -0,0 +1,256 @@
+package helmdeployer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// HookVerify is the phase of the verification job, which runs after
+	// the bundle was deployed
+	HookVerify = "verify"
+	// HookHelmTest is the phase of the test hooks of a release
+	HookHelmTest = "helmTest"
+
+	DefaultHelmTestTimeout = 5 * time.Minute
+
+	// maxLogLines is the number of log lines kept in failure messages
+	maxLogLines = 10
+	// maxLogBytes limits the size of the log lines in failure messages
+	maxLogBytes = 1024
+)
+
+// TestRelease runs the test hooks of the bundledeployment's release, like
+// `helm test`, without waiting for them. Each call starts the next test, once
+// the previous one completed, in the order of their weights and returns the
+// state of the tests. Tests from previous deployments are replaced. If a test
+// fails, the result contains an excerpt of its pods' logs.
+func (h *Helm) TestRelease(ctx context.Context, bd *fleet.BundleDeployment, timeout time.Duration) (HookResult, error) {
+	releaseName, version, namespace, err := getReleaseNameVersionAndNamespace(bd.Name, bd.Status.Release)
+	if err != nil {
+		return HookResult{}, err
+	}
+
+	rel, err := h.getRelease(releaseName, namespace, version)
+	if err != nil {
+		return HookResult{}, err
+	}
+
+	c, err := h.applyClient(ctx, bd.Spec.Options.ServiceAccount)
+	if err != nil {
+		return HookResult{}, err
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultHelmTestTimeout
+	}
+	return h.runTests(ctx, c, bd, rel, timeout)
+}
+
+func (h *Helm) runTests(ctx context.Context, c client.Client, bd *fleet.BundleDeployment, rel *release.Release, timeout time.Duration) (HookResult, error) {
+	logger := log.FromContext(ctx).WithName("TestRelease")
+	result := HookResult{}
+
+	for _, hook := range testHooks(rel) {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(hook.Manifest), &obj.Object); err != nil {
+			return result, fmt.Errorf("helm test %s: %w", hook.Path, err)
+		}
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(rel.Namespace)
+		}
+		desc := fmt.Sprintf("%s %s/%s", strings.ToLower(obj.GetKind()), obj.GetNamespace(), obj.GetName())
+
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(obj.GroupVersionKind())
+		err := c.Get(ctx, client.ObjectKeyFromObject(obj), live)
+		switch {
+		case apierrors.IsNotFound(err):
+			obj.SetLabels(mergeMaps(obj.GetLabels(), map[string]string{
+				HookBundleIDLabel: bd.Name,
+				HookPhaseLabel:    HookHelmTest,
+			}))
+			obj.SetAnnotations(mergeMaps(obj.GetAnnotations(), map[string]string{
+				HookDeploymentIDAnnotation: bd.Spec.DeploymentID,
+			}))
+			logger.Info("Starting helm test", "test", desc, "release", bd.Status.Release)
+			if err := c.Create(ctx, obj, client.FieldOwner(FieldManager)); err != nil && !apierrors.IsAlreadyExists(err) {
+				return result, fmt.Errorf("helm test %s: %w", hook.Path, err)
+			}
+			result.Pending = append(result.Pending, desc)
+			return result, nil
+		case err != nil:
+			return result, err
+		case live.GetAnnotations()[HookDeploymentIDAnnotation] != bd.Spec.DeploymentID:
+			// the test ran for another deployment, it is created again
+			// once it is deleted
+			if live.GetDeletionTimestamp() == nil {
+				err := c.Delete(ctx, live, client.PropagationPolicy(metav1.DeletePropagationBackground))
+				if client.IgnoreNotFound(err) != nil {
+					return result, err
+				}
+			}
+			result.Pending = append(result.Pending, desc)
+			return result, nil
+		}
+
+		pending, failed, err := testState(live, timeout, time.Now())
+		if err != nil {
+			return result, err
+		}
+		switch {
+		case failed != "":
+			result.Failed = append(result.Failed, fmt.Sprintf("%s: %s%s", desc, failed, h.testLogs(ctx, live)))
+			return result, nil
+		case pending:
+			result.Pending = append(result.Pending, desc)
+			return result, nil
+		}
+	}
+
+	return result, nil
+}
+
+// testHooks returns the test hooks of the release, ordered by weight and
+// name like helm runs them (pure function)
+func testHooks(rel *release.Release) []*release.Hook {
+	var hooks []*release.Hook
+	for _, hook := range rel.Hooks {
+		if slices.Contains(hook.Events, release.HookTest) {
+			hooks = append(hooks, hook)
+		}
+	}
+	sort.SliceStable(hooks, func(i, j int) bool {
+		if hooks[i].Weight != hooks[j].Weight {
+			return hooks[i].Weight < hooks[j].Weight
+		}
+		return hooks[i].Name < hooks[j].Name
+	})
+	return hooks
+}
+
+// testState returns whether the test pod or job is still running, or why it
+// failed. Tests of other kinds complete once they are created (pure
+// function).
+func testState(obj *unstructured.Unstructured, timeout time.Duration, now time.Time) (bool, string, error) {
+	switch obj.GroupVersionKind() {
+	case corev1.SchemeGroupVersion.WithKind("Pod"):
+		pod := &corev1.Pod{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, pod); err != nil {
+			return false, "", err
+		}
+		switch pod.Status.Phase {
+		case corev1.PodSucceeded:
+			return false, "", nil
+		case corev1.PodFailed:
+			if pod.Status.Message != "" {
+				return false, pod.Status.Message, nil
+			}
+			return false, "failed", nil
+		}
+		if now.Sub(pod.CreationTimestamp.Time) > timeout {
+			return false, fmt.Sprintf("did not complete within %s", timeout), nil
+		}
+		return true, "", nil
+	case batchv1.SchemeGroupVersion.WithKind("Job"):
+		job := &batchv1.Job{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, job); err != nil {
+			return false, "", err
+		}
+		pending, failed := jobState(job, timeout, now)
+		return pending, failed, nil
+	}
+	return false, "", nil
+}
+
+// testLogs returns an excerpt of the logs of the test pod or job
+func (h *Helm) testLogs(ctx context.Context, obj *unstructured.Unstructured) string {
+	if obj.GetKind() == "Job" {
+		return h.podLogs(ctx, obj.GetNamespace(), metav1.ListOptions{LabelSelector: "job-name=" + obj.GetName()})
+	}
+	return h.podLogs(ctx, obj.GetNamespace(), metav1.ListOptions{FieldSelector: "metadata.name=" + obj.GetName()})
+}
+
+// jobLogs returns an excerpt of the logs of the job's pods
+func (h *Helm) jobLogs(ctx context.Context, job *batchv1.Job) string {
+	// the legacy label is set by all supported Kubernetes versions
+	return h.podLogs(ctx, job.Namespace, metav1.ListOptions{LabelSelector: "job-name=" + job.Name})
+}
+
+// podLogs returns an excerpt of the logs of the selected pods. Only the last
+// lines of each pod are read. Errors are logged, as the logs are
+// informational.
+func (h *Helm) podLogs(ctx context.Context, namespace string, opts metav1.ListOptions) string {
+	logger := log.FromContext(ctx).WithName("podLogs")
+
+	clientSet, err := kube.New(h.getter).Factory.KubernetesClientSet()
+	if err != nil {
+		logger.V(1).Info("Cannot read logs of pods", "namespace", namespace, "error", err)
+		return ""
+	}
+
+	pods, err := clientSet.CoreV1().Pods(namespace).List(ctx, opts)
+	if err != nil {
+		logger.V(1).Info("Cannot read logs of pods", "namespace", namespace, "error", err)
+		return ""
+	}
+
+	tailLines, limitBytes := int64(maxLogLines), int64(maxLogBytes)
+	var logs bytes.Buffer
+	for _, pod := range pods.Items {
+		stream, err := clientSet.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+			TailLines:  &tailLines,
+			LimitBytes: &limitBytes,
+		}).Stream(ctx)
+		if err != nil {
+			logger.V(1).Info("Cannot read logs of pod", "pod", pod.Namespace+"/"+pod.Name, "error", err)
+			continue
+		}
+		fmt.Fprintf(&logs, "POD LOGS: %s\n", pod.Name)
+		_, err = io.Copy(&logs, io.LimitReader(stream, limitBytes))
+		stream.Close()
+		if err != nil {
+			logger.V(1).Info("Cannot read logs of pod", "pod", pod.Namespace+"/"+pod.Name, "error", err)
+		}
+		fmt.Fprintln(&logs)
+	}
+	return logExcerpt(logs.String())
+}
+
+// logExcerpt returns the last lines of the logs, prefixed by a newline, or
+// an empty string if there are no logs (pure function)
+func logExcerpt(logs string) string {
+	lines := strings.Split(strings.TrimSpace(logs), "\n")
+	if len(lines) > maxLogLines {
+		lines = lines[len(lines)-maxLogLines:]
+	}
+	excerpt := strings.Join(lines, "\n")
+	if len(excerpt) > maxLogBytes {
+		excerpt = excerpt[len(excerpt)-maxLogBytes:]
+	}
+	if excerpt == "" {
+		return ""
+	}
+	return "\n" + excerpt
+}
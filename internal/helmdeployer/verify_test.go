@@ -0,0 +1,97 @@
+package helmdeployer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"helm.sh/helm/v3/pkg/release"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLogExcerpt(t *testing.T) {
+	assert.Empty(t, logExcerpt(""))
+	assert.Equal(t, "\nPOD LOGS: test\nok", logExcerpt("POD LOGS: test\nok\n\n"))
+
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, strings.Repeat("x", i))
+	}
+	excerpt := logExcerpt(strings.Join(lines, "\n"))
+	assert.Equal(t, "\n"+strings.Join(lines[10:], "\n"), excerpt)
+
+	excerpt = logExcerpt(strings.Repeat("y", 2000))
+	assert.Len(t, excerpt, maxLogBytes+1)
+}
+
+func TestRunTests(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	stale := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "test-connection"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(stale).Build()
+	h := &Helm{client: c}
+
+	bd := &fleet.BundleDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app"},
+		Spec:       fleet.BundleDeploymentSpec{DeploymentID: "s-1:abc"},
+	}
+	rel := &release.Release{Namespace: "app", Hooks: []*release.Hook{
+		{Name: "test-db", Weight: 1, Events: []release.HookEvent{release.HookTest},
+			Manifest: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: test-db\n"},
+		{Name: "install", Events: []release.HookEvent{release.HookPreInstall},
+			Manifest: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: install\n"},
+		{Name: "test-connection", Events: []release.HookEvent{release.HookTest},
+			Manifest: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: test-connection\n"},
+	}}
+
+	// the pod of a previous deployment is replaced
+	result, err := h.runTests(ctx, c, bd, rel, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pod app/test-connection"}, result.Pending)
+	pod := &corev1.Pod{}
+	assert.True(t, apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(stale), pod)))
+
+	// the tests run one after the other, ordered by weight
+	result, err = h.runTests(ctx, c, bd, rel, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pod app/test-connection"}, result.Pending)
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(stale), pod))
+	assert.Equal(t, "s-1:abc", pod.Annotations[HookDeploymentIDAnnotation])
+	// the fake client does not set the creation timestamp
+	pod.CreationTimestamp = metav1.Now()
+	require.NoError(t, c.Update(ctx, pod))
+
+	result, err = h.runTests(ctx, c, bd, rel, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pod app/test-connection"}, result.Pending, "the pod did not complete yet")
+
+	pod.Status.Phase = corev1.PodSucceeded
+	require.NoError(t, c.Status().Update(ctx, pod))
+	result, err = h.runTests(ctx, c, bd, rel, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"job app/test-db"}, result.Pending)
+
+	job := &batchv1.Job{}
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "app", Name: "test-db"}, job))
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	require.NoError(t, c.Status().Update(ctx, job))
+	result, err = h.runTests(ctx, c, bd, rel, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, result.Completed())
+	assert.Error(t, c.Get(ctx, client.ObjectKey{Namespace: "app", Name: "install"}, &batchv1.Job{}), "only test hooks run")
+}
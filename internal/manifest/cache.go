@@ -0,0 +1,145 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// CacheLabel marks the secrets, which cache the contents of manifests
+	// on the agent's cluster
+	CacheLabel = "fleet.cattle.io/manifest-cache"
+	// CacheSecretType is the type of the manifest cache secrets
+	CacheSecretType = "fleet.cattle.io/manifest-cache"
+	// CacheManifestIDAnnotation is the ID of the manifest in a cache secret
+	CacheManifestIDAnnotation = "fleet.cattle.io/manifest-id"
+
+	cacheContentKey   = "content"
+	cacheSHA256SumKey = "sha256sum"
+)
+
+// CachedLookup looks up manifests in secrets on the local cluster, before
+// falling back to the content resources of the upstream cluster. Manifests
+// read from upstream are cached, so the agent can deploy known manifests
+// while the upstream cluster is unreachable. As manifest IDs are derived
+// from the SHA256 sum of the manifest, cached manifests never change.
+type CachedLookup struct {
+	Lookup
+
+	client    client.Client
+	namespace string
+}
+
+// NewCachedLookup returns a lookup, which caches manifests in secrets of
+// the namespace on the local cluster
+func NewCachedLookup(local client.Client, namespace string) *CachedLookup {
+	return &CachedLookup{
+		client:    local,
+		namespace: namespace,
+	}
+}
+
+func (l *CachedLookup) Get(ctx context.Context, upstream client.Reader, id string) (*Manifest, error) {
+	logger := log.FromContext(ctx).WithName("manifest-cache").WithValues("manifestID", id)
+
+	secret := &corev1.Secret{}
+	err := l.client.Get(ctx, types.NamespacedName{Namespace: l.namespace, Name: cacheName(id)}, secret)
+	if err == nil {
+		m, err := fromCache(secret, id)
+		if err == nil {
+			return m, nil
+		}
+		logger.Info("Ignoring invalid cached manifest", "error", err)
+	} else if !apierrors.IsNotFound(err) {
+		logger.V(1).Info("Cannot read cached manifest", "error", err)
+	}
+
+	c := &fleet.Content{}
+	if err := upstream.Get(ctx, types.NamespacedName{Name: id}, c); err != nil {
+		return nil, err
+	}
+	m, err := fromContent(c.Content, c.SHA256Sum)
+	if err != nil {
+		return nil, err
+	}
+
+	// the manifest is usable, even if it cannot be cached
+	if err := l.store(ctx, id, c); err != nil {
+		logger.Error(err, "Failed to cache manifest")
+	}
+	return m, nil
+}
+
+// Prune deletes the cached manifests, which are not in use
+func (l *CachedLookup) Prune(ctx context.Context, inUse map[string]bool) error {
+	secrets := &corev1.SecretList{}
+	err := l.client.List(ctx, secrets, client.InNamespace(l.namespace), client.MatchingLabels{CacheLabel: "true"})
+	if err != nil {
+		return err
+	}
+
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.Type != CacheSecretType || inUse[secret.Annotations[CacheManifestIDAnnotation]] {
+			continue
+		}
+		log.FromContext(ctx).V(1).Info("Deleting cached manifest", "manifestID", secret.Annotations[CacheManifestIDAnnotation])
+		if err := client.IgnoreNotFound(l.client.Delete(ctx, secret)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *CachedLookup) store(ctx context.Context, id string, c *fleet.Content) error {
+	data := map[string][]byte{
+		cacheContentKey:   c.Content,
+		cacheSHA256SumKey: []byte(c.SHA256Sum),
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   l.namespace,
+			Name:        cacheName(id),
+			Labels:      map[string]string{CacheLabel: "true"},
+			Annotations: map[string]string{CacheManifestIDAnnotation: id},
+		},
+		Type: CacheSecretType,
+		Data: data,
+	}
+	err := l.client.Create(ctx, secret)
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	// replace an invalid cache entry
+	if err := l.client.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
+		return err
+	}
+	secret.Data = data
+	return l.client.Update(ctx, secret)
+}
+
+// fromCache returns the manifest of the cache secret, after verifying its
+// SHA256 sum matches the manifest ID
+func fromCache(secret *corev1.Secret, id string) (*Manifest, error) {
+	sha256sum := string(secret.Data[cacheSHA256SumKey])
+	if sha256sum == "" || toSHA256ID(sha256sum) != id {
+		return nil, fmt.Errorf("SHA256 sum %q does not match manifest %s", sha256sum, id)
+	}
+	return fromContent(secret.Data[cacheContentKey], sha256sum)
+}
+
+// cacheName returns the name of the cache secret of the manifest
+func cacheName(id string) string {
+	return "fleet-manifest-" + id
+}
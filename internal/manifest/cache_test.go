@@ -0,0 +1,79 @@
+package manifest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rancher/fleet/internal/content"
+	fleet "github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCachedLookup(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(fleet.AddToScheme(scheme))
+
+	m := New([]fleet.BundleResource{{Name: "foo", Content: "bar"}})
+	id, err := m.ID()
+	require.NoError(t, err)
+	data, err := m.Content()
+	require.NoError(t, err)
+	sha256sum, err := m.SHASum()
+	require.NoError(t, err)
+	compressed, err := content.Gzip(data)
+	require.NoError(t, err)
+
+	upstream := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&fleet.Content{
+		ObjectMeta: metav1.ObjectMeta{Name: id},
+		Content:    compressed,
+		SHA256Sum:  sha256sum,
+	}).Build()
+	local := fake.NewClientBuilder().WithScheme(scheme).Build()
+	lookup := NewCachedLookup(local, "cattle-fleet-system")
+
+	got, err := lookup.Get(ctx, upstream, id)
+	require.NoError(t, err)
+	assert.Equal(t, m.Resources, got.Resources)
+
+	// the cached manifest is used while upstream is unreachable
+	unreachable := fake.NewClientBuilder().WithScheme(scheme).Build()
+	got, err = lookup.Get(ctx, unreachable, id)
+	require.NoError(t, err)
+	assert.Equal(t, m.Resources, got.Resources)
+
+	// invalid cache entries are replaced
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: "cattle-fleet-system", Name: cacheName(id)}
+	require.NoError(t, local.Get(ctx, key, secret))
+	secret.Data[cacheContentKey] = []byte("corrupted")
+	require.NoError(t, local.Update(ctx, secret))
+	_, err = lookup.Get(ctx, unreachable, id)
+	assert.Error(t, err)
+	_, err = lookup.Get(ctx, upstream, id)
+	require.NoError(t, err)
+	require.NoError(t, local.Get(ctx, key, secret))
+	assert.Equal(t, compressed, secret.Data[cacheContentKey])
+
+	require.NoError(t, lookup.Prune(ctx, map[string]bool{id: true}))
+	require.NoError(t, local.Get(ctx, key, secret))
+	require.NoError(t, lookup.Prune(ctx, map[string]bool{}))
+	assert.Error(t, local.Get(ctx, key, secret))
+}
+
+func TestFromCache(t *testing.T) {
+	secret := &corev1.Secret{Data: map[string][]byte{cacheSHA256SumKey: []byte("752ebbb975f52eea5e87950ef2ca5de4055de3c68a17f54d94527d7fd79c21fd")}}
+	_, err := fromCache(secret, "s-0000")
+	assert.ErrorContains(t, err, "does not match manifest")
+}
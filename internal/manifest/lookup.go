@@ -24,9 +24,15 @@ func (l *Lookup) Get(ctx context.Context, client client.Reader, id string) (*Man
 		return nil, err
 	}
 
-	data, err := content.GUnzip(c.Content)
+	return fromContent(c.Content, c.SHA256Sum)
+}
+
+// fromContent returns the manifest of the gzipped content, after verifying
+// its SHA256 sum
+func fromContent(compressed []byte, sha256sum string) (*Manifest, error) {
+	data, err := content.GUnzip(compressed)
 	if err != nil {
 		return nil, err
 	}
-	return FromJSON(data, c.SHA256Sum)
+	return FromJSON(data, sha256sum)
 }
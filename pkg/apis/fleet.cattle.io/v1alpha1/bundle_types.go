@@ -50,6 +50,49 @@ var (
 
 type BundleState string
 
+// TargetingOutcome describes whether a cluster is targeted by a bundle, or why
+// it is not.
+type TargetingOutcome string
+
+const (
+	// TargetingMatched: the cluster matched a target and a bundledeployment
+	// is created for it.
+	TargetingMatched TargetingOutcome = "Matched"
+	// TargetingNoMatch: none of the bundle's targets matched the cluster.
+	TargetingNoMatch TargetingOutcome = "NoMatch"
+	// TargetingRestricted: a target matched the cluster, but the cluster is
+	// not allowed by the bundle's target restrictions, e.g. because it was
+	// not targeted by the GitRepo.
+	TargetingRestricted TargetingOutcome = "Restricted"
+	// TargetingDoNotDeploy: the matching target customization has
+	// doNotDeploy set.
+	TargetingDoNotDeploy TargetingOutcome = "DoNotDeploy"
+	// TargetingNotSampled: a target matched the cluster, but the cluster
+	// is not part of the target's sample and no other target matched.
+	TargetingNotSampled TargetingOutcome = "NotSampled"
+	// TargetingUnmetRequirement: the cluster does not satisfy the bundle's
+	// requirements.
+	TargetingUnmetRequirement TargetingOutcome = "UnmetRequirement"
+	// TargetingWaitingForNamespace: the cluster matched, but its namespace
+	// for bundledeployments has not been created yet.
+	TargetingWaitingForNamespace TargetingOutcome = "WaitingForNamespace"
+	// TargetingClusterNotFound: the cluster to explain does not exist in
+	// any namespace the bundle can be deployed to.
+	TargetingClusterNotFound TargetingOutcome = "ClusterNotFound"
+)
+
+const (
+	// PromotedPartitionAnnotation is set on a bundle to the name of the
+	// last partition, which may be updated in a sequential rollout, which
+	// requires approval.
+	PromotedPartitionAnnotation = "fleet.cattle.io/promoted-partition"
+	// ExplainClusterAnnotation is set on a bundle to request an
+	// explanation of the targeting decision for a single cluster. The
+	// value is either "namespace/name" or the name of a cluster in the
+	// bundle's namespace. The result is written to status.explanation.
+	ExplainClusterAnnotation = "fleet.cattle.io/explain-cluster"
+)
+
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:object:root=true
@@ -110,8 +153,33 @@ type BundleSpec struct {
 	// DependsOn refers to the bundles which must be ready before this bundle can be deployed.
 	// +nullable
 	DependsOn []BundleRef `json:"dependsOn,omitempty"`
+
+	// Requires lists capabilities a cluster must have for the bundle to be
+	// deployed to it. Clusters which match a target, but do not satisfy
+	// the requirements, are skipped.
+	// +nullable
+	Requires *BundleRequirements `json:"requires,omitempty"`
 }
 
+// BundleRequirements are capabilities a cluster must have. They are checked
+// against the facts reported by the cluster's agent.
+type BundleRequirements struct {
+	// KubeVersion is a semver constraint the cluster's Kubernetes version
+	// must satisfy, e.g. ">=1.27".
+	// +nullable
+	KubeVersion string `json:"kubeVersion,omitempty"`
+	// APIs lists the API resources, which must be served by the cluster.
+	// Entries are either in the form "group/version/Kind", e.g.
+	// "monitoring.coreos.com/v1/ServiceMonitor", or "group/version" to
+	// require any resource of that group version.
+	// +nullable
+	APIs []string `json:"apis,omitempty"`
+}
+
+// PendingReasonClusterDependency is the reason for a pending deployment,
+// which waits for a bundle on another cluster to become ready.
+const PendingReasonClusterDependency = "ClusterDependency"
+
 type BundleRef struct {
 	// Name of the bundle.
 	// +nullable
@@ -119,6 +187,48 @@ type BundleRef struct {
 	// Selector matching bundle's labels.
 	// +nullable
 	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// ClusterName refers to the bundle deployed to another cluster in
+	// the bundle's namespace, e.g. a central cluster providing a
+	// registry. Instead of the agent, the Fleet controller checks these
+	// dependencies and holds back the deployment until the referenced
+	// bundle is ready on that cluster.
+	// +nullable
+	ClusterName string `json:"clusterName,omitempty"`
+	// ClusterSelector refers to the bundle deployed to all matching
+	// clusters in the bundle's namespace, like ClusterName.
+	// +nullable
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+	// Resource refers to a resource on the target cluster, regardless of
+	// which bundle deployed it. The agent waits for the resource, before
+	// it deploys this bundle.
+	// +nullable
+	Resource *ResourceRef `json:"resource,omitempty"`
+}
+
+// ResourceRef refers to a resource on the target cluster and optionally a
+// state it needs to reach, e.g. a CRD being established.
+type ResourceRef struct {
+	// APIVersion of the resource, e.g. "apiextensions.k8s.io/v1".
+	APIVersion string `json:"apiVersion"`
+	// Kind of the resource, e.g. "CustomResourceDefinition".
+	Kind string `json:"kind"`
+	// Name of the resource.
+	Name string `json:"name"`
+	// Namespace of the resource, empty for cluster scoped resources.
+	// +nullable
+	Namespace string `json:"namespace,omitempty"`
+	// Condition is the type of a status condition, which needs to be
+	// "True", e.g. "Established" or "Available".
+	// +nullable
+	Condition string `json:"condition,omitempty"`
+	// JSONPath is evaluated against the resource, e.g.
+	// "{.status.readyReplicas}". The result needs to equal Value, or
+	// needs to be non-empty if no value is given.
+	// +nullable
+	JSONPath string `json:"jsonPath,omitempty"`
+	// Value is the expected result of the JSONPath expression.
+	// +nullable
+	Value string `json:"value,omitempty"`
 }
 
 // BundleResource represents the content of a single resource from the bundle, like a YAML manifest.
@@ -141,7 +251,7 @@ type RolloutStrategy struct {
 	// +nullable
 	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
 	// A number or percentage of cluster partitions that can be unavailable during
-	// an update of a bundle.
+	// an update of a bundle. Cannot be used with sequential rollouts.
 	// default: 0
 	// +nullable
 	MaxUnavailablePartitions *intstr.IntOrString `json:"maxUnavailablePartitions,omitempty"`
@@ -155,6 +265,42 @@ type RolloutStrategy struct {
 	// autoPartitionSize.
 	// +nullable
 	Partitions []Partition `json:"partitions,omitempty"`
+	// Sequential rolls out the partitions strictly in order. A partition
+	// only receives the new deployment after all clusters of the previous
+	// partitions are ready and up to date. MaxUnavailablePartitions
+	// must not be set.
+	Sequential bool `json:"sequential,omitempty"`
+	// SoakDuration is the time a partition needs to be ready, before the
+	// next partition is updated. Only used for sequential rollouts.
+	// +nullable
+	SoakDuration *metav1.Duration `json:"soakDuration,omitempty"`
+	// RequireApproval requires every partition, except the first, to be
+	// promoted before it is updated. Only used for sequential rollouts.
+	// A partition is promoted by setting the
+	// "fleet.cattle.io/promoted-partition" annotation on the bundle to
+	// its name, or the name of a later partition. The annotation is
+	// removed whenever the bundle changes.
+	RequireApproval bool `json:"requireApproval,omitempty"`
+	// FailurePolicy halts the rollout and reverts the updated clusters to
+	// their last known good deployment, if too many clusters fail.
+	// +nullable
+	FailurePolicy *FailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// FailurePolicy defines when a rollout is considered failed and rolled back.
+type FailurePolicy struct {
+	// MaxFailures is the number or percentage of clusters, which may fail
+	// to deploy the new version, before the rollout is rolled back. A
+	// cluster fails if its bundledeployment is in the ErrApplied state,
+	// or NotReady after the evaluation window.
+	// default: 10%, at least one cluster
+	// +nullable
+	MaxFailures *intstr.IntOrString `json:"maxFailures,omitempty"`
+	// EvaluationWindow is the time, after the rollout started, clusters
+	// may be NotReady before they are counted as failed.
+	// default: 5m
+	// +nullable
+	EvaluationWindow *metav1.Duration `json:"evaluationWindow,omitempty"`
 }
 
 // Partition defines a separate rollout strategy for a set of clusters.
@@ -217,6 +363,28 @@ type BundleTarget struct {
 	ClusterGroupSelector *metav1.LabelSelector `json:"clusterGroupSelector,omitempty"`
 	// DoNotDeploy if set to true, will not deploy to this target.
 	DoNotDeploy bool `json:"doNotDeploy,omitempty"`
+	// Sample restricts the target to a stable, deterministic subset of
+	// the clusters matched by the selectors. Clusters outside of the
+	// sample are not targeted, they are not evaluated against the
+	// following targets.
+	// +nullable
+	Sample *TargetSample `json:"sample,omitempty"`
+}
+
+// TargetSample selects a percentage of the clusters matched by a target. A
+// cluster is part of the sample if the hash of the seed and its name falls
+// below the percentage. The selection of a cluster does not depend on other
+// clusters, so adding or removing clusters does not change the sample.
+type TargetSample struct {
+	// Percent of the matching clusters to select, between 0 and 100.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Percent int `json:"percent,omitempty"`
+	// Seed is mixed into the hash of the cluster name. Targets using the
+	// same seed and a larger percentage select a superset of the
+	// clusters, changing the seed selects a different subset.
+	// +nullable
+	Seed string `json:"seed,omitempty"`
 }
 
 // BundleSummary contains the number of bundle deployments in each state and a
@@ -287,11 +455,34 @@ const (
 	// BundleDeploymentConditionInstalled indicates the bundledeployment
 	// has been installed.
 	BundleDeploymentConditionInstalled = "Installed"
+	// BundleConditionRolledBack is true, if the failure policy rolled
+	// back the rollout of the bundle's current generation.
+	BundleConditionRolledBack = "RolledBack"
+	// BundleConditionDependenciesValid is false, if the bundle's
+	// dependsOn references can never be satisfied on a targeted cluster,
+	// because they form a cycle or match no bundle deployed to it.
+	BundleConditionDependenciesValid = "DependenciesValid"
+	// BundleConditionRolloutValid is false, if the options of the
+	// bundle's rollout strategy contradict each other. The rollout is
+	// halted until the strategy is fixed.
+	BundleConditionRolloutValid = "RolloutValid"
 	// BundleDeploymentConditionDeployed is used by the bundledeployment
 	// controller. It is true if the handler returns no error and false if
 	// an error is returned.
 	BundleDeploymentConditionDeployed  = "Deployed"
 	BundleDeploymentConditionMonitored = "Monitored"
+	// BundleDeploymentConditionPreDeployHooks is true if the preDeploy
+	// hooks of the bundledeployment's current deployment completed, and
+	// unknown while they run.
+	BundleDeploymentConditionPreDeployHooks = "PreDeployHooks"
+	// BundleDeploymentConditionPostDeployHooks is true if the postDeploy
+	// hooks of the bundledeployment's current deployment completed, and
+	// unknown while they run.
+	BundleDeploymentConditionPostDeployHooks = "PostDeployHooks"
+	// BundleDeploymentConditionVerified is true if the helm tests and the
+	// verification job of the current deployment passed, and unknown while
+	// the job runs.
+	BundleDeploymentConditionVerified = "Verified"
 )
 
 type BundleStatus struct {
@@ -340,6 +531,83 @@ type BundleStatus struct {
 	ObservedGeneration int64 `json:"observedGeneration"`
 	// ResourcesSHA256Sum corresponds to the JSON serialization of the .Spec.Resources field
 	ResourcesSHA256Sum string `json:"resourcesSha256Sum,omitempty"`
+	// RolloutStarted is the time the rollout of the bundle's current
+	// generation started. It is used to evaluate the failure policy.
+	// +nullable
+	RolloutStarted *metav1.Time `json:"rolloutStarted,omitempty"`
+	// RolledBackGeneration is the generation of the bundle, whose rollout
+	// was rolled back by the failure policy. The rollout stays halted
+	// until the bundle changes.
+	RolledBackGeneration int64 `json:"rolledBackGeneration,omitempty"`
+	// Targeting contains the number of clusters for each targeting
+	// outcome.
+	Targeting TargetingSummary `json:"targeting,omitempty"`
+	// Explanation describes the targeting decision for the cluster
+	// requested by the "fleet.cattle.io/explain-cluster" annotation.
+	// +nullable
+	Explanation *TargetingExplanation `json:"explanation,omitempty"`
+}
+
+// TargetingSummary contains the number of clusters, in the namespaces the
+// bundle can be deployed to, for each targeting outcome.
+type TargetingSummary struct {
+	// Matched is the number of clusters a bundledeployment is created for.
+	Matched int `json:"matched,omitempty"`
+	// NoMatch is the number of clusters none of the targets matched.
+	NoMatch int `json:"noMatch,omitempty"`
+	// Restricted is the number of clusters, which matched a target, but
+	// are excluded by the target restrictions.
+	Restricted int `json:"restricted,omitempty"`
+	// DoNotDeploy is the number of clusters, which matched a target
+	// customization with doNotDeploy set.
+	DoNotDeploy int `json:"doNotDeploy,omitempty"`
+	// NotSampled is the number of clusters, which matched a target, but
+	// are not part of the target's sample.
+	NotSampled int `json:"notSampled,omitempty"`
+	// Sampled is the number of matched clusters, which were selected by
+	// the matching target's sample.
+	Sampled int `json:"sampled,omitempty"`
+	// UnmetRequirement is the number of clusters, which do not satisfy
+	// the bundle's requirements.
+	UnmetRequirement int `json:"unmetRequirement,omitempty"`
+	// WaitingForNamespace is the number of matched clusters, whose
+	// namespace has not been created yet.
+	WaitingForNamespace int `json:"waitingForNamespace,omitempty"`
+}
+
+// TargetingExplanation describes why a bundle is, or is not, deployed to a
+// cluster.
+type TargetingExplanation struct {
+	// Cluster is the namespace and name of the cluster, e.g. "fleet-default/prod-1".
+	// +nullable
+	Cluster string `json:"cluster,omitempty"`
+	// Outcome is the result of the targeting, e.g. "Matched" or "NoMatch".
+	// +nullable
+	Outcome TargetingOutcome `json:"outcome,omitempty"`
+	// Target is the name of the target, which matched the cluster.
+	// +nullable
+	Target string `json:"target,omitempty"`
+	// TargetCustomization is the name of the target customization, which
+	// matched the cluster.
+	// +nullable
+	TargetCustomization string `json:"targetCustomization,omitempty"`
+	// ClusterGroups lists the cluster groups the cluster is a member of.
+	// +nullable
+	ClusterGroups []string `json:"clusterGroups,omitempty"`
+	// Message contains details, e.g. the unmet requirement.
+	// +nullable
+	Message string `json:"message,omitempty"`
+}
+
+// SkippedCluster is a cluster, which was not deployed to, because it does not
+// satisfy the bundle's requirements.
+type SkippedCluster struct {
+	// Name is the namespace and name of the cluster, e.g. "fleet-default/prod-1".
+	// +nullable
+	Name string `json:"name,omitempty"`
+	// Reason describes the unmet requirement.
+	// +nullable
+	Reason string `json:"reason,omitempty"`
 }
 
 // ResourceKey lists resources, which will likely be deployed.
@@ -384,4 +652,32 @@ type PartitionStatus struct {
 	Unavailable int `json:"unavailable,omitempty"`
 	// Summary is a summary state for the partition, calculated over its non-ready resources.
 	Summary BundleSummary `json:"summary,omitempty"`
+	// Phase is the progress of the partition in a sequential rollout.
+	// +nullable
+	Phase PartitionPhase `json:"phase,omitempty"`
+	// ReadySince is the time all clusters of the partition became ready
+	// and up to date. Only set for sequential rollouts.
+	// +nullable
+	ReadySince *metav1.Time `json:"readySince,omitempty"`
 }
+
+// PartitionPhase is the progress of a partition in a sequential rollout.
+type PartitionPhase string
+
+const (
+	// PartitionPending: the partition waits for the previous partitions
+	// to be done.
+	PartitionPending PartitionPhase = "Pending"
+	// PartitionWaitingForApproval: the previous partitions are done, but
+	// the partition has not been promoted yet.
+	PartitionWaitingForApproval PartitionPhase = "WaitingForApproval"
+	// PartitionRollingOut: the partition's clusters receive the new
+	// deployment.
+	PartitionRollingOut PartitionPhase = "RollingOut"
+	// PartitionSoaking: all clusters of the partition are ready, but the
+	// soak duration has not passed yet.
+	PartitionSoaking PartitionPhase = "Soaking"
+	// PartitionDone: all clusters of the partition are ready and the soak
+	// duration passed.
+	PartitionDone PartitionPhase = "Done"
+)
@@ -108,8 +108,115 @@ type BundleDeploymentOptions struct {
 
 	// DeleteCRDResources deletes CRDs. Warning! this will also delete all your Custom Resources.
 	DeleteCRDResources bool `json:"deleteCRDResources,omitempty"`
+
+	// DeployMode selects how the agent deploys the bundle. "helm", the
+	// default, installs a helm release. "serverSideApply" applies the
+	// rendered objects with server-side apply and prunes objects, which are
+	// no longer part of the bundle. Fields owned by other field managers are
+	// reported as conflicts. Switching an existing deployment back to helm
+	// requires helm.takeOwnership.
+	// +kubebuilder:validation:Enum=helm;serverSideApply
+	// +nullable
+	DeployMode string `json:"deployMode,omitempty"`
+
+	// Hooks are jobs, which the agent runs before and after deploying the
+	// bundle.
+	// +nullable
+	Hooks *DeploymentHooks `json:"hooks,omitempty"`
+
+	// Verify checks the deployment after it was installed or upgraded and
+	// its resources are ready.
+	// +nullable
+	Verify *VerifyOptions `json:"verify,omitempty"`
+
+	// HealthChecks compute the readiness of resources, which the agent
+	// cannot summarize, e.g. custom resources without a Ready condition.
+	// They take precedence over the health checks of the agent config.
+	// +nullable
+	HealthChecks []HealthCheck `json:"healthChecks,omitempty"`
+}
+
+// HealthCheck computes the health of resources of a kind with a CEL
+// expression. The expression is evaluated with the resource as "object" and
+// returns "healthy", "progressing" or "degraded", or a map with the keys
+// "status" and "message". Branches returning a string and a map are
+// combined with dyn(), e.g.
+//
+//	object.status.phase == "Healthy" ? "healthy" : dyn({"status": "progressing", "message": object.status.message})
+type HealthCheck struct {
+	// Group of the resources, empty for the core group.
+	// +nullable
+	Group string `json:"group,omitempty"`
+	// Version of the resources. Empty matches all versions.
+	// +nullable
+	Version string `json:"version,omitempty"`
+	// Kind of the resources.
+	Kind string `json:"kind"`
+	// Expression is the CEL expression, which returns the health.
+	Expression string `json:"expression"`
+}
+
+const (
+	// HealthCheckHealthy resources are ready
+	HealthCheckHealthy = "healthy"
+	// HealthCheckProgressing resources are not ready yet, e.g. while they
+	// roll out
+	HealthCheckProgressing = "progressing"
+	// HealthCheckDegraded resources failed
+	HealthCheckDegraded = "degraded"
+)
+
+// VerifyOptions select the checks, which verify a deployment. The result is
+// reported in the Verified condition, a bundledeployment which fails
+// verification is not ready.
+type VerifyOptions struct {
+	// HelmTest runs the test hooks of the chart, like `helm test`, once for
+	// each deployment. Not supported with server-side apply.
+	HelmTest bool `json:"helmTest,omitempty"`
+	// Timeout for each helm test. Defaults to 5m.
+	// +nullable
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// Job is a Job manifest in the bundle, which runs after the helm tests
+	// passed. Like hooks, it is not deployed with the other resources.
+	// +nullable
+	Job *DeploymentHook `json:"job,omitempty"`
+}
+
+// DeploymentHooks are jobs from the bundle, which the agent runs each time a
+// new version of the bundle is deployed. Their results are reported in the
+// PreDeployHooks and PostDeployHooks conditions.
+type DeploymentHooks struct {
+	// PreDeploy jobs run before the resources are deployed. The deployment
+	// waits for them to complete and is blocked if one fails. Jobs run once
+	// per deployment, a failed job is not run again until the bundle or its
+	// forceSyncGeneration changes.
+	// +nullable
+	PreDeploy []DeploymentHook `json:"preDeploy,omitempty"`
+	// PostDeploy jobs run after the resources are deployed and ready. The
+	// bundledeployment is not ready until they complete.
+	// +nullable
+	PostDeploy []DeploymentHook `json:"postDeploy,omitempty"`
+}
+
+// DeploymentHook references a Job manifest in the bundle. The manifest is
+// not deployed with the other resources. If the job fails, an excerpt of its
+// logs is added to the condition's message.
+type DeploymentHook struct {
+	// Path of the Job manifest, relative to the bundle's directory.
+	Path string `json:"path"`
+	// Timeout is the time to wait for the job to complete before it is
+	// considered failed. Defaults to 10m.
+	// +nullable
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
 }
 
+const (
+	// DeployModeHelm deploys a bundle as a helm release
+	DeployModeHelm = "helm"
+	// DeployModeServerSideApply deploys a bundle with server-side apply
+	DeployModeServerSideApply = "serverSideApply"
+)
+
 type DiffOptions struct {
 	// ComparePatches match a resource and remove fields from the check for modifications.
 	// +nullable
@@ -161,6 +268,12 @@ type YAMLOptions struct {
 	// A file named ./overlays/myoverlay/subdir/resource_patch.yaml will patch the base file.
 	// +nullable
 	Overlays []string `json:"overlays,omitempty"`
+	// Template enables templating of raw YAML and kustomize resources.
+	// The resources are rendered per cluster, using the same template
+	// context and '${ }' delimiters as helm values templating. A target
+	// customization can disable it by setting it to false.
+	// +nullable
+	Template *bool `json:"template,omitempty"`
 }
 
 // KustomizeOptions for a deployment.
@@ -307,6 +420,15 @@ type BundleDeploymentSpec struct {
 	DependsOn []BundleRef `json:"dependsOn,omitempty"`
 	// CorrectDrift specifies how drift correction should work.
 	CorrectDrift *CorrectDrift `json:"correctDrift,omitempty"`
+	// KnownGoodDeploymentID is the ID of the last deployment, which was
+	// applied and ready. It is only recorded, if the bundle has a failure
+	// policy, which reverts to it.
+	// +nullable
+	KnownGoodDeploymentID string `json:"knownGoodDeploymentID,omitempty"`
+	// KnownGoodOptions are the deployment options of the known good
+	// deployment.
+	// +nullable
+	KnownGoodOptions *BundleDeploymentOptions `json:"knownGoodOptions,omitempty"`
 }
 
 // BundleDeploymentResource contains the metadata of a deployed resource.
@@ -344,6 +466,66 @@ type BundleDeploymentStatus struct {
 	// according to the helm release history.
 	// +nullable
 	Resources []BundleDeploymentResource `json:"resources,omitempty"`
+	// Pending is set by the Fleet controller, while the staged deployment
+	// is held back, e.g. because the cluster's maintenance windows are
+	// closed.
+	// +nullable
+	Pending *PendingStatus `json:"pending,omitempty"`
+	// UnreadyDependencies is set by the agent, while it waits for the
+	// bundles and resources listed in dependsOn.
+	// +nullable
+	UnreadyDependencies []string `json:"unreadyDependencies,omitempty"`
+	// DriftHistory lists the latest modifications of deployed resources
+	// made outside of Fleet, oldest first. It is set by the agent.
+	// +nullable
+	DriftHistory []DriftIncident `json:"driftHistory,omitempty"`
+	// HookDeploymentIDs records the deployment ID, for which the jobs of a
+	// hook phase finished, by phase. Finished jobs are not started again for
+	// the same deployment, even if they were deleted. It is set by the agent.
+	// +nullable
+	HookDeploymentIDs map[string]string `json:"hookDeploymentIDs,omitempty"`
+}
+
+// DriftIncident records a modification of a deployed resource made outside
+// of Fleet and its correction.
+type DriftIncident struct {
+	ModifiedStatus `json:",inline"`
+	// DetectedAt is the time the agent detected the modification.
+	DetectedAt metav1.Time `json:"detectedAt,omitempty"`
+	// FieldManagers are the field managers of the modified fields, from the
+	// resource's managed fields. For extra resources, these are all field
+	// managers of the resource.
+	// +nullable
+	FieldManagers []string `json:"fieldManagers,omitempty"`
+	// ResolvedAt is the time the agent no longer detected the
+	// modification, e.g. after drift correction reverted it.
+	// +nullable
+	ResolvedAt *metav1.Time `json:"resolvedAt,omitempty"`
+	// Corrected is true if drift correction reverted the modification.
+	// It is set once the modification is no longer detected after the
+	// correction.
+	Corrected bool `json:"corrected,omitempty"`
+	// CorrectionStrategy is the strategy used to correct the drift, e.g.
+	// "rollback" or "patch". It is empty if drift correction is disabled.
+	// +nullable
+	CorrectionStrategy string `json:"correctionStrategy,omitempty"`
+	// CorrectionError is the error of the last failed correction.
+	// +nullable
+	CorrectionError string `json:"correctionError,omitempty"`
+}
+
+// PendingStatus describes why a staged deployment is not applied yet.
+type PendingStatus struct {
+	// Reason is a machine readable reason, e.g. "MaintenanceWindow".
+	// +nullable
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description.
+	// +nullable
+	Message string `json:"message,omitempty"`
+	// Until is the time the staged deployment is expected to be applied,
+	// e.g. when the next maintenance window opens.
+	// +nullable
+	Until *metav1.Time `json:"until,omitempty"`
 }
 
 type BundleDeploymentDisplay struct {
@@ -39,6 +39,27 @@ var (
 	// ClusterLabel is used on a bundledeployment to refer to the targeted
 	// cluster
 	ClusterLabel = "fleet.cattle.io/cluster"
+	// ClusterKubernetesVersionLabel is set by Fleet on a cluster to the
+	// Kubernetes version reported by the agent, e.g. "1.28.5".
+	ClusterKubernetesVersionLabel = "fleet.cattle.io/kubernetes-version"
+	// ClusterKubernetesMinorVersionLabel is set by Fleet on a cluster to
+	// the Kubernetes minor version reported by the agent, e.g. "1.28".
+	ClusterKubernetesMinorVersionLabel = "fleet.cattle.io/kubernetes-minor-version"
+	// ClusterDistributionLabel is set by Fleet on a cluster to the
+	// distribution detected by the agent, e.g. "k3s".
+	ClusterDistributionLabel = "fleet.cattle.io/distribution"
+	// ClusterArchLabelPrefix is the prefix of labels, which are set to
+	// "true" by Fleet on a cluster for each CPU architecture of its nodes,
+	// e.g. "fleet.cattle.io/arch-arm64".
+	ClusterArchLabelPrefix = "fleet.cattle.io/arch-"
+	// ClusterOSLabelPrefix is the prefix of labels, which are set to
+	// "true" by Fleet on a cluster for each operating system of its
+	// nodes, e.g. "fleet.cattle.io/os-linux".
+	ClusterOSLabelPrefix = "fleet.cattle.io/os-"
+	// ClusterNodeLabelPrefix is the prefix of labels, which mirror the
+	// node labels reported by the agent, e.g.
+	// "fleet.cattle.io/node-label-topology.kubernetes.io_region".
+	ClusterNodeLabelPrefix = "fleet.cattle.io/node-label-"
 )
 
 // +genclient
@@ -120,6 +141,14 @@ type ClusterSpec struct {
 	// +nullable
 	// AgentResources sets the resources for the cluster's agent deployment.
 	AgentResources *corev1.ResourceRequirements `json:"agentResources,omitempty"`
+
+	// AgentReplicas is the number of replicas of the cluster's agent. The
+	// replicas elect a leader, which deploys bundles, and are spread
+	// across nodes, unless AgentAffinity sets a pod anti-affinity.
+	// Defaults to 1.
+	// +nullable
+	// +optional
+	AgentReplicas *int32 `json:"agentReplicas,omitempty"`
 }
 
 type ClusterStatus struct {
@@ -176,6 +205,10 @@ type ClusterStatus struct {
 	// configuration, used to detect changes.
 	// +nullable
 	AgentTolerationsHash string `json:"agentTolerationsHash,omitempty"`
+	// AgentReplicasHash is a hash of the agent's replicas configuration,
+	// used to detect changes.
+	// +nullable
+	AgentReplicasHash string `json:"agentReplicasHash,omitempty"`
 	// AgentConfigChanged is set to true if any of the agent configuration
 	// changed, like the API server URL or CA. Setting it to true will
 	// trigger a re-import of the cluster.
@@ -188,6 +221,10 @@ type ClusterStatus struct {
 	// APIServerCAHash is a hash of the upstream API server CA, used to detect changes.
 	// +nullable
 	APIServerCAHash string `json:"apiServerCAHash,omitempty"`
+	// AgentConfigHash is a hash of the manager config settings, which are
+	// copied into the config of imported agents, used to detect changes.
+	// +nullable
+	AgentConfigHash string `json:"agentConfigHash,omitempty"`
 
 	// Display contains the number of ready bundles, nodes and a summary state.
 	Display ClusterDisplay `json:"display,omitempty"`
@@ -234,4 +271,43 @@ type AgentStatus struct {
 	// at most 3 names.
 	// +optional
 	ReadyNodeNames []string `json:"readyNodeNames"`
+	// KubernetesVersion is the version of the cluster's Kubernetes API
+	// server, e.g. "v1.28.5+k3s1".
+	// +optional
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// Distribution is the Kubernetes distribution as detected by the
+	// agent, e.g. "k3s", "rke2" or "eks". It is empty if the distribution
+	// is unknown.
+	// +optional
+	Distribution string `json:"distribution"`
+	// Architectures lists the distinct CPU architectures of the
+	// cluster's nodes, e.g. "amd64" or "arm64".
+	// +optional
+	Architectures []string `json:"architectures"`
+	// OperatingSystems lists the distinct operating systems of the
+	// cluster's nodes, e.g. "linux" or "windows".
+	// +optional
+	OperatingSystems []string `json:"operatingSystems"`
+	// NodeLabels contains the values of the node labels, which the agent
+	// is configured to report. A label is only included if all nodes,
+	// which have the label, share the same value.
+	// +optional
+	NodeLabels []NodeLabel `json:"nodeLabels"`
+	// APIResources lists the API resources served by the cluster, in the
+	// form "group/version/Kind", e.g. "monitoring.coreos.com/v1/ServiceMonitor".
+	// Resources of the core group are listed as "v1/Kind".
+	// +optional
+	APIResources []string `json:"apiResources"`
+	// Leader is the name of the agent replica, which holds the leader
+	// election lease and deploys bundles, e.g. "fleet-agent-0".
+	// +optional
+	Leader string `json:"leader,omitempty"`
+}
+
+// NodeLabel is a node label reported by the agent.
+type NodeLabel struct {
+	// Name of the node label, e.g. "topology.kubernetes.io/region".
+	Name string `json:"name"`
+	// Value shared by all nodes, which have the label.
+	Value string `json:"value"`
 }
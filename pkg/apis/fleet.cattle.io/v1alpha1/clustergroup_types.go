@@ -42,6 +42,30 @@ type ClusterGroupSpec struct {
 	// Selector is a label selector, used to select clusters for this group.
 	// +nullable
 	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Clusters lists the names of clusters in the same namespace, which
+	// are members of this group in addition to the selected ones.
+	// +nullable
+	Clusters []string `json:"clusters,omitempty"`
+
+	// IncludeGroups lists cluster groups in the same namespace, whose
+	// members are members of this group, e.g. "emea" includes
+	// "emea-prod" and "emea-staging".
+	// +nullable
+	IncludeGroups []string `json:"includeGroups,omitempty"`
+
+	// ExcludeGroups lists cluster groups in the same namespace, whose
+	// members are never members of this group, even if selected or
+	// listed.
+	// +nullable
+	ExcludeGroups []string `json:"excludeGroups,omitempty"`
+
+	// TemplateValues defines a mapping of values to be sent to fleet.yaml
+	// values templating, for all clusters in this group. If a cluster
+	// belongs to multiple groups, the values are merged in alphabetical
+	// order of the group names.
+	// +nullable
+	TemplateValues *GenericMap `json:"templateValues,omitempty"`
 }
 
 type ClusterGroupStatus struct {
@@ -54,6 +78,10 @@ type ClusterGroupStatus struct {
 	// NonReadyClusters is a list of cluster names that are not ready.
 	// +nullable
 	NonReadyClusters []string `json:"nonReadyClusters,omitempty"`
+	// Clusters lists the names of all members of the cluster group,
+	// including the members of nested groups.
+	// +nullable
+	Clusters []string `json:"clusters,omitempty"`
 	// Conditions is a list of conditions and their statuses for the cluster group.
 	Conditions []genericcondition.GenericCondition `json:"conditions,omitempty"`
 	// Summary is a summary of the bundle deployments and their resources
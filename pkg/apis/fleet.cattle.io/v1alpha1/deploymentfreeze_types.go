@@ -0,0 +1,76 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	SchemeBuilder.Register(&DeploymentFreeze{}, &DeploymentFreezeList{})
+}
+
+const (
+	// PendingReasonDeploymentFreeze is the reason for a pending
+	// deployment, which waits for a deployment freeze to end.
+	PendingReasonDeploymentFreeze = "DeploymentFreeze"
+	// BundleConditionFrozen is true, if an active deployment freeze holds
+	// back changes of the bundle for at least one of its clusters.
+	BundleConditionFrozen = "Frozen"
+	// GitRepoFrozenCondition is true, if at least one of the gitrepo's
+	// bundles is frozen.
+	GitRepoFrozenCondition = "Frozen"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,categories=fleet
+// +kubebuilder:printcolumn:name="Start",type=string,JSONPath=`.spec.start`
+// +kubebuilder:printcolumn:name="End",type=string,JSONPath=`.spec.end`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.spec.reason`
+
+// DeploymentFreeze stops changes from being rolled out to clusters, e.g.
+// during a company wide change freeze. While a freeze is active, the bundle
+// deployments of the selected bundles and clusters keep their current
+// deployment. Changes stay staged until the freeze ends. Drift correction
+// and status reporting continue as usual.
+type DeploymentFreeze struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DeploymentFreezeSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DeploymentFreezeList contains a list of DeploymentFreeze
+type DeploymentFreezeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DeploymentFreeze `json:"items"`
+}
+
+type DeploymentFreezeSpec struct {
+	// Reason is shown in the conditions of frozen bundles and gitrepos.
+	// +nullable
+	Reason string `json:"reason,omitempty"`
+	// Start of the freeze. If empty, the freeze starts immediately.
+	// +nullable
+	Start *metav1.Time `json:"start,omitempty"`
+	// End of the freeze. If empty, the freeze lasts until it is deleted.
+	// +nullable
+	End *metav1.Time `json:"end,omitempty"`
+
+	// NamespaceSelector selects the namespaces of the frozen bundles, i.e.
+	// the workspaces. If empty, bundles in all namespaces are frozen.
+	// +nullable
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// BundleSelector selects the frozen bundles by their labels. If
+	// empty, all bundles are frozen.
+	// +nullable
+	BundleSelector *metav1.LabelSelector `json:"bundleSelector,omitempty"`
+	// ClusterSelector selects the frozen clusters by their labels. If
+	// empty, all clusters are frozen.
+	// +nullable
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+}
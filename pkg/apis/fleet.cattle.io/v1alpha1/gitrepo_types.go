@@ -13,6 +13,7 @@ var (
 	RepoLabel            = "fleet.cattle.io/repo-name"
 	BundleLabel          = "fleet.cattle.io/bundle-name"
 	BundleNamespaceLabel = "fleet.cattle.io/bundle-namespace"
+	CommitLabel          = "fleet.cattle.io/commit"
 )
 
 const (
@@ -297,4 +298,18 @@ type CorrectDrift struct {
 	Force bool `json:"force,omitempty"`
 	// KeepFailHistory keeps track of failed rollbacks in the helm history.
 	KeepFailHistory bool `json:"keepFailHistory,omitempty"`
+	// Strategy selects how drift is corrected. "rollback", the default,
+	// rolls back the helm release. "patch" only reverts the drifted fields
+	// of the modified objects, creates missing objects and deletes extra
+	// ones.
+	// +kubebuilder:validation:Enum=rollback;patch
+	// +nullable
+	Strategy string `json:"strategy,omitempty"`
 }
+
+const (
+	// DriftCorrectionStrategyRollback corrects drift with a helm rollback
+	DriftCorrectionStrategyRollback = "rollback"
+	// DriftCorrectionStrategyPatch corrects drift by patching the drifted fields
+	DriftCorrectionStrategyPatch = "patch"
+)
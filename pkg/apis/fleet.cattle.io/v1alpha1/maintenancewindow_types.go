@@ -0,0 +1,73 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	SchemeBuilder.Register(&MaintenanceWindow{}, &MaintenanceWindowList{})
+}
+
+const (
+	// IgnoreMaintenanceWindowsAnnotation is set to "true" on a bundle to
+	// roll it out immediately, e.g. for an emergency fix, regardless of
+	// the clusters' maintenance windows.
+	IgnoreMaintenanceWindowsAnnotation = "fleet.cattle.io/ignore-maintenance-windows"
+	// PendingReasonMaintenanceWindow is the reason for a pending
+	// deployment, which waits for a maintenance window to open.
+	PendingReasonMaintenanceWindow = "MaintenanceWindow"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:categories=fleet
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="Duration",type=string,JSONPath=`.spec.duration`
+// +kubebuilder:printcolumn:name="TimeZone",type=string,JSONPath=`.spec.timeZone`
+
+// MaintenanceWindow restricts when the selected clusters receive changes.
+// Changes to bundles stay staged for a cluster, until one of its maintenance
+// windows opens. Clusters, which are not selected by any maintenance window,
+// receive changes immediately.
+type MaintenanceWindow struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MaintenanceWindowSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MaintenanceWindowList contains a list of MaintenanceWindow
+type MaintenanceWindowList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MaintenanceWindow `json:"items"`
+}
+
+type MaintenanceWindowSpec struct {
+	// Schedule is a cron expression in Quartz format, which defines when
+	// the window opens. It contains a seconds field, e.g. "0 0 22 ? * MON-FRI"
+	// opens the window at 10pm on weekdays.
+	Schedule string `json:"schedule"`
+	// Duration is how long the window stays open, e.g. "2h".
+	Duration metav1.Duration `json:"duration"`
+	// TimeZone is the IANA time zone of the schedule, e.g. "Europe/Berlin".
+	// default: UTC
+	// +nullable
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// ClusterName to match a specific cluster by name.
+	// +nullable
+	ClusterName string `json:"clusterName,omitempty"`
+	// ClusterSelector is a selector to match clusters.
+	// +nullable
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+	// ClusterGroup to match a specific cluster group by name.
+	// +nullable
+	ClusterGroup string `json:"clusterGroup,omitempty"`
+	// ClusterGroupSelector is a selector to match cluster groups.
+	// +nullable
+	ClusterGroupSelector *metav1.LabelSelector `json:"clusterGroupSelector,omitempty"`
+}
@@ -20,6 +20,7 @@ const (
 	SlowFailureRateLimiterBase     = time.Second * 2
 	SlowFailureRateLimiterMax      = time.Minute * 10 // hit after 10 failures in a row
 	GarbageCollect                 = time.Minute * 15
+	HookJobPollInterval            = time.Second * 10
 	MonitorBundleDelay             = time.Minute * 5
 	RestConfigTimeout              = time.Second * 15
 	ServiceTokenSleep              = time.Second * 2
@@ -39,9 +39,11 @@ type Interface interface {
 	ClusterRegistration() ClusterRegistrationController
 	ClusterRegistrationToken() ClusterRegistrationTokenController
 	Content() ContentController
+	DeploymentFreeze() DeploymentFreezeController
 	GitRepo() GitRepoController
 	GitRepoRestriction() GitRepoRestrictionController
 	ImageScan() ImageScanController
+	MaintenanceWindow() MaintenanceWindowController
 }
 
 func New(controllerFactory controller.SharedControllerFactory) Interface {
@@ -86,6 +88,10 @@ func (v *version) Content() ContentController {
 	return generic.NewNonNamespacedController[*v1alpha1.Content, *v1alpha1.ContentList](schema.GroupVersionKind{Group: "fleet.cattle.io", Version: "v1alpha1", Kind: "Content"}, "contents", v.controllerFactory)
 }
 
+func (v *version) DeploymentFreeze() DeploymentFreezeController {
+	return generic.NewNonNamespacedController[*v1alpha1.DeploymentFreeze, *v1alpha1.DeploymentFreezeList](schema.GroupVersionKind{Group: "fleet.cattle.io", Version: "v1alpha1", Kind: "DeploymentFreeze"}, "deploymentfreezes", v.controllerFactory)
+}
+
 func (v *version) GitRepo() GitRepoController {
 	return generic.NewController[*v1alpha1.GitRepo, *v1alpha1.GitRepoList](schema.GroupVersionKind{Group: "fleet.cattle.io", Version: "v1alpha1", Kind: "GitRepo"}, "gitrepos", true, v.controllerFactory)
 }
@@ -97,3 +103,7 @@ func (v *version) GitRepoRestriction() GitRepoRestrictionController {
 func (v *version) ImageScan() ImageScanController {
 	return generic.NewController[*v1alpha1.ImageScan, *v1alpha1.ImageScanList](schema.GroupVersionKind{Group: "fleet.cattle.io", Version: "v1alpha1", Kind: "ImageScan"}, "imagescans", true, v.controllerFactory)
 }
+
+func (v *version) MaintenanceWindow() MaintenanceWindowController {
+	return generic.NewController[*v1alpha1.MaintenanceWindow, *v1alpha1.MaintenanceWindowList](schema.GroupVersionKind{Group: "fleet.cattle.io", Version: "v1alpha1", Kind: "MaintenanceWindow"}, "maintenancewindows", true, v.controllerFactory)
+}